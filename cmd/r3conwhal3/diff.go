@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/diff"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/spf13/pflag"
+)
+
+func handleDiff(args []string) {
+	var asJSON bool
+
+	diffCmd := pflag.NewFlagSet("diff", pflag.ExitOnError)
+	diffCmd.BoolVarP(&asJSON, "json", "j", false, "Print the report as JSON")
+	diffCmd.Parse(args)
+
+	// Check if both run directories are provided or not
+	if diffCmd.NArg() != 2 {
+		fmt.Println("Usage: r3conwhal3 diff <path-to-old-run-dir> <path-to-new-run-dir> [--json]")
+		diffCmd.PrintDefaults()
+		return
+	}
+
+	report, err := diff.Compare(diffCmd.Arg(0), diffCmd.Arg(1))
+	if err != nil {
+		log.Fatalf("cannot compare runs: %v", err)
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	for _, line := range report.Summary(0) {
+		fmt.Println(line)
+	}
+}
+
+// diffWithPreviousRun compares a finished run with the latest previous run of the
+// same domain, logs what changed and writes the report to the run directory.
+// It returns nil if there is nothing to compare with.
+func diffWithPreviousRun(log logger.Logger, runDir string) *diff.Report {
+	previous, err := diff.PreviousRun(runDir)
+	if err != nil {
+		log.Warning("Failed to look up the previous run: %v", err)
+		return nil
+	}
+	if previous == "" {
+		log.Info("No previous run found to compare with")
+		return nil
+	}
+
+	report, err := diff.Compare(previous, runDir)
+	if err != nil {
+		log.Warning("Failed to compare with the previous run: %v", err)
+		return nil
+	}
+	for _, line := range report.Summary(20) {
+		log.Info("%s", line)
+	}
+
+	if err := report.Write(filepath.Join(runDir, diff.FileName)); err != nil {
+		log.Warning("Failed to write diff report: %v", err)
+	}
+
+	return report
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
-	"os/signal"
-	"path"
-	"sync"
-	"syscall"
+	"strings"
 
 	"github.com/LiterallyEthical/r3conwhal3/internal/mods"
 	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
@@ -21,11 +19,19 @@ import (
 )
 
 var (
-	cmds     = []string{"subfinder", "assetfinder", "amass", "httpx", "massdns", "puredns", "gotator", "gowitness", "ffuf", "subzy"}
+	cmds     = []string{"subfinder", "assetfinder", "amass", "gowitness", "ffuf"}
 	myLogger = logger.GetLogger()
 	//go:embed docs/*
-	docFS          embed.FS
-	specifiedFiles []string
+	docFS embed.FS
+)
+
+// Names of the built-in modules selected by the run flags
+const (
+	modPassive  = "passive"
+	modActive   = "active"
+	modFilter   = "filter"
+	modWebOps   = "webops"
+	modVulnScan = "vulnscan"
 )
 
 func main() {
@@ -36,23 +42,34 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Print the banner
-	fmt.Println(color.CyanString(string(data)))
-
 	// Define subcommands
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: r3conwhal3 [run] [galery] options")
+		fmt.Println(color.CyanString(string(data)))
+		fmt.Println("Usage: r3conwhal3 [run] [resume] [monitor] [query] [diff] [galery] options")
 		os.Exit(1)
 	}
 
+	// Print the banner, query and diff output is kept clean for piping
+	if os.Args[1] != "query" && os.Args[1] != "diff" {
+		fmt.Println(color.CyanString(string(data)))
+	}
+
 	// Switch on the subcommand
 	switch os.Args[1] {
 	case "galery":
 		handleGalery(os.Args[2:])
 	case "run":
 		handleRun(os.Args[2:])
+	case "resume":
+		handleResume(os.Args[2:])
+	case "query":
+		handleQuery(os.Args[2:])
+	case "diff":
+		handleDiff(os.Args[2:])
+	case "monitor":
+		handleMonitor(os.Args[2:])
 	default:
-		fmt.Println("expected 'galery' or 'run' subcommands")
+		fmt.Println("expected 'galery', 'run', 'resume', 'monitor', 'query' or 'diff' subcommands")
 		os.Exit(1)
 	}
 }
@@ -78,250 +95,288 @@ func handleGalery(args []string) {
 	// Init r3conwhal3 web galery
 	myLogger.Info("Starting web server for gallery...")
 	if err := web.StartServer(screenshotPath); err != nil {
-		myLogger.Error("Web server error:", err)
+		myLogger.Error("Web server error: %v", err)
+	}
+}
+
+// runOptions holds the flags shared by the run and monitor subcommands
+type runOptions struct {
+	domain, domainList, outDir, configDir, scopeFile                                 string
+	enableAllMods, enablePassiveEnum, enableActiveEnum, enableWebOps, enableVulnScan bool
+	keepTemp, verbose, quiet                                                         bool
+	extraMods                                                                        []string
+	concurrency                                                                      int
+}
+
+func addRunFlags(fs *pflag.FlagSet, o *runOptions) {
+	fs.StringVarP(&o.domain, "domain", "d", "", "Target domain to enumerate")
+	fs.StringVarP(&o.domainList, "list", "l", "", "File with one target domain per line, - reads from stdin")
+	fs.IntVarP(&o.concurrency, "concurrency", "t", 1, "Number of targets scanned at once")
+	fs.StringVarP(&o.configDir, "config-dir", "c", "embedded", "Path to directory which config.env exists")
+	fs.StringVarP(&o.outDir, "out-dir", "o", "$HOME/user/r3conwhal3/results", "Directory to keep all output")
+	fs.StringVarP(&o.scopeFile, "scope", "s", "", "Scope file with the include/exclude rules applied to every host")
+	fs.BoolVarP(&o.enablePassiveEnum, "passive", "p", false, "Perform passive subdomain enumeration process")
+	fs.BoolVarP(&o.enableActiveEnum, "active", "a", false, "Perform active recon process (DNS brute-force & DNS permutation)")
+	fs.BoolVarP(&o.enableAllMods, "all", "A", true, "Perform all passive & active recon process")
+	fs.BoolVarP(&o.enableWebOps, "webops", "w", false, "Perform web operations such as web screenshotting, directory fuzzing etc.")
+	fs.BoolVarP(&o.enableVulnScan, "vulnscan", "v", false, "Perform vulnerability scanning")
+	fs.StringSliceVarP(&o.extraMods, "modules", "m", nil, fmt.Sprintf("Additional modules to run %v", mods.Modules()))
+	fs.BoolVar(&o.keepTemp, "keep-temp", false, "Keep the temporary directory of the run for debugging")
+	// -v is taken by --vulnscan, so verbose has no shorthand
+	fs.BoolVar(&o.verbose, "verbose", false, "Show debug messages")
+	fs.BoolVarP(&o.quiet, "quiet", "q", false, "Show only warnings and errors")
+}
+
+// modules selects the modules to run, every registered module runs when no flags are provided (default behavior)
+func (o *runOptions) modules() []string {
+	if !o.enablePassiveEnum && !o.enableActiveEnum && !o.enableWebOps && !o.enableVulnScan && len(o.extraMods) == 0 {
+		return mods.Modules()
+	}
+
+	var modules []string
+	if o.enablePassiveEnum || (!o.enableActiveEnum && !o.enablePassiveEnum) {
+		modules = append(modules, modPassive)
+	}
+	if o.enableActiveEnum || (!o.enableActiveEnum && !o.enablePassiveEnum) {
+		modules = append(modules, modActive)
+	}
+	modules = append(modules, modFilter)
+	if o.enableWebOps || (!o.enableWebOps && !o.enableActiveEnum && !o.enablePassiveEnum) {
+		modules = append(modules, modWebOps)
+	}
+	if o.enableVulnScan || (!o.enableVulnScan && !o.enableWebOps && !o.enableActiveEnum && !o.enablePassiveEnum) {
+		modules = append(modules, modVulnScan)
+	}
+
+	return append(modules, o.extraMods...)
+}
+
+// loadConfig loads the config and the scope, flags not set on the command line take their value from the config
+func (o *runOptions) loadConfig(fs *pflag.FlagSet, ws *utils.Workspace) (utils.Config, *utils.Scope, error) {
+	config, err := utils.LoadConfig(o.configDir, ws.Dir, docFS)
+	if err != nil {
+		return config, nil, fmt.Errorf("cannot load config: %v", err)
+	}
+	setupLogging(config, o.verbose, o.quiet)
+
+	// Set the flag value from the config if not explicitly set via command line
+	if !fs.Lookup("out-dir").Changed {
+		// Get the value from config, if flag is not set
+		o.outDir = viper.GetString("OUT_DIR")
+	}
+	if !fs.Lookup("concurrency").Changed {
+		o.concurrency = config.TargetConcurrency
 	}
+	if !fs.Lookup("scope").Changed {
+		o.scopeFile = config.ScopeFile
+	}
+
+	// Binding variables from config.env to flags
+	viper.BindPFlag("OUT_DIR", fs.Lookup("out-dir"))
+
+	scope, err := utils.LoadScope(o.scopeFile)
+	if err != nil {
+		return config, nil, fmt.Errorf("cannot load scope file: %v", err)
+	}
+
+	return config, scope, nil
+}
+
+// newTargets creates a directory and a checkpoint file for every domain
+func (o *runOptions) newTargets(domains, modules []string) ([]*target, error) {
+	var targets []*target
+	for _, d := range domains {
+		outDirPath, err := utils.CreateDir(o.outDir, d)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create directory: %v, %v", o.outDir, err)
+		}
+		state, err := utils.NewRunState(outDirPath, d, o.configDir, o.scopeFile, modules)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create state file in %v: %v", outDirPath, err)
+		}
+
+		targets = append(targets, &target{domain: d, outDirPath: state.Dir(), state: state})
+	}
+
+	return targets, nil
 }
 
 func handleRun(args []string) {
 	// Define flags
-	var domain, outDir, configDir string
-	var enableAllMods, enablePassiveEnum, enableActiveEnum, enableWebOps, enableVulnScan bool
-
+	var opts runOptions
 	runCmd := pflag.NewFlagSet("run", pflag.ExitOnError)
-	runCmd.StringVarP(&domain, "domain", "d", "", "Target domain to enumerate")
-	runCmd.StringVarP(&configDir, "config-dir", "c", "embedded", "Path to directory which config.env exists")
-	runCmd.StringVarP(&outDir, "out-dir", "o", "$HOME/user/r3conwhal3/results", "Directory to keep all output")
-	runCmd.BoolVarP(&enablePassiveEnum, "passive", "p", false, "Perform passive subdomain enumeration process")
-	runCmd.BoolVarP(&enableActiveEnum, "active", "a", false, "Perform active recon process (DNS brute-force & DNS permutation)")
-	runCmd.BoolVarP(&enableAllMods, "all", "A", true, "Perform all passive & active recon process")
-	runCmd.BoolVarP(&enableWebOps, "webops", "w", false, "Perform web operations such as web screenshotting, directory fuzzing etc.")
-	runCmd.BoolVarP(&enableVulnScan, "vulnscan", "v", false, "Perform vulnerability scanning")
+	addRunFlags(runCmd, &opts)
 	runCmd.Parse(args)
 
 	// Check if the domain is provided or not
-	if domain == "" {
-		fmt.Println("Usage: r3conwhal3 run -d <domain> [-c <path-to-config-dir>] [-outDir <path-to-out-dir>]")
+	if opts.domain == "" && opts.domainList == "" {
+		fmt.Println("Usage: r3conwhal3 run -d <domain> | -l <domain-list> [-c <path-to-config-dir>] [-outDir <path-to-out-dir>]")
 		runCmd.PrintDefaults()
 		return
 	}
 
-	config, err := utils.LoadConfig(configDir, docFS)
+	domains, err := readTargets(opts.domain, opts.domainList)
 	if err != nil {
-		log.Fatal("cannot load config:", err)
+		log.Fatalf("cannot read target list %v: %v", opts.domainList, err)
 	}
-
-	// Set the flag value from the config if not explicitly set via command line
-	if !runCmd.Lookup("out-dir").Changed {
-		// Get the value from config, if flag is not set
-		outDir = viper.GetString("OUT_DIR")
+	if len(domains) == 0 {
+		log.Fatal("no target domain provided")
 	}
 
-	// Binding variables from config.env to flags
-	viper.BindPFlag("OUT_DIR", runCmd.Lookup("out-dir"))
+	// Resolve the run order before creating anything
+	modules := opts.modules()
+	if _, err := mods.Pipeline(modules); err != nil {
+		log.Fatal(err)
+	}
 
 	// Check for installation of the required tools
 	if err := utils.CheckInstallations(cmds); err != nil {
 		log.Fatal(err)
 	}
 
-	// Create directory to keep all output
-	outDirPath, err := utils.CreateDir(outDir, domain)
+	if _, err := opts.scan(runCmd, domains, modules, true); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// scan runs the modules against every domain in a new workspace, removed before
+// it returns, and summarizes the results across the targets. With galery the web
+// galery serves the screenshots of a single target once it finishes.
+func (o *runOptions) scan(fs *pflag.FlagSet, domains, modules []string, galery bool) ([]targetResult, error) {
+	ws, err := utils.NewWorkspace(o.keepTemp)
 	if err != nil {
-		log.Fatalf("Failed to create directory: %v, %v", outDir, err)
-	}
-
-	// Set filename and filepath for configs
-	activeFileName := "active_enum_subdomains.txt"
-	//activeFilePath := path.Join(outDirPath, activeFileName)
-	passiveFileName := "passive_enum_subdomains.txt"
-	passiveFilePath := path.Join(outDirPath, passiveFileName)
-	specifiedFiles = append(specifiedFiles, passiveFileName, activeFileName)
-	sublist := path.Join(outDirPath, "all_subdomains.txt")
-
-	// Set configs for PASSIVE_ENUM
-	passiveEnumCFG := mods.PassiveEnum{
-		Domain:            domain,
-		FilePath:          passiveFilePath,
-		OutDirPath:        outDirPath,
-		EnableAssetfinder: config.EnableAssetfinder,
-		EnableAmass:       config.EnableAmass,
-		EnableSubkill3r:   config.EnableSubkill3r,
-		Subfinder: mods.Subfinder{
-			NumOfThreads: config.SubfinderNumOfThreads,
-		},
-		Amass: mods.Amass{
-			Timeout: config.AmassTimeout,
-		},
-		Subkill3r: mods.Subkill3r{
-			Wordlist:    config.Subkill3rWordlist,
-			ServerAddr:  config.Subkill3rServerAddr,
-			WorkerCount: config.Subkill3rWorkerCount,
-		},
-	}
-
-	// Set configs for ACTIVE_ENUM
-	activeEnumCFG := mods.ActiveEnum{
-		PureDNS: mods.PureDNS{
-			Domain:       domain,
-			Wordlist:     config.PurednsWordlist,
-			Resolvers:    config.PurednsResolvers,
-			NumOfThreads: config.PurednsNumOfThreads,
-		},
-		Gotator: mods.Gotator{
-			Sublist:      sublist,
-			Permlist:     config.GotatorPermlist,
-			Depth:        config.GotatorDepth,
-			Numbers:      config.GotatorNumbers,
-			NumOfThreads: config.GotatorNumOfThreads,
-			Mindup:       config.GotatorMindup,
-			Adv:          config.GotatorAdv,
-			Md:           config.GotatorMd,
-		},
-		OutDirPath:     outDirPath,
-		SpecifiedFiles: specifiedFiles,
-	}
-
-	// Set configs for WEB_OPS
-	webopsCFG := mods.WebOps{
-		OutDirPath:      outDirPath,
-		EnableGowitness: config.EnableGowitness,
-		EnableFFUF:      config.EnableFFUF,
-		EnableWebGalery: config.EnableWebGalery,
-		Gowitness: mods.Gowitness{
-			Timeout:               config.GowitnessTimeout,
-			ResolutionX:           config.GowitnessResolutionX,
-			ResolutionY:           config.GowitnessResolutionY,
-			NumOfThreads:          config.GowitnessNumOfThreads,
-			Fullpage:              config.GowitnessFullpage,
-			ScreenshotFilter:      config.GowitnessScreenshotFilter,
-			ScreenshotFilterCodes: config.GowitnessScreenshotFilterCodes,
-		},
-		FFUF: mods.FFUF{
-			NumOfThreads:       config.FFUFNumOfThreads,
-			Maxtime:            config.FFUFMaxtime,
-			Rate:               config.FFUFRate,
-			Timeout:            config.FFUFTimeout,
-			Wordlist:           config.FFUFWordlist,
-			MatchHTTPCode:      config.FFUFMatchHTTPCode,
-			FilterResponseSize: config.FFUFFilterResponseSize,
-			OutputFormat:       config.FFUFOutputFormat,
-			Output:             config.FFUFOutput,
-			SF:                 config.FFUFSF,
-			SE:                 config.FFUFSE,
-		},
-	}
-
-	// Set configs for VULN_SCAN
-	vulnScanCFG := mods.VulnScan{
-		OutdirPath:  outDirPath,
-		EnableSubzy: config.EnableSubzy,
-		Subzy: mods.Subzy{
-			Concurrency: config.SUBZYConcurrency,
-			Timeout:     config.SUBZYTimeout,
-			HideFails:   config.SUBZYHideFails,
-			HTTPS:       config.SUBZYHTTPS,
-			VerifySSL:   config.SUBZYVerifySSL,
-			Vuln:        config.SUBZYVuln,
-		},
-	}
-
-	// Channel to signal cleanup
-	cleanupChan := make(chan struct{})
-
-	// Channel to handle OS signals
-	signalChan := make(chan os.Signal, 1)
-
-	// Register for interrupt (CTRL+C) and termination signals
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Defer statement to ensure cleanup is called
-	defer func() {
-		myLogger.Info("Cleanup process is running...")
-		utils.CleanUp()
-		myLogger.Info("Cleanup complete, exiting...")
-	}()
-
-	// Ensure the cleanup channel is only closed once
-	var once sync.Once
-	closeCleanupChan := func() {
-		once.Do(func() {
-			close(cleanupChan)
-		})
-	}
-
-	// Run the app
-	go func() {
-		if err := runApplication(enablePassiveEnum, enableActiveEnum, enableWebOps, enableVulnScan, passiveEnumCFG, activeEnumCFG, webopsCFG, vulnScanCFG, outDirPath, cleanupChan, closeCleanupChan); err != nil {
-			myLogger.Error("Error while running r3conwhal3: %v", err)
-			// Signal to cleanup
-			closeCleanupChan()
-		}
-	}()
+		return nil, err
+	}
+	defer cleanUp(ws)
 
-	select {
-	case <-signalChan:
-		fmt.Println()
-		myLogger.Warning("Received interrupt signal, initiating cleanup...")
-		closeCleanupChan()
-	case <-cleanupChan:
-		fmt.Println()
-		myLogger.Warning("Received cleanup signal, initiating cleanup...")
+	config, scope, err := o.loadConfig(fs, ws)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func runApplication(enablePassiveEnum, enableActiveEnum, enableWebOps, enableVulnScan bool, passiveEnumCFG mods.PassiveEnum, activeEnumCFG mods.ActiveEnum, webopsCFG mods.WebOps, vulnScanCFG mods.VulnScan, outDirPath string, cleanupChan chan struct{}, closeCleanupChan func()) error {
-	defer closeCleanupChan()
+	targets, err := o.newTargets(domains, modules)
+	if err != nil {
+		return nil, err
+	}
 
-	// Run passive enumeration if enabled or no flags are provided (default behavior)
-	if enablePassiveEnum || (!enableActiveEnum && !enablePassiveEnum) {
-		if err := mods.InitSubdEnum(passiveEnumCFG); err != nil {
-			log.Fatal(err)
+	// The web galery only serves the screenshots of a single target
+	serveGalery := galery && len(targets) == 1 && o.enableWebOps && config.EnableGowitness && config.EnableWebGalery
+	results := runTargets(targets, ws, config, scope, o.concurrency, serveGalery)
+
+	// Summarize the results across all roots
+	if len(targets) > 1 {
+		summaryPath, err := writeSummary(o.outDir, results)
+		if err != nil {
+			myLogger.Error("Failed to write summary: %v", err)
+		} else {
+			myLogger.Info("Summary written to %s", summaryPath)
 		}
 	}
 
-	// Run active enumeration if enabled or no flags are provided (default behavior)
-	if enableActiveEnum || (!enableActiveEnum && !enablePassiveEnum) {
-		if err := mods.InitActiveSubdEnum(activeEnumCFG); err != nil {
-			myLogger.Error("Error in InitActiveSubdEnum:", err)
-			return err
-		}
+	return results, nil
+}
+
+func handleResume(args []string) {
+	var runDir string
+	var keepTemp, verbose, quiet bool
+
+	resumeCmd := pflag.NewFlagSet("resume", pflag.ExitOnError)
+	resumeCmd.StringVarP(&runDir, "out-dir", "o", "", "Run directory of the scan to resume")
+	resumeCmd.BoolVar(&keepTemp, "keep-temp", false, "Keep the temporary directory of the run for debugging")
+	resumeCmd.BoolVar(&verbose, "verbose", false, "Show debug messages")
+	resumeCmd.BoolVarP(&quiet, "quiet", "q", false, "Show only warnings and errors")
+	resumeCmd.Parse(args)
+
+	// Check if the run directory is provided or not
+	if runDir == "" {
+		fmt.Println("Usage: r3conwhal3 resume -o <path-to-run-dir>")
+		resumeCmd.PrintDefaults()
+		return
+	}
+	state, err := utils.LoadRunState(runDir)
+	if err != nil {
+		log.Fatalf("cannot resume %v: %v", runDir, err)
+	}
+
+	// Check for installation of the required tools
+	if err := utils.CheckInstallations(cmds); err != nil {
+		log.Fatal(err)
+	}
+
+	scope, err := utils.LoadScope(state.ScopeFile)
+	if err != nil {
+		log.Fatalf("cannot load scope file: %v", err)
 	}
 
-	if err := mods.InitFilterLiveDomains(outDirPath); err != nil {
-		myLogger.Error("Error in InitFilterLiveDomains:", err)
+	if err := resume(state.Dir(), state, scope, keepTemp, verbose, quiet); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// resume runs the modules of the scan in runDir again in a new workspace, removed before it returns
+func resume(runDir string, state *utils.RunState, scope *utils.Scope, keepTemp, verbose, quiet bool) error {
+	ws, err := utils.NewWorkspace(keepTemp)
+	if err != nil {
 		return err
 	}
+	defer cleanUp(ws)
 
-	if enableWebOps || (!enableWebOps && !enableActiveEnum && !enablePassiveEnum) {
-		if err := mods.InitWebOps(webopsCFG); err != nil {
-			myLogger.Error("Error in InitWebOps:", err)
-			return err
-		}
+	config, err := utils.LoadConfig(state.ConfigDir, ws.Dir, docFS)
+	if err != nil {
+		return fmt.Errorf("cannot load config: %v", err)
 	}
+	setupLogging(config, verbose, quiet)
 
-	if enableVulnScan || (!enableVulnScan && !enableWebOps && !enableActiveEnum && !enablePassiveEnum) {
-		if err := mods.InitVulnScan(vulnScanCFG); err != nil {
-			myLogger.Error("Error in InitVulnScan:", err)
-			return err
-		}
+	myLogger.Info("Resuming scan of %s in %s", state.Domain, runDir)
+	runTargets([]*target{{domain: state.Domain, outDirPath: runDir, state: state}}, ws, config, scope, 1, false)
+
+	return nil
+}
+
+// setupLogging applies LOG_LEVEL and LOG_FORMAT, --verbose and --quiet take precedence over LOG_LEVEL
+func setupLogging(config utils.Config, verbose, quiet bool) {
+	level, err := logger.ParseLevel(config.LogLevel)
+	if err != nil {
+		myLogger.Warning("%v, look for LOG_LEVEL in config file", err)
+	}
+	switch {
+	case verbose:
+		level = logger.LevelDebug
+	case quiet:
+		level = logger.LevelWarning
+	}
+
+	logger.SetLevel(level)
+	logger.SetJSON(strings.EqualFold(config.LogFormat, "json"))
+}
+
+func runApplication(ctx context.Context, env *mods.Env, state *utils.RunState, serveGalery bool) error {
+	modules, err := mods.Pipeline(state.Modules)
+	if err != nil {
+		return err
+	}
+
+	if err := mods.RunPipeline(ctx, env, modules, state); err != nil {
+		return err
 	}
 
-	if enableWebOps && webopsCFG.EnableGowitness && webopsCFG.EnableWebGalery {
+	if serveGalery {
+		serverErr := make(chan error, 1)
 		go func() {
-			if err := mods.RunWebServer(outDirPath); err != nil {
-				myLogger.Error("Web server error:", err)
-				closeCleanupChan()
-			}
+			serverErr <- mods.RunWebServer(env.OutDirPath)
 		}()
-		// Wait for the cleanup signal if the web server is running
+		// Keep serving until interrupted or the web server fails
 		select {
-		case <-cleanupChan:
+		case <-ctx.Done():
 			fmt.Println()
-			myLogger.Warning("Cleanup signal received, stopping application tasks...")
+			env.Log.Warning("Cleanup signal received, stopping application tasks...")
 			return nil
+		case err := <-serverErr:
+			env.Log.Error("Web server error: %v", err)
+			return err
 		}
-	} else {
-		// If web server is not running, return immediately after webopsCFG
-		return nil
 	}
+
+	// If web server is not running, return immediately after the last module
+	return nil
 }
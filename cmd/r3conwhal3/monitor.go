@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/mods"
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/spf13/pflag"
+)
+
+func handleMonitor(args []string) {
+	// Define flags, the run flags apply to every scheduled scan
+	var opts runOptions
+	var schedule string
+	var runNow bool
+
+	monitorCmd := pflag.NewFlagSet("monitor", pflag.ExitOnError)
+	addRunFlags(monitorCmd, &opts)
+	monitorCmd.StringVarP(&schedule, "schedule", "S", "@daily", "Cron expression, @hourly, @daily, @weekly, @monthly or @every <duration>")
+	monitorCmd.BoolVar(&runNow, "now", false, "Run the first scan immediately instead of waiting for the schedule")
+	monitorCmd.Parse(args)
+
+	// Check if the domain is provided or not
+	if opts.domain == "" && opts.domainList == "" {
+		fmt.Println("Usage: r3conwhal3 monitor -d <domain> | -l <domain-list> [-S <schedule>] [-c <path-to-config-dir>] [-outDir <path-to-out-dir>]")
+		monitorCmd.PrintDefaults()
+		return
+	}
+
+	domains, err := readTargets(opts.domain, opts.domainList)
+	if err != nil {
+		log.Fatalf("cannot read target list %v: %v", opts.domainList, err)
+	}
+	if len(domains) == 0 {
+		log.Fatal("no target domain provided")
+	}
+
+	// Resolve the run order and the schedule before waiting for the first scan
+	modules := opts.modules()
+	if _, err := mods.Pipeline(modules); err != nil {
+		log.Fatal(err)
+	}
+
+	sched, err := utils.ParseSchedule(schedule)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Check for installation of the required tools
+	if err := utils.CheckInstallations(cmds); err != nil {
+		log.Fatal(err)
+	}
+
+	// Stop between scans on interrupt, a running scan handles the signal itself
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signalChan)
+
+	myLogger.Info("Monitoring %v targets on schedule %s", len(domains), schedule)
+	next := time.Now()
+	if !runNow {
+		next = sched.Next(next)
+	}
+
+	for {
+		if next.IsZero() {
+			myLogger.Warning("Schedule %s never fires again, stopping monitor", schedule)
+			return
+		}
+		myLogger.Info("Next scan at %s", next.Format(time.RFC1123))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-signalChan:
+			timer.Stop()
+			myLogger.Warning("Received interrupt signal, stopping monitor...")
+			return
+		case <-timer.C:
+		}
+
+		monitorScan(monitorCmd, &opts, domains, modules)
+
+		// Scans never overlap, slots missed while a scan was running are skipped
+		previous := next
+		next = sched.Next(time.Now())
+		if missed := countMissed(sched, previous, next); missed > 0 {
+			myLogger.Warning("Scan took longer than the schedule, %v scheduled scans skipped", missed)
+		}
+	}
+}
+
+// monitorScan runs a scheduled scan of every target in a new run directory and
+// raises an alert for every target that changed since its previous run
+func monitorScan(fs *pflag.FlagSet, opts *runOptions, domains, modules []string) {
+	// Every scan gets a new workspace and reloads the config, edits are picked up
+	// and the embedded files cleaned up after the last scan are extracted again
+	startedAt := time.Now()
+	results, err := opts.scan(fs, domains, modules, false)
+	if err != nil {
+		myLogger.Error("Skipping scheduled scan: %v", err)
+		return
+	}
+
+	for _, r := range results {
+		if r.changes != nil && r.changes.Changed() {
+			myLogger.Warning("ALERT: %s changed since the previous scan, see %s", r.Domain, r.RunDir)
+		}
+	}
+
+	if err := appendHistory(opts.outDir, startedAt, results); err != nil {
+		myLogger.Warning("Failed to record monitor history: %v", err)
+	}
+}
+
+// appendHistory records a scheduled scan as a line of monitor_history.jsonl in outDir
+func appendHistory(outDir string, startedAt time.Time, results []targetResult) error {
+	type historyTarget struct {
+		Domain  string `json:"domain"`
+		RunDir  string `json:"run_dir"`
+		Status  string `json:"status"`
+		Changed bool   `json:"changed"`
+	}
+	entry := struct {
+		StartedAt  time.Time       `json:"started_at"`
+		FinishedAt time.Time       `json:"finished_at"`
+		Targets    []historyTarget `json:"targets"`
+	}{StartedAt: startedAt, FinishedAt: time.Now()}
+
+	for _, r := range results {
+		entry.Targets = append(entry.Targets, historyTarget{
+			Domain:  r.Domain,
+			RunDir:  r.RunDir,
+			Status:  r.Status,
+			Changed: r.changes != nil && r.changes.Changed(),
+		})
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return utils.AppendToFile(filepath.Join(outDir, "monitor_history.jsonl"), append(data, '\n'))
+}
+
+// countMissed returns how many times the schedule fired strictly between from and to
+func countMissed(sched *utils.Schedule, from, to time.Time) int {
+	missed := 0
+	for t := sched.Next(from); !t.IsZero() && t.Before(to); t = sched.Next(t) {
+		missed++
+	}
+	return missed
+}
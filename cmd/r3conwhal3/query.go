@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/store"
+	"github.com/spf13/pflag"
+)
+
+func handleQuery(args []string) {
+	var runDir, name, query string
+	var list, asJSON bool
+
+	queryCmd := pflag.NewFlagSet("query", pflag.ExitOnError)
+	queryCmd.StringVarP(&runDir, "out-dir", "o", "", "Run directory holding the results database")
+	queryCmd.StringVarP(&name, "name", "n", "", "Name of a canned query to run")
+	queryCmd.StringVarP(&query, "sql", "s", "", "Custom SQL query to run")
+	queryCmd.BoolVarP(&list, "list", "l", false, "List the canned queries")
+	queryCmd.BoolVarP(&asJSON, "json", "j", false, "Print the rows as JSON")
+	queryCmd.Parse(args)
+
+	if list {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, n := range store.CannedQueryNames() {
+			fmt.Fprintf(w, "%s\t%s\n", n, store.CannedQueries[n].Description)
+		}
+		w.Flush()
+		return
+	}
+
+	// Check if the run directory and a query are provided or not
+	if runDir == "" || (name == "" && query == "") {
+		fmt.Println("Usage: r3conwhal3 query -o <path-to-run-dir> -n <canned-query> | -s <sql>")
+		queryCmd.PrintDefaults()
+		return
+	}
+
+	if name != "" {
+		canned, ok := store.CannedQueries[name]
+		if !ok {
+			log.Fatalf("unknown query %s, expected one of %s", name, strings.Join(store.CannedQueryNames(), ", "))
+		}
+		query = canned.SQL
+	}
+
+	if _, err := os.Stat(runDir); err != nil {
+		log.Fatalf("cannot open results of %v: %v", runDir, err)
+	}
+	st, err := store.OpenReadOnly(runDir)
+	if err != nil {
+		log.Fatalf("cannot open results of %v: %v", runDir, err)
+	}
+	defer st.Close()
+
+	columns, rows, err := st.Query(query)
+	if err != nil {
+		log.Fatalf("query failed: %v", err)
+	}
+
+	if asJSON {
+		out := make([]map[string]string, 0, len(rows))
+		for _, row := range rows {
+			record := make(map[string]string, len(columns))
+			for i, column := range columns {
+				record[column] = row[i]
+			}
+			out = append(out, record)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(out); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
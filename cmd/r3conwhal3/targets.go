@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/diff"
+	"github.com/LiterallyEthical/r3conwhal3/internal/mods"
+	"github.com/LiterallyEthical/r3conwhal3/internal/notify"
+	"github.com/LiterallyEthical/r3conwhal3/internal/store"
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+)
+
+// runLogFileName is the log of a target, kept in its run directory
+const runLogFileName = "run.log"
+
+// finishNotifyTimeout bounds the notifications sent once a target stopped
+const finishNotifyTimeout = 15 * time.Second
+
+// exitGrace is how long the targets get to stop after a second interrupt
+const exitGrace = 5 * time.Second
+
+// target is a root domain scanned into its own run directory
+type target struct {
+	domain     string
+	outDirPath string
+	state      *utils.RunState
+}
+
+// targetResult is the outcome of a target, as written to the combined summary
+type targetResult struct {
+	Domain     string `json:"domain"`
+	RunDir     string `json:"run_dir"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	Subdomains int    `json:"subdomains"`
+	LiveHosts  int    `json:"live_hosts"`
+	Elapsed    string `json:"elapsed"`
+
+	// changes since the previous run of the domain, nil if there is none
+	changes *diff.Report
+}
+
+// readTargets returns the root domains given with -d and the ones listed in list, "-" reads the list from stdin
+func readTargets(domain, list string) ([]string, error) {
+	var domains []string
+	seen := make(map[string]bool)
+	add := func(d string) {
+		d = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+		if d == "" || strings.HasPrefix(d, "#") || seen[d] {
+			return
+		}
+		seen[d] = true
+		domains = append(domains, d)
+	}
+
+	add(domain)
+
+	if list != "" {
+		var r io.Reader = os.Stdin
+		if list != "-" {
+			file, err := os.Open(list)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			r = file
+		}
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			add(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return domains, nil
+}
+
+// runTargets runs the pipeline for every target, concurrency targets at a time,
+// until all of them finish or the user interrupts
+func runTargets(targets []*target, ws *utils.Workspace, config utils.Config, scope *utils.Scope, concurrency int, serveGalery bool) []targetResult {
+	// Targets still running after a second interrupt are reported as interrupted
+	results := make([]targetResult, len(targets))
+	for i, t := range targets {
+		results[i] = targetResult{Domain: t.domain, RunDir: t.outDirPath, Status: "interrupted"}
+	}
+	var mu sync.Mutex
+
+	// Context cancelled on interrupt, passed down to every module
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Channel to handle OS signals
+	signalChan := make(chan os.Signal, 1)
+
+	// Register for interrupt (CTRL+C) and termination signals
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signalChan)
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// A broken notifier config must not cost a scan, the targets run without notifications
+	notifier, err := notify.New(config)
+	if err != nil {
+		myLogger.Error("Notifications disabled: %v", err)
+	}
+
+	// Run the app
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, concurrency)
+		for i, t := range targets {
+			wg.Add(1)
+			go func(i int, t *target) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				result := runTarget(ctx, t, ws, config, scope, notifier, serveGalery)
+				mu.Lock()
+				results[i] = result
+				mu.Unlock()
+			}(i, t)
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-signalChan:
+		fmt.Println()
+		myLogger.Warning("Received interrupt signal, stopping running tasks...")
+		cancel()
+	case <-done:
+		return results
+	}
+
+	// Wait for the modules to drain and flush their results, a second interrupt exits shortly after
+	select {
+	case <-done:
+		myLogger.Warning("Running tasks stopped, initiating cleanup...")
+		return results
+	case <-signalChan:
+		myLogger.Warning("Received second interrupt signal, exiting without waiting...")
+	}
+
+	// Targets still running write to the workspace, it is left on disk for them
+	select {
+	case <-done:
+	case <-time.After(exitGrace):
+		myLogger.Warning("Targets still running, keeping temporary files in %s", ws.Dir)
+		ws.Keep()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]targetResult(nil), results...)
+}
+
+// cleanUp removes the workspace of a run once its targets stopped
+func cleanUp(ws *utils.Workspace) {
+	myLogger.Info("Cleanup process is running...")
+	ws.CleanUp()
+	myLogger.Info("Cleanup complete, exiting...")
+}
+
+// runTarget runs the modules recorded in the state of t and reports the outcome
+func runTarget(ctx context.Context, t *target, ws *utils.Workspace, config utils.Config, scope *utils.Scope, notifier *notify.Notifier, serveGalery bool) targetResult {
+	result := targetResult{Domain: t.domain, RunDir: t.outDirPath, Status: "done"}
+	startTime := time.Now()
+
+	// A target that never started is reported as skipped
+	if ctx.Err() != nil {
+		result.Status = "skipped"
+		return result
+	}
+
+	// The lines of the target carry its name, run.log only takes those
+	log := logger.With(myLogger, logger.Fields{"target": t.domain})
+	ctx = logger.NewContext(ctx, log)
+
+	// Keep the log of the target with its results
+	runLog, err := logger.AddFile(filepath.Join(t.outDirPath, runLogFileName), t.domain)
+	if err != nil {
+		log.Warning("Failed to open %s of %s: %v", runLogFileName, t.domain, err)
+	} else {
+		defer runLog.Close()
+	}
+
+	// The results database mirrors the output files, the scan runs without it if it cannot be opened
+	st, err := store.Open(t.outDirPath)
+	if err != nil {
+		log.Warning("Failed to open results database of %s: %v", t.domain, err)
+		st = nil
+	} else {
+		defer st.Close()
+	}
+
+	env := &mods.Env{
+		Domain:     t.domain,
+		OutDirPath: t.outDirPath,
+		Workspace:  ws.Dir,
+		TempDir:    ws.Path(filepath.Base(t.outDirPath)),
+		Config:     config,
+		Scope:      scope,
+		Store:      st,
+		Notifier:   notifier,
+		Log:        log,
+	}
+
+	log.Info("Starting scan of %s in %s", t.domain, t.outDirPath)
+	notifier.Notify(ctx, notify.Event{
+		Type:    notify.RunStart,
+		Domain:  t.domain,
+		RunDir:  t.outDirPath,
+		Message: fmt.Sprintf("scan started with modules %s", strings.Join(t.state.Modules, ", ")),
+	})
+	if err := runApplication(ctx, env, t.state, serveGalery); err != nil {
+		log.Error("Error while running r3conwhal3 against %s: %v", t.domain, err)
+		result.Status = "failed"
+		result.Error = err.Error()
+		if ctx.Err() != nil {
+			result.Status = "interrupted"
+		}
+	}
+
+	result.Subdomains, _ = utils.CountLines(filepath.Join(t.outDirPath, "ultimate_subdomains.txt"))
+	result.LiveHosts, _ = utils.CountLines(filepath.Join(t.outDirPath, "live_subdomains.txt"))
+	result.Elapsed = time.Since(startTime).Round(time.Second).String()
+
+	// The finishing events are sent even when the scan was interrupted
+	notifyCtx, cancelNotify := context.WithTimeout(context.WithoutCancel(ctx), finishNotifyTimeout)
+	defer cancelNotify()
+
+	// Report what changed since the last scan of the domain
+	if ctx.Err() == nil {
+		result.changes = diffWithPreviousRun(log, t.outDirPath)
+	}
+	if result.changes != nil && len(result.changes.NewLive) > 0 {
+		notifier.Notify(notifyCtx, notify.Event{
+			Type:    notify.NewLive,
+			Domain:  t.domain,
+			RunDir:  t.outDirPath,
+			Message: fmt.Sprintf("%v hosts became live since the previous scan", len(result.changes.NewLive)),
+			Hosts:   result.changes.NewLive,
+		})
+	}
+
+	message := fmt.Sprintf("scan %s in %s, %v subdomains and %v live hosts", result.Status, result.Elapsed, result.Subdomains, result.LiveHosts)
+	if result.Error != "" {
+		message += ": " + result.Error
+	}
+	notifier.Notify(notifyCtx, notify.Event{
+		Type:    notify.RunFinish,
+		Domain:  t.domain,
+		RunDir:  t.outDirPath,
+		Message: message,
+	})
+
+	return result
+}
+
+// writeSummary prints the combined results of a multi-target run and writes them to outDir as JSON
+func writeSummary(outDir string, results []targetResult) (string, error) {
+	var subdomains, liveHosts, failed int
+	myLogger.Info("%-30s %-12s %10s %10s %10s", "DOMAIN", "STATUS", "SUBDOMAINS", "LIVE", "ELAPSED")
+	for _, r := range results {
+		myLogger.Info("%-30s %-12s %10v %10v %10s", r.Domain, r.Status, r.Subdomains, r.LiveHosts, r.Elapsed)
+		subdomains += r.Subdomains
+		liveHosts += r.LiveHosts
+		if r.Status != "done" {
+			failed++
+		}
+	}
+	myLogger.Info("%v targets scanned (%v not completed), %v subdomains and %v live hosts in total", len(results), failed, subdomains, liveHosts)
+
+	summary := struct {
+		FinishedAt time.Time      `json:"finished_at"`
+		Subdomains int            `json:"subdomains"`
+		LiveHosts  int            `json:"live_hosts"`
+		Targets    []targetResult `json:"targets"`
+	}{
+		FinishedAt: time.Now(),
+		Subdomains: subdomains,
+		LiveHosts:  liveHosts,
+		Targets:    results,
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(outDir, fmt.Sprintf("summary_%s.json", time.Now().Format("2006-01-02-15:04:05")))
+	return path, os.WriteFile(path, data, 0644)
+}
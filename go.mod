@@ -4,9 +4,11 @@ go 1.21.1
 
 require (
 	github.com/fatih/color v1.16.0
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/miekg/dns v1.1.58
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.18.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -32,5 +34,4 @@ require (
 	golang.org/x/text v0.14.0 // indirect
 	golang.org/x/tools v0.17.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -18,12 +18,8 @@ declare -A tools=(
     ["subfinder"]="github.com/projectdiscovery/subfinder/v2/cmd/subfinder@latest"
     ["assetfinder"]="github.com/tomnomnom/assetfinder@latest"
     ["amass"]="github.com/owasp-amass/amass/v4/...@master"
-    ["httpx"]="github.com/projectdiscovery/httpx/cmd/httpx@latest"
-    ["puredns"]="github.com/d3mondev/puredns/v2@latest"
-    ["gotator"]="github.com/Josue87/gotator@latest"
     ["gowitness"]="github.com/sensepost/gowitness@latest"
     ["ffuf"]="github.com/ffuf/ffuf/v2@latest"
-    ["subzy"]="github.com/LukaSikic/subzy@latest"
   )
 
 # Function to check if a tool is installed
@@ -36,29 +32,8 @@ is_tool_installed() {
     fi
 }
 
-# Function to install massdns
-install_massdns() {
-    if is_tool_installed "massdns"; then
-        return 0
-    fi
-    
-    echo -e "Starting installation of massdns..."
-    if git clone https://github.com/blechschmidt/massdns.git &>/dev/null && \
-       cd massdns && \
-       make &>/dev/null && \
-       sudo make install &>/dev/null; then
-        echo -e "${CYAN}massdns installed successfully.${NO_COLOR}"
-    else
-        echo -e "${RED}Failed to install massdns. Please check dependencies.${NO_COLOR}"
-        return 1
-    fi
-}
-
 # Main installation function that installs all tools
 install_tools() {
-    # Install massdns
-    install_massdns || return 1
-
     # Install required Go tools if not already installed
     for tool in "${!tools[@]}"; do
         if is_tool_installed "$tool"; then
@@ -0,0 +1,251 @@
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/takeover"
+)
+
+// FileName is the diff against the previous run written to a run directory
+const FileName = "diff.json"
+
+// Report lists what changed between two runs of the same domain. A category is
+// null when one of the runs did not produce the files it is built from.
+type Report struct {
+	Domain            string    `json:"domain"`
+	OldRun            string    `json:"old_run"`
+	NewRun            string    `json:"new_run"`
+	GeneratedAt       time.Time `json:"generated_at"`
+	NewSubdomains     []string  `json:"new_subdomains"`
+	RemovedSubdomains []string  `json:"removed_subdomains"`
+	NewLive           []string  `json:"new_live"`
+	Dead              []string  `json:"dead"`
+	NewFuzzHits       []string  `json:"new_fuzz_hits"`
+	NewFindings       []string  `json:"new_findings"`
+	FixedFindings     []string  `json:"fixed_findings"`
+}
+
+// category pairs a section of the report with the way its items are read from a run
+type category struct {
+	load    func(runDir string) (map[string]bool, bool)
+	added   *[]string
+	removed *[]string
+}
+
+// Compare builds the report of what changed from the run in oldDir to the run in newDir
+func Compare(oldDir, newDir string) (*Report, error) {
+	for _, dir := range []string{oldDir, newDir} {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a run directory", dir)
+		}
+	}
+
+	r := &Report{OldRun: oldDir, NewRun: newDir, GeneratedAt: time.Now()}
+	if state, err := utils.LoadRunState(newDir); err == nil {
+		r.Domain = state.Domain
+	}
+
+	categories := []category{
+		{load: listLoader("ultimate_subdomains.txt"), added: &r.NewSubdomains, removed: &r.RemovedSubdomains},
+		{load: listLoader("live_subdomains.txt"), added: &r.NewLive, removed: &r.Dead},
+		{load: loadFuzzHits, added: &r.NewFuzzHits},
+		{load: loadFindings, added: &r.NewFindings, removed: &r.FixedFindings},
+	}
+	for _, c := range categories {
+		before, okBefore := c.load(oldDir)
+		after, okAfter := c.load(newDir)
+		if !okBefore || !okAfter {
+			continue
+		}
+		*c.added = missingFrom(after, before)
+		if c.removed != nil {
+			*c.removed = missingFrom(before, after)
+		}
+	}
+
+	return r, nil
+}
+
+// Changed reports whether anything differs between the runs
+func (r *Report) Changed() bool {
+	return len(r.NewSubdomains)+len(r.RemovedSubdomains)+len(r.NewLive)+len(r.Dead)+
+		len(r.NewFuzzHits)+len(r.NewFindings)+len(r.FixedFindings) > 0
+}
+
+// Write saves the report as JSON to path
+func (r *Report) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// Summary returns the report as console lines, listing at most limit items per section, 0 lists all
+func (r *Report) Summary(limit int) []string {
+	lines := []string{fmt.Sprintf("Changes from %s to %s", filepath.Base(r.OldRun), filepath.Base(r.NewRun))}
+	sections := []struct {
+		title string
+		sign  string
+		items []string
+	}{
+		{"new subdomains", "+", r.NewSubdomains},
+		{"removed subdomains", "-", r.RemovedSubdomains},
+		{"newly live hosts", "+", r.NewLive},
+		{"now dead hosts", "-", r.Dead},
+		{"new ffuf hits", "+", r.NewFuzzHits},
+		{"new takeover findings", "+", r.NewFindings},
+		{"fixed takeover findings", "-", r.FixedFindings},
+	}
+	for _, s := range sections {
+		lines = append(lines, fmt.Sprintf("%v %s", len(s.items), s.title))
+		for i, item := range s.items {
+			if limit > 0 && i == limit {
+				lines = append(lines, fmt.Sprintf("  ... and %v more", len(s.items)-limit))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("  %s %s", s.sign, item))
+		}
+	}
+
+	return lines
+}
+
+// PreviousRun returns the latest run of the same domain started before the run in
+// runDir, looking at the other run directories next to it. It returns "" if there is none.
+func PreviousRun(runDir string) (string, error) {
+	current, err := utils.LoadRunState(runDir)
+	if err != nil {
+		return "", err
+	}
+
+	parent := filepath.Dir(runDir)
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return "", err
+	}
+
+	var previous string
+	var previousStart time.Time
+	for _, entry := range entries {
+		dir := filepath.Join(parent, entry.Name())
+		if !entry.IsDir() || filepath.Clean(dir) == filepath.Clean(runDir) {
+			continue
+		}
+		state, err := utils.LoadRunState(dir)
+		if err != nil || state.Domain != current.Domain || !state.StartedAt.Before(current.StartedAt) {
+			continue
+		}
+		if state.StartedAt.After(previousStart) {
+			previous, previousStart = dir, state.StartedAt
+		}
+	}
+
+	return previous, nil
+}
+
+// listLoader reads a host list of a run, URLs are reduced to their host name
+func listLoader(name string) func(runDir string) (map[string]bool, bool) {
+	return func(runDir string) (map[string]bool, bool) {
+		file, err := os.Open(filepath.Join(runDir, name))
+		if err != nil {
+			return nil, false
+		}
+		defer file.Close()
+
+		items := make(map[string]bool)
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if host := hostOf(scanner.Text()); host != "" {
+				items[host] = true
+			}
+		}
+
+		return items, scanner.Err() == nil
+	}
+}
+
+// loadFuzzHits reads the URLs found by ffuf, keyed with their status code
+func loadFuzzHits(runDir string) (map[string]bool, bool) {
+	files, _ := filepath.Glob(filepath.Join(runDir, "web_ops", "*.json"))
+	if len(files) == 0 {
+		return nil, false
+	}
+
+	items := make(map[string]bool)
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, false
+		}
+
+		var out struct {
+			Results []struct {
+				URL    string `json:"url"`
+				Status int    `json:"status"`
+			} `json:"results"`
+		}
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, false
+		}
+		for _, result := range out.Results {
+			items[fmt.Sprintf("%s [%v]", result.URL, result.Status)] = true
+		}
+	}
+
+	return items, true
+}
+
+// loadFindings reads the subdomain takeover findings, keyed with the service
+func loadFindings(runDir string) (map[string]bool, bool) {
+	data, err := os.ReadFile(filepath.Join(runDir, "vuln_scan", "subdomain_takeover_scan.json"))
+	if err != nil {
+		return nil, false
+	}
+
+	var out []takeover.Finding
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, false
+	}
+
+	items := make(map[string]bool)
+	for _, f := range out {
+		items[fmt.Sprintf("%s [%s]", hostOf(f.Subdomain), f.Service)] = true
+	}
+
+	return items, true
+}
+
+// missingFrom returns the sorted items of a that are not in b
+func missingFrom(a, b map[string]bool) []string {
+	items := []string{}
+	for item := range a {
+		if !b[item] {
+			items = append(items, item)
+		}
+	}
+	sort.Strings(items)
+
+	return items
+}
+
+// hostOf returns the normalized host of a line holding a host name or a URL
+func hostOf(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.Contains(line, "://") {
+		if u, err := url.Parse(line); err == nil {
+			line = u.Hostname()
+		}
+	}
+	return utils.NormalizeHost(line)
+}
@@ -0,0 +1,169 @@
+package diff
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/takeover"
+)
+
+// newRun creates a run directory of domain under base holding files
+func newRun(t *testing.T, base, name, domain string, files map[string]string) string {
+	t.Helper()
+
+	dir := filepath.Join(base, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := utils.NewRunState(dir, domain, "embedded", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func findings(t *testing.T, fs ...takeover.Finding) string {
+	t.Helper()
+	data, err := json.Marshal(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCompare(t *testing.T) {
+	base := t.TempDir()
+	oldRun := newRun(t, base, "old", "ex.test", map[string]string{
+		"ultimate_subdomains.txt": "www.ex.test\nold.ex.test\napi.ex.test\n",
+		"live_subdomains.txt":     "https://www.ex.test\nhttps://old.ex.test\n",
+		"web_ops/www.json":        `{"results": [{"url": "https://www.ex.test/admin", "status": 403}]}`,
+		"vuln_scan/subdomain_takeover_scan.json": findings(t,
+			takeover.Finding{Subdomain: "old.ex.test", Service: "AWS/S3"}),
+	})
+	newRunDir := newRun(t, base, "new", "ex.test", map[string]string{
+		"ultimate_subdomains.txt": "WWW.ex.test.\napi.ex.test\nnew.ex.test\n",
+		"live_subdomains.txt":     "https://www.ex.test\nhttp://api.ex.test:8080\n",
+		"web_ops/www.json":        `{"results": [{"url": "https://www.ex.test/admin", "status": 403}, {"url": "https://www.ex.test/.git", "status": 200}]}`,
+		"vuln_scan/subdomain_takeover_scan.json": findings(t,
+			takeover.Finding{Subdomain: "new.ex.test", Service: "Heroku"}),
+	})
+
+	r, err := Compare(oldRun, newRunDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Report{
+		Domain:            "ex.test",
+		OldRun:            oldRun,
+		NewRun:            newRunDir,
+		GeneratedAt:       r.GeneratedAt,
+		NewSubdomains:     []string{"new.ex.test"},
+		RemovedSubdomains: []string{"old.ex.test"},
+		NewLive:           []string{"api.ex.test"},
+		Dead:              []string{"old.ex.test"},
+		NewFuzzHits:       []string{"https://www.ex.test/.git [200]"},
+		NewFindings:       []string{"new.ex.test [Heroku]"},
+		FixedFindings:     []string{"old.ex.test [AWS/S3]"},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Compare =\n%+v\nwant\n%+v", r, want)
+	}
+	if !r.Changed() {
+		t.Error("Changed() = false")
+	}
+
+	summary := strings.Join(r.Summary(0), "\n")
+	for _, line := range []string{"1 new subdomains", "  + new.ex.test", "  - old.ex.test [AWS/S3]"} {
+		if !strings.Contains(summary, line) {
+			t.Errorf("summary misses %q:\n%s", line, summary)
+		}
+	}
+}
+
+func TestCompareMissingFiles(t *testing.T) {
+	base := t.TempDir()
+	oldRun := newRun(t, base, "old", "ex.test", map[string]string{"ultimate_subdomains.txt": "www.ex.test\n"})
+	newRunDir := newRun(t, base, "new", "ex.test", map[string]string{
+		"ultimate_subdomains.txt": "www.ex.test\n",
+		"live_subdomains.txt":     "https://www.ex.test\n",
+	})
+
+	r, err := Compare(oldRun, newRunDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A category one of the runs has no files for is left null, not empty
+	if r.NewSubdomains == nil || r.NewLive != nil || r.NewFuzzHits != nil || r.NewFindings != nil {
+		t.Errorf("report = %+v", r)
+	}
+	if r.Changed() {
+		t.Error("Changed() = true for identical subdomains")
+	}
+
+	if _, err := Compare(oldRun, filepath.Join(base, "nope")); err == nil {
+		t.Error("Compare with a missing run, want an error")
+	}
+}
+
+func TestSummaryLimit(t *testing.T) {
+	r := &Report{OldRun: "a", NewRun: "b", NewSubdomains: []string{"1.ex.test", "2.ex.test", "3.ex.test"}}
+	summary := strings.Join(r.Summary(2), "\n")
+	if !strings.Contains(summary, "... and 1 more") || strings.Contains(summary, "3.ex.test") {
+		t.Errorf("summary =\n%s", summary)
+	}
+}
+
+func TestPreviousRun(t *testing.T) {
+	base := t.TempDir()
+	first := newRun(t, base, "first", "ex.test", nil)
+	time.Sleep(10 * time.Millisecond)
+	newRun(t, base, "other", "other.test", nil)
+	time.Sleep(10 * time.Millisecond)
+	second := newRun(t, base, "second", "ex.test", nil)
+	time.Sleep(10 * time.Millisecond)
+	third := newRun(t, base, "third", "ex.test", nil)
+	os.MkdirAll(filepath.Join(base, "not-a-run"), 0755)
+
+	tests := map[string]string{first: "", second: first, third: second}
+	for run, want := range tests {
+		got, err := PreviousRun(run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("PreviousRun(%s) = %q, want %q", filepath.Base(run), got, want)
+		}
+	}
+}
+
+func TestHostOf(t *testing.T) {
+	tests := map[string]string{
+		"www.ex.test":                  "www.ex.test",
+		" WWW.Ex.Test. ":               "www.ex.test",
+		"*.ex.test":                    "ex.test",
+		"https://WWW.ex.test:8443/a?b": "www.ex.test",
+		"http://api.ex.test.":          "api.ex.test",
+		"not a host":                   "",
+	}
+	for line, want := range tests {
+		if got := hostOf(line); got != want {
+			t.Errorf("hostOf(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
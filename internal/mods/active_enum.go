@@ -1,223 +1,444 @@
 package mods
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/permute"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/subkill3r"
 	"github.com/fatih/color"
 )
 
+// RecursiveFileName lists the subdomains found by brute-forcing under subdomains
+const RecursiveFileName = "recursive_subdomains.txt"
+
 type ActiveEnum struct {
-	PureDNS        PureDNS
-	Gotator        Gotator
-	OutDirPath     string
-	SpecifiedFiles []string
+	MassDNS         MassDNS
+	Permute         Permute
+	EnableRecursive bool
+	Recursive       Recursive
+	OutDirPath      string
+	SpecifiedFiles  []string
+	Scope           *utils.Scope
 }
 
-type PureDNS struct {
-	Domain       string
-	Wordlist     string
-	Resolvers    string
-	NumOfThreads int
+type MassDNS struct {
+	Domain           string
+	Wordlist         string
+	Resolvers        string
+	TrustedResolvers string
+	WorkerCount      int
+	RateLimit        int
+	Retries          int
 }
 
-type Gotator struct {
-	Sublist      string
-	Permlist     string
-	Depth        int
-	Numbers      int
-	NumOfThreads int
-	Mindup       bool
-	Adv          bool
-	Md           bool
+type Recursive struct {
+	Wordlist    string
+	ServerAddr  string
+	Resolvers   string
+	RecordTypes string
+	WorkerCount int
+	Retries     int
+	Depth       int
+	MaxPerLevel int
+	MinChildren int
+	Patterns    []string
 }
 
-func RunPureDNS(mode, domain, outDirPath, wordlist, resolvers string, numOfThreads int) error {
+type Permute struct {
+	Sublist       string
+	Wordlist      string
+	Depth         int
+	Numbers       int
+	Learn         bool
+	MaxCandidates int
+}
 
-	myLogger.Info("Running puredns")
+func init() {
+	Register(activeEnumModule{})
+}
 
-	// printing the execution time
-	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "puredns")
+// activeEnumModule brute-forces and permutes subdomains
+type activeEnumModule struct{}
 
-	// Show progress
-	utils.ShowProgress()
+func (activeEnumModule) Name() string { return "active" }
 
-	// Run puredns
-	switch mode {
-	case "bruteforce":
-		outDir := filepath.Join(outDirPath, "active_enum_subdomains.txt")
-		_, err := utils.RunCommand("puredns", "bruteforce", wordlist, domain, "--resolvers", resolvers, "--write", outDir, "--threads", numOfThreads)
-		if err != nil {
-			return err
-		}
+func (activeEnumModule) Inputs() []string { return []string{"passive_enum_subdomains.txt"} }
 
-		// Count resolved subdomains
-		subCount, err := utils.CountLines(outDir)
-		if err != nil {
-			myLogger.Warning("Failed to measure number of resolved subdomains: %v", err)
-		}
+func (activeEnumModule) Outputs() []string {
+	return []string{"active_enum_subdomains.txt", RecursiveFileName, "all_subdomains.txt", "resolved_subs.txt"}
+}
 
-		myLogger.Info("%v new subdomain found!", subCount)
+func (activeEnumModule) Config(env *Env) interface{} { return NewActiveEnum(env) }
 
-	case "resolve":
-		// Ensure the temporary directory exists
-		tempDir := ".tmp"
-		if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
-			return fmt.Errorf("failed to create temporary directory: %v", err)
-		}
-		outDir := filepath.Join(outDirPath, "resolved_subs.txt")
-		permutatedSubs := filepath.Join(tempDir, "permutated_subs.txt")
+func (activeEnumModule) Run(ctx context.Context, env *Env) error {
+	err := InitActiveSubdEnum(ctx, NewActiveEnum(env))
+	recordActive(env.Log, env.Store, env.OutDirPath)
+	return err
+}
 
-		_, err := utils.RunCommand("puredns", "resolve", permutatedSubs, "--resolvers", resolvers, "--write", outDir, "--threads", numOfThreads)
-		if err != nil {
-			return err
+// NewActiveEnum sets the ACTIVE_ENUM configs from the environment
+func NewActiveEnum(env *Env) ActiveEnum {
+	config := env.Config
+
+	specifiedFiles := []string{"passive_enum_subdomains.txt", "active_enum_subdomains.txt"}
+	if config.EnableRecursive {
+		specifiedFiles = append(specifiedFiles, RecursiveFileName)
+	}
+
+	var patterns []string
+	for _, pattern := range strings.Split(config.RecursivePatterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, strings.ToLower(pattern))
 		}
+	}
+
+	return ActiveEnum{
+		MassDNS: MassDNS{
+			Domain:           env.Domain,
+			Wordlist:         config.BruteforceWordlist,
+			Resolvers:        config.BruteforceResolvers,
+			TrustedResolvers: config.BruteforceTrustedResolvers,
+			WorkerCount:      config.BruteforceWorkerCount,
+			RateLimit:        config.BruteforceRateLimit,
+			Retries:          config.BruteforceRetries,
+		},
+		Permute: Permute{
+			Sublist:       filepath.Join(env.OutDirPath, "all_subdomains.txt"),
+			Wordlist:      config.PermuteWordlist,
+			Depth:         config.PermuteDepth,
+			Numbers:       config.PermuteNumbers,
+			Learn:         config.PermuteLearn,
+			MaxCandidates: config.PermuteMaxCandidates,
+		},
+		EnableRecursive: config.EnableRecursive,
+		Recursive: Recursive{
+			Wordlist:    config.RecursiveWordlist,
+			ServerAddr:  config.Subkill3rServerAddr,
+			Resolvers:   config.Subkill3rResolvers,
+			RecordTypes: config.Subkill3rRecordTypes,
+			WorkerCount: config.Subkill3rWorkerCount,
+			Retries:     config.Subkill3rRetries,
+			Depth:       config.RecursiveDepth,
+			MaxPerLevel: config.RecursiveMaxPerLevel,
+			MinChildren: config.RecursiveMinChildren,
+			Patterns:    patterns,
+		},
+		OutDirPath:     env.OutDirPath,
+		SpecifiedFiles: specifiedFiles,
+		Scope:          env.Scope,
+	}
+}
+
+// trustedWorkersPerResolver caps the workers checking names against the trusted
+// resolvers, a handful of them cannot take the load of the public ones
+const trustedWorkersPerResolver = 4
+
+// resolveFunc resolves names through pool with workerCount workers
+type resolveFunc func(ctx context.Context, pool *subkill3r.ResolverPool, workerCount int) ([]subkill3r.Result, error)
+
+// RunMassDNS resolves the names produced by resolve through the resolvers, each one
+// sent at most rateLimit queries per second. The names resolving are checked again
+// against the trusted resolvers, under the same rate limit, and written to output.
+func RunMassDNS(ctx context.Context, name, output, resolvers, trustedResolvers string, workerCount, rateLimit, retries int, resolve resolveFunc) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running mass resolver for %s", name)
 
-		// Count resolved subdomains
-		subCount, err := utils.CountLines(outDir)
+	// printing the execution time
+	startTime := time.Now()
+	defer utils.LogElapsedTime(log, startTime, "mass resolver")
+
+	addrs, err := subkill3r.LoadResolvers(resolvers)
+	if err != nil {
+		return fmt.Errorf("failed to load resolvers from %s: %v", resolvers, err)
+	}
+	pool, err := subkill3r.NewResolverPool(addrs, retries)
+	if err != nil {
+		return err
+	}
+	pool.SetRateLimit(rateLimit)
+	log.Info("%v resolvers loaded", len(addrs))
+
+	results, runErr := resolve(ctx, pool, workerCount)
+
+	// The takeover check resolves the dangling names again, they need no confirmation
+	appendDangling(log, filepath.Dir(output), results, name)
+
+	// Public resolvers lie now and then, the names the trusted ones deny are dropped
+	if trustedResolvers != "none" && runErr == nil {
+		trustedAddrs := subkill3r.ParseResolvers(trustedResolvers)
+		trusted, err := subkill3r.NewResolverPool(trustedAddrs, retries)
 		if err != nil {
-			myLogger.Warning("Failed to measure number of resolved subdomains: %v", err)
+			return fmt.Errorf("failed to use trusted resolvers %s: %v", trustedResolvers, err)
 		}
+		trusted.SetRateLimit(rateLimit)
+		trustedWorkers := min(workerCount, trustedWorkersPerResolver*len(trustedAddrs))
+
+		before := countHosts(results)
+		results, runErr = subkill3r.Validate(ctx, results, trusted, trustedWorkers)
+		log.Info("%v of %v subdomains confirmed by the trusted resolvers", countHosts(results), before)
+	}
 
-		myLogger.Info("%v new subdomain found!", subCount)
+	count, err := writeResolved(output, results)
+	if err != nil {
+		return fmt.Errorf("Error writing to file %s: %v", output, err)
+	}
+	log.Info("%v new subdomain found!", count)
 
-	default:
-		return fmt.Errorf("Unknown mode for puredns: %v", mode)
+	if runErr != nil {
+		return runErr
 	}
 
-	myLogger.Info("Puredns executed successfully\n")
+	log.Info("Mass resolver executed successfully\n")
 
 	return nil
 }
 
-func RunGotator(sublist, permlist string, depth, numbers, numOfThreads int, mindup, adv, md bool) error {
-
-	myLogger.Info("Running gotator")
+// countHosts returns the number of names that resolved among results
+func countHosts(results []subkill3r.Result) int {
+	hosts := make(map[string]bool)
+	for _, r := range results {
+		if r.IPAdress != "" {
+			hosts[r.Hostname] = true
+		}
+	}
+	return len(hosts)
+}
 
-	// printing the execution time
-	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "gotator")
+// writeResolved writes the names of results that resolved to path, sorted and
+// without duplicates, and returns how many were written
+func writeResolved(path string, results []subkill3r.Result) (int, error) {
+	var data []byte
+	for _, r := range results {
+		if r.IPAdress != "" {
+			data = append(data, r.Hostname+"\n"...)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return 0, err
+	}
 
-	// Show progress
-	utils.ShowProgress()
+	return utils.SortHosts([]string{path}, path)
+}
 
-	// Prepare the command arguments
-	cmdArgs := []string{
-		"-sub", sublist,
-		"-perm", permlist,
-		"-depth", fmt.Sprint(depth),
-		"-numbers", fmt.Sprint(numbers),
-		"-t", fmt.Sprint(numOfThreads),
-		"-silent",
+// appendDangling adds the names of results whose CNAME chain dangles to the
+// dangling list of the run in outDirPath, for the takeover check
+func appendDangling(log logger.Logger, outDirPath string, results []subkill3r.Result, source string) {
+	var data []byte
+	count := 0
+	for _, r := range results {
+		if r.Dangling() {
+			data = append(data, r.Hostname+"\n"...)
+			count++
+		}
+	}
+	if count == 0 {
+		return
 	}
 
-	// Add flags based on their boolean value
-	if mindup {
-		cmdArgs = append(cmdArgs, "-mindup")
+	log.Info("%v subdomains with a dangling CNAME found by %s", count, source)
+	danglingPath := filepath.Join(outDirPath, DanglingFileName)
+	if err := utils.AppendToFile(danglingPath, data); err != nil {
+		log.Warning("Error appending to file %s: %v", danglingPath, err)
+		return
 	}
-	if adv {
-		cmdArgs = append(cmdArgs, "-adv")
+	if err := utils.RemoveDuplicatesFromFile(danglingPath); err != nil {
+		log.Warning("Failed to normalize %s: %v", danglingPath, err)
 	}
-	if md {
-		cmdArgs = append(cmdArgs, "-md")
+}
+
+// RunRecursive brute-forces under the subdomains listed in knownFiles that have
+// many children or match a pattern, and writes the names found to filePath
+func RunRecursive(ctx context.Context, domain, filePath, wordlist, serverAddr, resolvers, recordTypes string, knownFiles []string, workerCount, retries int, opts subkill3r.RecursiveOptions) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running recursive brute-force")
+
+	// printing the execution time
+	startTime := time.Now()
+	defer utils.LogElapsedTime(log, startTime, "recursive brute-force")
+
+	types, err := subkill3r.ParseRecordTypes(recordTypes)
+	if err != nil {
+		return err
 	}
 
-	// Convert cmdArgs to []interface{} for RunCommand
-	interfaceArgs := make([]interface{}, len(cmdArgs))
-	for i, arg := range cmdArgs {
-		interfaceArgs[i] = arg
+	var known []string
+	for _, path := range knownFiles {
+		lines, err := readLines(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		known = append(known, lines...)
 	}
 
-	// Run gotator
-	output, err := utils.RunCommand("gotator", interfaceArgs...)
+	pool, err := newResolverPool(log, serverAddr, resolvers, retries)
 	if err != nil {
 		return err
 	}
 
-	// Write output to specified file
-	filePath := filepath.Join(".tmp", "permutated_subs.txt")
-	err = utils.AppendToFile(filePath, output)
+	results, runErr := subkill3r.Recursive(ctx, domain, wordlist, known, pool, workerCount, types, opts)
+
+	appendDangling(log, filepath.Dir(filePath), results, "recursive brute-force")
+
+	// The file is written even when empty, the merge reads it
+	count, err := writeResolved(filePath, results)
 	if err != nil {
-		return fmt.Errorf("Error appending to file %s: %v", filePath, err)
+		return fmt.Errorf("Error writing to file %s: %v", filePath, err)
 	}
+	log.Info("%v new subdomain found!", count)
 
-	lineCount, err := utils.CountLines(filePath)
-	if err != nil {
-		myLogger.Warning("Error measuring permutated subdomains: %v ", err)
+	if runErr != nil {
+		return runErr
 	}
 
-	myLogger.Info("%v permutations generated!", lineCount)
-	myLogger.Info("Gotator executed successfully\n")
+	log.Info("Recursive brute-force executed successfully\n")
 
 	return nil
 }
 
-func RunMergeFiles(outDirPath, outFileName string, specifiedFiles []string) error {
-	myLogger.Info("Starting to merge all subdomains previously gathered")
-	outFilePath := filepath.Join(outDirPath, outFileName)
+// RunPermute generates permutations of the subdomains listed in sublist and
+// resolves them through the mass resolver as they are generated, the ones
+// resolving are written to filePath
+func RunPermute(ctx context.Context, domain, sublist, filePath, wordlist, resolvers, trustedResolvers string, depth, numbers, maxCandidates, workerCount, rateLimit, retries int, learn bool) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running permutations")
 
-	// Merge all gathered subdomain files to a single file
-	if err := utils.MergeFiles(outDirPath, outFileName, specifiedFiles); err != nil {
-		return fmt.Errorf(color.RedString("Error while merging %v to :%v", specifiedFiles, outFileName))
-	}
-	myLogger.Info("Merge all subdomains operation is successfull!")
+	// printing the execution time
+	startTime := time.Now()
+	defer utils.LogElapsedTime(log, startTime, "permutations")
 
-	// Count total enumerated subdomains
-	subCount, err := utils.CountLines(outFilePath)
+	names, err := readLines(sublist)
 	if err != nil {
-		myLogger.Error("\rError measuring enumerated subdomains: %v ", err)
+		return err
+	}
+	var words []string
+	if wordlist != "none" {
+		if words, err = permute.LoadWords(wordlist); err != nil {
+			return fmt.Errorf("failed to load permutation words from %s: %v", wordlist, err)
+		}
+	}
+
+	gen := permute.New(domain, names, permute.Options{
+		Words:         words,
+		Numbers:       numbers,
+		Depth:         depth,
+		Learn:         learn,
+		MaxCandidates: maxCandidates,
+	})
+	log.Info("Permuting %v subdomains with %v words", len(names), len(gen.Words()))
+
+	// The candidates go straight to the resolvers, none of them is kept around
+	var emitted int
+	var genErr error
+	resolve := func(ctx context.Context, pool *subkill3r.ResolverPool, workerCount int) ([]subkill3r.Result, error) {
+		fqdns := make(chan string, workerCount)
+		go func() {
+			defer close(fqdns)
+			emitted, genErr = gen.Run(ctx, func(candidate string) { fqdns <- candidate })
+		}()
+		return subkill3r.Resolve(ctx, domain, fqdns, pool, workerCount, subkill3r.AddressTypes)
+	}
+	runErr := RunMassDNS(ctx, "permutations", filePath, resolvers, trustedResolvers, workerCount, rateLimit, retries, resolve)
+
+	if errors.Is(genErr, permute.ErrLimit) {
+		log.Warning("Permutations stopped at %v candidates, look for PERMUTE_MAX_CANDIDATES in config file", emitted)
+	}
+	log.Info("%v permutations generated!", emitted)
+
+	if runErr != nil {
+		return runErr
 	}
-	myLogger.Info("%v subdomains gathered", subCount)
 
-	// Removing duplicates: FATAL
-	if err := utils.RemoveDuplicatesFromFile(outFilePath); err != nil {
-		return fmt.Errorf(color.RedString("ACTIVE_ENUM module failed: error removing duplicates from the file %s: %v ", outFilePath, err))
+	log.Info("Permutations executed successfully\n")
+
+	return nil
+}
+
+func RunMergeFiles(log logger.Logger, outDirPath, outFileName string, specifiedFiles []string) error {
+	log.Info("Starting to merge all subdomains previously gathered")
+	outFilePath := filepath.Join(outDirPath, outFileName)
+
+	// Merge all gathered subdomain files to a single sorted file without duplicates
+	if err := utils.MergeFiles(log, outDirPath, outFileName, specifiedFiles); err != nil {
+		return fmt.Errorf(color.RedString("Error while merging %v to :%v", specifiedFiles, outFileName))
 	}
-	myLogger.Info("Removing duplicates from %s", outFilePath)
+	log.Info("Merge all subdomains operation is successfull!")
 
 	// Count unique subdomains
-	subCount, err = utils.CountLines(outFilePath)
+	subCount, err := utils.CountLines(outFilePath)
 	if err != nil {
-		myLogger.Warning("\rError measuring enumerated subdomains: %v ", err)
+		log.Warning("\rError measuring enumerated subdomains: %v ", err)
 	}
-	myLogger.Info("%v unique subdomains gathered\n", subCount)
+	log.Info("%v unique subdomains gathered\n", subCount)
 
 	return nil
 }
 
-func InitActiveSubdEnum(cfg ActiveEnum) error {
+func InitActiveSubdEnum(ctx context.Context, cfg ActiveEnum) error {
+	log := logger.FromContext(ctx)
 	modName := "ACTIVE_ENUM"
-	myLogger.Info(color.RedString("%s module initialized\n", modName))
+	log.Info(color.RedString("%s module initialized\n", modName))
 
 	// FATAL inital foothold for this module(can be altered later)
-	myLogger.Info(color.RedString("DNS_BRUTEFORCE is activated"))
-	if err := RunPureDNS("bruteforce", cfg.PureDNS.Domain, cfg.OutDirPath, cfg.PureDNS.Wordlist, cfg.PureDNS.Resolvers, cfg.PureDNS.NumOfThreads); err != nil {
-		return fmt.Errorf(color.RedString("Error running puredns for domain %s: %v\n", cfg.PureDNS.Domain, err))
+	log.Info(color.RedString("DNS_BRUTEFORCE is activated"))
+	bruteforce := func(ctx context.Context, pool *subkill3r.ResolverPool, workerCount int) ([]subkill3r.Result, error) {
+		return subkill3r.Subkill3r(ctx, cfg.MassDNS.Domain, cfg.MassDNS.Wordlist, pool, workerCount, subkill3r.AddressTypes)
+	}
+	if err := RunMassDNS(ctx, "brute-force", filepath.Join(cfg.OutDirPath, "active_enum_subdomains.txt"), cfg.MassDNS.Resolvers, cfg.MassDNS.TrustedResolvers, cfg.MassDNS.WorkerCount, cfg.MassDNS.RateLimit, cfg.MassDNS.Retries, bruteforce); err != nil {
+		return fmt.Errorf(color.RedString("Error running the mass resolver for domain %s: %v\n", cfg.MassDNS.Domain, err))
+	}
+	if err := applyScope(ctx, cfg.Scope, filepath.Join(cfg.OutDirPath, "active_enum_subdomains.txt"), cfg.OutDirPath); err != nil {
+		return fmt.Errorf(color.RedString("%s module failed: %v", modName, err))
+	}
+
+	// Brute-force under the subdomains found so far
+	if cfg.EnableRecursive {
+		log.Info(color.RedString("RECURSIVE_BRUTEFORCE is activated"))
+		filePath := filepath.Join(cfg.OutDirPath, RecursiveFileName)
+		knownFiles := []string{filepath.Join(cfg.OutDirPath, "passive_enum_subdomains.txt"), filepath.Join(cfg.OutDirPath, "active_enum_subdomains.txt")}
+		opts := subkill3r.RecursiveOptions{
+			Depth:       cfg.Recursive.Depth,
+			MaxPerLevel: cfg.Recursive.MaxPerLevel,
+			MinChildren: cfg.Recursive.MinChildren,
+			Patterns:    cfg.Recursive.Patterns,
+		}
+		if err := RunRecursive(ctx, cfg.MassDNS.Domain, filePath, cfg.Recursive.Wordlist, cfg.Recursive.ServerAddr, cfg.Recursive.Resolvers, cfg.Recursive.RecordTypes, knownFiles, cfg.Recursive.WorkerCount, cfg.Recursive.Retries, opts); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Error("Error running recursive brute-force for domain %s: %v\n", cfg.MassDNS.Domain, err)
+		}
+		if err := applyScope(ctx, cfg.Scope, filePath, cfg.OutDirPath); err != nil {
+			return fmt.Errorf(color.RedString("%s module failed: %v", modName, err))
+		}
 	}
 
 	// Merge all subdomain files previously gathered
-	myLogger.Info(color.RedString("MERGE_FILES is activated"))
-	if err := RunMergeFiles(cfg.OutDirPath, "all_subdomains.txt", cfg.SpecifiedFiles); err != nil {
+	log.Info(color.RedString("MERGE_FILES is activated"))
+	if err := RunMergeFiles(log, cfg.OutDirPath, "all_subdomains.txt", cfg.SpecifiedFiles); err != nil {
 		return fmt.Errorf(color.RedString("Error running merge files to %v", cfg.OutDirPath))
 	}
 
-	// DNS permutation
-	myLogger.Info(color.RedString("DNS_PERMUTATION is activated"))
-	if err := RunGotator(cfg.Gotator.Sublist, cfg.Gotator.Permlist, cfg.Gotator.Depth, cfg.Gotator.Numbers, cfg.Gotator.NumOfThreads, cfg.Gotator.Mindup, cfg.Gotator.Adv, cfg.Gotator.Md); err != nil {
-		return fmt.Errorf(color.RedString("Error running gotator for domain %s: %v\n", cfg.PureDNS.Domain, err))
+	// DNS permutation, resolved through the mass resolver as the candidates are generated
+	log.Info(color.RedString("DNS_PERMUTATION is activated"))
+	if err := RunPermute(ctx, cfg.MassDNS.Domain, cfg.Permute.Sublist, filepath.Join(cfg.OutDirPath, "resolved_subs.txt"), cfg.Permute.Wordlist, cfg.MassDNS.Resolvers, cfg.MassDNS.TrustedResolvers, cfg.Permute.Depth, cfg.Permute.Numbers, cfg.Permute.MaxCandidates, cfg.MassDNS.WorkerCount, cfg.MassDNS.RateLimit, cfg.MassDNS.Retries, cfg.Permute.Learn); err != nil {
+		return fmt.Errorf(color.RedString("Error running permutations for domain %s: %v\n", cfg.MassDNS.Domain, err))
 	}
-
-	// DNS Resolving
-	myLogger.Info(color.RedString("DNS_RESOLVE is activated"))
-	if err := RunPureDNS("resolve", cfg.PureDNS.Domain, cfg.OutDirPath, cfg.PureDNS.Wordlist, cfg.PureDNS.Resolvers, cfg.PureDNS.NumOfThreads); err != nil {
-		return fmt.Errorf(color.RedString("Error running puredns for domain %s: %v\n", cfg.PureDNS.Domain, err))
+	if err := applyScope(ctx, cfg.Scope, filepath.Join(cfg.OutDirPath, "resolved_subs.txt"), cfg.OutDirPath); err != nil {
+		return fmt.Errorf(color.RedString("%s module failed: %v", modName, err))
+	}
+	if err := applyScope(ctx, cfg.Scope, filepath.Join(cfg.OutDirPath, DanglingFileName), cfg.OutDirPath); err != nil {
+		return fmt.Errorf(color.RedString("%s module failed: %v", modName, err))
 	}
 
-	myLogger.Info(color.RedString("%s module completed\n", modName))
+	log.Info(color.RedString("%s module completed\n", modName))
 
 	return nil
 }
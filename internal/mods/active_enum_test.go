@@ -0,0 +1,111 @@
+package mods
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/subkill3r"
+	"github.com/miekg/dns"
+)
+
+func TestAppendDangling(t *testing.T) {
+	dir := t.TempDir()
+	danglingPath := filepath.Join(dir, DanglingFileName)
+	// Passive enumeration already found one of them
+	if err := os.WriteFile(danglingPath, []byte("old.ex.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results := []subkill3r.Result{
+		{Hostname: "www.ex.test", IPAdress: "10.0.0.1", Rcode: "NOERROR"},
+		{Hostname: "old.ex.test", CNAMEChain: []string{"gone.cloud.test"}, Rcode: "NXDOMAIN"},
+		{Hostname: "shop.ex.test", CNAMEChain: []string{"shop.cloud.test"}, Rcode: "NXDOMAIN"},
+		{Hostname: "cdn.ex.test", CNAMEChain: []string{"cdn.cloud.test"}, IPAdress: "10.0.0.2", Rcode: "NOERROR"},
+	}
+	appendDangling(logger.GetLogger(), dir, results, "test")
+
+	got, err := os.ReadFile(danglingPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "old.ex.test\nshop.ex.test\n"; string(got) != want {
+		t.Errorf("dangling list = %q, want %q", got, want)
+	}
+}
+
+// startDNS serves h over UDP on 127.0.0.1 until the test ends and returns its address
+func startDNS(t *testing.T, h dns.HandlerFunc) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: h, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+// answerA answers the A queries for the names in ips and NXDOMAIN for the others
+func answerA(ips map[string]string) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		q := r.Question[0]
+		if ip, ok := ips[q.Name]; !ok {
+			m.Rcode = dns.RcodeNameError
+		} else if q.Qtype == dns.TypeA {
+			rr, _ := dns.NewRR(q.Name + " 60 IN A " + ip)
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+	}
+}
+
+func TestRunMassDNS(t *testing.T) {
+	dir := t.TempDir()
+	// The public resolver lies about fake.ex.test, the trusted one does not
+	public := startDNS(t, answerA(map[string]string{"www.ex.test.": "10.0.0.1", "fake.ex.test.": "10.9.9.9"}))
+	trusted := startDNS(t, answerA(map[string]string{"www.ex.test.": "10.0.0.1"}))
+	resolvers := filepath.Join(dir, "resolvers.txt")
+	if err := os.WriteFile(resolvers, []byte(public+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var rateLimited bool
+	resolve := func(ctx context.Context, pool *subkill3r.ResolverPool, workerCount int) ([]subkill3r.Result, error) {
+		start := time.Now()
+		var results []subkill3r.Result
+		for _, name := range []string{"www.ex.test", "fake.ex.test", "nope.ex.test"} {
+			results = append(results, pool.Lookup(ctx, name)...)
+		}
+		// The canary and six queries at 50 per second
+		rateLimited = time.Since(start) >= 100*time.Millisecond
+		return results, nil
+	}
+
+	output := filepath.Join(dir, "resolved_subs.txt")
+	if err := RunMassDNS(context.Background(), "test", output, resolvers, trusted, 4, 50, 0, resolve); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "www.ex.test\n" {
+		t.Errorf("%s = %q, want only www.ex.test", filepath.Base(output), got)
+	}
+	if !rateLimited {
+		t.Error("the resolvers were not rate limited")
+	}
+}
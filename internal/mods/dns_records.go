@@ -0,0 +1,165 @@
+package mods
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/subkill3r"
+)
+
+// DNSRecordsFileName holds a JSON line with every DNS answer the sources received for a host
+const DNSRecordsFileName = "dns_records.jsonl"
+
+// WriteDNSRecords merges the JSONL sidecars of the passive sources into the DNS
+// records output of the run and returns the number of hosts written.
+func WriteDNSRecords(log logger.Logger, outDirPath string) (int, error) {
+	merged := make(map[string]*hostRecord)
+
+	sidecars, _ := filepath.Glob(filepath.Join(outDirPath, "passive_sources", "*.jsonl"))
+	for _, path := range sidecars {
+		err := readJSONLines(path, func(line []byte) {
+			var hr hostRecord
+			if json.Unmarshal(line, &hr) != nil {
+				return
+			}
+			host := utils.NormalizeHost(hr.Host)
+			if host == "" {
+				return
+			}
+			record, ok := merged[host]
+			if !ok {
+				record = &hostRecord{Host: host}
+				merged[host] = record
+			}
+			for _, ip := range hr.IPs {
+				if !containsString(record.IPs, ip) {
+					record.IPs = append(record.IPs, ip)
+				}
+			}
+			for _, cname := range hr.CNAMEs {
+				if cname = utils.NormalizeHost(cname); cname != "" && !containsString(record.CNAMEs, cname) {
+					record.CNAMEs = append(record.CNAMEs, cname)
+				}
+			}
+			record.Records = mergeRecords(record.Records, hr.Records)
+		})
+		if err != nil {
+			log.Warning("Failed to read %s: %v", path, err)
+		}
+	}
+
+	records := make([]hostRecord, 0, len(merged))
+	for _, record := range merged {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Host < records[j].Host })
+
+	return len(records), writeHostRecords(filepath.Join(outDirPath, DNSRecordsFileName), records)
+}
+
+// scopeSidecar drops the DNS answers of the hosts no longer listed in the host list
+// of a source, so the out of scope hosts it dropped leave no records behind. Hosts
+// without addresses never make it to the list, scope decides for them.
+func scopeSidecar(ctx context.Context, scope *utils.Scope, listPath string) error {
+	sidecar := strings.TrimSuffix(listPath, filepath.Ext(listPath)) + ".jsonl"
+	if _, err := os.Stat(sidecar); os.IsNotExist(err) {
+		return nil
+	}
+
+	hosts := make(map[string]bool)
+	list, err := os.ReadFile(listPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(list), "\n") {
+		if host := utils.NormalizeHost(line); host != "" {
+			hosts[host] = true
+		}
+	}
+
+	var records []hostRecord
+	err = readJSONLines(sidecar, func(line []byte) {
+		var hr hostRecord
+		if json.Unmarshal(line, &hr) != nil {
+			return
+		}
+		if hosts[utils.NormalizeHost(hr.Host)] || (len(hr.IPs) == 0 && scope.Allows(ctx, hr.Host)) {
+			records = append(records, hr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeHostRecords(sidecar, records)
+}
+
+// readDNSRecords returns the hosts of the DNS records output, none if the run has not written it
+func readDNSRecords(outDirPath string) ([]hostRecord, error) {
+	var records []hostRecord
+	err := readJSONLines(filepath.Join(outDirPath, DNSRecordsFileName), func(line []byte) {
+		var hr hostRecord
+		if json.Unmarshal(line, &hr) == nil {
+			records = append(records, hr)
+		}
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return records, err
+}
+
+// scopedDNSRecords returns the hosts of the DNS records output that scope allows.
+// The sources of a run scoped after it wrote its records can still hold other hosts.
+func scopedDNSRecords(ctx context.Context, outDirPath string, scope *utils.Scope) ([]hostRecord, error) {
+	records, err := readDNSRecords(outDirPath)
+	if scope == nil {
+		return records, err
+	}
+
+	var scoped []hostRecord
+	for _, hr := range records {
+		if scope.Allows(ctx, hr.Host) {
+			scoped = append(scoped, hr)
+		}
+	}
+
+	return scoped, err
+}
+
+// mergeRecords appends the records of add that are not in records yet
+func mergeRecords(records, add []subkill3r.Record) []subkill3r.Record {
+	for _, r := range add {
+		found := false
+		for _, have := range records {
+			if have == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// otherRecords returns the records that are neither addresses nor CNAMEs, those have their own fields
+func otherRecords(records []subkill3r.Record) []subkill3r.Record {
+	var others []subkill3r.Record
+	for _, r := range records {
+		switch r.Type {
+		case "A", "AAAA", "CNAME":
+		default:
+			others = append(others, r)
+		}
+	}
+	return others
+}
@@ -0,0 +1,144 @@
+package mods
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/subkill3r"
+)
+
+func TestScopeSidecar(t *testing.T) {
+	dir := t.TempDir()
+	sources := filepath.Join(dir, "passive_sources")
+	if err := os.Mkdir(sources, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The host list already lost its out of scope host, the sidecar still has it
+	listPath := filepath.Join(sources, "axfr.txt")
+	if err := os.WriteFile(listPath, []byte("www.ex.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := []hostRecord{
+		{Host: "WWW.ex.test.", IPs: []string{"10.0.0.1"}},
+		{Host: "www.other.test", IPs: []string{"10.0.0.2"}},
+	}
+	if err := writeHostRecords(filepath.Join(sources, "axfr.jsonl"), sidecar); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scopeSidecar(context.Background(), nil, listPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteDNSRecords(logger.GetLogger(), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := readDNSRecords(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Host != "www.ex.test" {
+		t.Errorf("dns records = %+v, want only www.ex.test", records)
+	}
+	data, _ := os.ReadFile(filepath.Join(sources, "axfr.jsonl"))
+	if strings.Contains(string(data), "other.test") {
+		t.Errorf("sidecar still holds the out of scope host:\n%s", data)
+	}
+}
+
+func TestScopeSidecarWithoutSidecar(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "subfinder.txt")
+	if err := os.WriteFile(listPath, []byte("www.ex.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := scopeSidecar(context.Background(), nil, listPath); err != nil {
+		t.Errorf("scopeSidecar without a sidecar = %v", err)
+	}
+}
+
+func TestScopeSidecarKeepsDelegations(t *testing.T) {
+	dir := t.TempDir()
+	scopePath := filepath.Join(dir, "scope.txt")
+	if err := os.WriteFile(scopePath, []byte("*.ex.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scope, err := utils.LoadScope(scopePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hosts without addresses are never listed, the scope decides for them
+	listPath := filepath.Join(dir, "subkill3r.txt")
+	if err := os.WriteFile(listPath, []byte("www.ex.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ns := []subkill3r.Record{{Type: "NS", Value: "ns1.gone.test."}}
+	sidecar := []hostRecord{
+		{Host: "www.ex.test", IPs: []string{"10.0.0.1"}},
+		{Host: "dev.ex.test", Records: ns},
+		{Host: "dev.other.test", Records: ns},
+	}
+	if err := writeHostRecords(filepath.Join(dir, "subkill3r.jsonl"), sidecar); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scopeSidecar(context.Background(), scope, listPath); err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	err = readJSONLines(filepath.Join(dir, "subkill3r.jsonl"), func(line []byte) {
+		var hr hostRecord
+		if json.Unmarshal(line, &hr) == nil {
+			hosts = append(hosts, hr.Host)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(hosts, ",") != "www.ex.test,dev.ex.test" {
+		t.Errorf("sidecar hosts = %v, want www.ex.test and dev.ex.test", hosts)
+	}
+}
+
+func TestScopedDNSRecords(t *testing.T) {
+	dir := t.TempDir()
+	scopePath := filepath.Join(dir, "scope.txt")
+	if err := os.WriteFile(scopePath, []byte("*.ex.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scope, err := utils.LoadScope(scopePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []hostRecord{
+		{Host: "dev.ex.test", Records: []subkill3r.Record{{Type: "NS", Value: "ns1.gone.test."}}},
+		{Host: "mail.other.test", Records: []subkill3r.Record{{Type: "TXT", Value: "v=spf1 include:gone.test -all"}}},
+	}
+	if err := writeHostRecords(filepath.Join(dir, DNSRecordsFileName), records); err != nil {
+		t.Fatal(err)
+	}
+
+	scoped, err := scopedDNSRecords(context.Background(), dir, scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scoped) != 1 || scoped[0].Host != "dev.ex.test" {
+		t.Errorf("scopedDNSRecords() = %+v, want only dev.ex.test", scoped)
+	}
+
+	all, err := scopedDNSRecords(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("scopedDNSRecords() without a scope = %+v, want both hosts", all)
+	}
+}
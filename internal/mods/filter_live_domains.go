@@ -1,56 +1,201 @@
 package mods
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/prober"
 	"github.com/fatih/color"
 )
 
-func RunHTTPX(filePath, outDirPath string) error {
-	// filter live subdomains
-	myLogger.Info("Running httpx")
-	liveSubdomains := filepath.Join(outDirPath, "live_subdomains.txt")
+// HTTPProbeFileName holds a JSON line for every web service found by the prober
+const HTTPProbeFileName = "http_probe.jsonl"
+
+type FilterLiveDomains struct {
+	OutDirPath string
+	Scope      *utils.Scope
+	Prober     Prober
+}
+
+type Prober struct {
+	Concurrency     int
+	Ports           string
+	Schemes         string
+	FollowRedirects bool
+	MaxRedirects    int
+	Timeout         int
+}
+
+func init() {
+	Register(filterLiveDomainsModule{})
+}
+
+// filterLiveDomainsModule merges every subdomain found and keeps the live ones
+type filterLiveDomainsModule struct{}
+
+func (filterLiveDomainsModule) Name() string { return "filter" }
+
+func (filterLiveDomainsModule) Inputs() []string {
+	return []string{"passive_enum_subdomains.txt", "passive_sources", "active_enum_subdomains.txt", RecursiveFileName, "all_subdomains.txt", "resolved_subs.txt"}
+}
+
+func (filterLiveDomainsModule) Outputs() []string {
+	return []string{"ultimate_subdomains.txt", ProvenanceFileName, HTTPProbeFileName, "live_subdomains.txt"}
+}
+
+func (filterLiveDomainsModule) Config(env *Env) interface{} { return NewFilterLiveDomains(env) }
+
+func (filterLiveDomainsModule) Run(ctx context.Context, env *Env) error {
+	err := InitFilterLiveDomains(ctx, NewFilterLiveDomains(env))
+	recordFilter(env.Log, env.Store, env.OutDirPath)
+	return err
+}
+
+// NewFilterLiveDomains sets the FILTER_LIVE_DOMAINS configs from the environment
+func NewFilterLiveDomains(env *Env) FilterLiveDomains {
+	config := env.Config
+
+	return FilterLiveDomains{
+		OutDirPath: env.OutDirPath,
+		Scope:      env.Scope,
+		Prober: Prober{
+			Concurrency:     config.ProberConcurrency,
+			Ports:           config.ProberPorts,
+			Schemes:         config.ProberSchemes,
+			FollowRedirects: config.ProberFollowRedirects,
+			MaxRedirects:    config.ProberMaxRedirects,
+			Timeout:         config.ProberTimeout,
+		},
+	}
+}
+
+// RunProber probes the hosts listed in filePath, writing every web service found to
+// http_probe.jsonl and their URLs to live_subdomains.txt. Redirects leaving scope are not followed.
+func RunProber(ctx context.Context, filePath, outDirPath string, cfg Prober, scope *utils.Scope) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running the HTTP prober")
 
 	// printing the execution time
 	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "httpx")
+	defer utils.LogElapsedTime(log, startTime, "HTTP prober")
 
 	// Show progress
 	utils.ShowProgress()
 
-	_, err := utils.RunCommand("httpx", "-l", filePath, "-o", liveSubdomains)
+	opts := prober.Options{
+		Concurrency:     cfg.Concurrency,
+		FollowRedirects: cfg.FollowRedirects,
+		MaxRedirects:    cfg.MaxRedirects,
+		Timeout:         time.Duration(cfg.Timeout) * time.Second,
+	}
+	if scope != nil {
+		opts.AllowRedirect = scope.Allows
+	}
+	for _, port := range splitList(cfg.Ports) {
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		opts.Ports = append(opts.Ports, p)
+	}
+	for _, scheme := range splitList(cfg.Schemes) {
+		if scheme != "http" && scheme != "https" {
+			return fmt.Errorf("invalid scheme %q", scheme)
+		}
+		opts.Schemes = append(opts.Schemes, scheme)
+	}
+
+	hosts, err := readLines(filePath)
 	if err != nil {
 		return err
 	}
 
+	probeFile, err := os.Create(filepath.Join(outDirPath, HTTPProbeFileName))
+	if err != nil {
+		return err
+	}
+	defer probeFile.Close()
+
+	liveSubdomains := filepath.Join(outDirPath, "live_subdomains.txt")
+	liveFile, err := os.Create(liveSubdomains)
+	if err != nil {
+		return err
+	}
+	defer liveFile.Close()
+
+	probeWriter := bufio.NewWriter(probeFile)
+	liveWriter := bufio.NewWriter(liveFile)
+	encoder := json.NewEncoder(probeWriter)
+
+	var writeErr error
+	prober.New(opts).Run(ctx, hosts, func(r prober.Result) {
+		if err := encoder.Encode(r); err != nil && writeErr == nil {
+			writeErr = err
+		}
+		fmt.Fprintln(liveWriter, r.URL)
+	})
+
+	// Flush what was found even when interrupted
+	if err := probeWriter.Flush(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if err := liveWriter.Flush(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
 	subCount, err := utils.CountLines(liveSubdomains)
 	if err != nil {
-		myLogger.Warning("Failed to measure live subdomains: %v", err)
+		log.Warning("Failed to measure live subdomains: %v", err)
+	}
+	log.Info("%v live subdomain found!", subCount)
+
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	myLogger.Info("%v live subdomain found!", subCount)
 
 	// Log process completion and elapsed time
-	myLogger.Info("httpx executed successfully")
+	log.Info("HTTP prober executed successfully")
 
 	return nil
 }
 
-func InitFilterLiveDomains(outDirPath string) error {
+// splitList splits a comma separated config value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func InitFilterLiveDomains(ctx context.Context, cfg FilterLiveDomains) error {
+	log := logger.FromContext(ctx)
+	outDirPath := cfg.OutDirPath
 	modName := "FILTER_LIVE_DOMAINS"
-	myLogger.Info(color.BlueString("%s module initialized\n", modName))
+	log.Info(color.BlueString("%s module initialized\n", modName))
 
 	// Check if the ACTIVE_SUBD_ENUM is run
-	if _, err := os.Stat("all_subdomains.txt"); err != nil {
+	if _, err := os.Stat(filepath.Join(outDirPath, "all_subdomains.txt")); err != nil {
 		if os.IsNotExist(err) {
 			outFileName := "all_subdomains.txt"
-			specifiedFiles := []string{"active_enum_subdomains.txt", "passive_enum_subdomains.txt"}
+			specifiedFiles := []string{"active_enum_subdomains.txt", RecursiveFileName, "passive_enum_subdomains.txt"}
 
 			// Merge all subdomain files previously gathered
-			if err := RunMergeFiles(outDirPath, outFileName, specifiedFiles); err != nil {
+			if err := RunMergeFiles(log, outDirPath, outFileName, specifiedFiles); err != nil {
 				return fmt.Errorf(color.RedString("Error running merge files to %v", outDirPath))
 			}
 		}
@@ -60,38 +205,37 @@ func InitFilterLiveDomains(outDirPath string) error {
 	outFilePath := filepath.Join(outDirPath, outFileName)
 	specifiedFiles := []string{"all_subdomains.txt", "resolved_subs.txt"}
 
-	// Merge all gathered subdomain files to a single file
-	if err := utils.MergeFiles(outDirPath, outFileName, specifiedFiles); err != nil {
+	// Merge all gathered subdomain files to a single sorted file without duplicates
+	if err := utils.MergeFiles(log, outDirPath, outFileName, specifiedFiles); err != nil {
 		return fmt.Errorf(color.RedString("Error while merging %v to :%v", specifiedFiles, outFileName))
 	}
-	myLogger.Info("Merge all subdomains operation is successfull!")
+	log.Info("Merge all subdomains operation is successfull!")
 
-	// Count total enumerated subdomains
+	// Count unique subdomains
 	subCount, err := utils.CountLines(outFilePath)
 	if err != nil {
-		myLogger.Error("\rError measuring enumerated subdomains: %v ", err)
+		log.Warning("\rError measuring enumerated subdomains: %v ", err)
 	}
-	myLogger.Info("%v total subdomains gathered", subCount)
+	log.Info("%v total unique subdomains gathered\n", subCount)
 
-	// Removing duplicates: FATAL
-	if err := utils.RemoveDuplicatesFromFile(outFilePath); err != nil {
-		return fmt.Errorf(color.RedString("%s module failed: error removing duplicates from the file %s: %v ", modName, outFilePath, err))
+	// Nothing out of scope goes past this point to the prober and the modules probing live hosts
+	if err := applyScope(ctx, cfg.Scope, outFilePath, outDirPath); err != nil {
+		return fmt.Errorf(color.RedString("%s module failed: %v", modName, err))
 	}
-	myLogger.Info("Removing duplicates from %s", outFilePath)
 
-	// Count unique subdomains
-	subCount, err = utils.CountLines(outFilePath)
-	if err != nil {
-		myLogger.Warning("\rError measuring enumerated subdomains: %v ", err)
+	// Record which sources found each subdomain
+	if count, err := WriteProvenance(log, outDirPath); err != nil {
+		log.Warning("Failed to write subdomain provenance: %v", err)
+	} else {
+		log.Info("Provenance of %v subdomains written to %s", count, ProvenanceFileName)
 	}
-	myLogger.Info("%v total unique subdomains gathered\n", subCount)
 
 	// Filter live subdomains
-	if err := RunHTTPX(outFilePath, outDirPath); err != nil {
-		return fmt.Errorf(color.RedString("%s module failed: error running httpx for %s: %v\n", modName, outFilePath, err))
+	if err := RunProber(ctx, outFilePath, outDirPath, cfg.Prober, cfg.Scope); err != nil {
+		return fmt.Errorf(color.RedString("%s module failed: error probing %s: %v\n", modName, outFilePath, err))
 	}
 
-	myLogger.Info(color.BlueString("FILTER_LIVE_DOMAINS module completed\n"))
+	log.Info(color.BlueString("FILTER_LIVE_DOMAINS module completed\n"))
 
 	return nil
 }
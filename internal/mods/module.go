@@ -0,0 +1,188 @@
+package mods
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/notify"
+	"github.com/LiterallyEthical/r3conwhal3/internal/store"
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+)
+
+// Env holds everything a module needs to run against a target
+type Env struct {
+	Domain     string
+	OutDirPath string
+	// Workspace is the temporary directory of the run, the default wordlists and
+	// resolvers of Config are extracted to it. Its path changes on every run.
+	Workspace string
+	// TempDir is the directory of the target in the workspace of the run, created on first use
+	TempDir  string
+	Config   utils.Config
+	Scope    *utils.Scope
+	Store    *store.Store
+	Notifier *notify.Notifier
+	// Log writes the lines of the target, RunPipeline adds the module name and carries it in the module context
+	Log logger.Logger
+}
+
+// Module is a single stage of the recon chain. Inputs and outputs are file or
+// directory names relative to the run directory, they define the order modules run in.
+type Module interface {
+	Name() string
+	Inputs() []string
+	Outputs() []string
+	Run(ctx context.Context, env *Env) error
+}
+
+// Configurable is implemented by modules that depend on part of the config only.
+// The returned value is hashed to decide whether a finished module must run again on resume.
+type Configurable interface {
+	Config(env *Env) interface{}
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []Module
+)
+
+// chainOrder is the order of the recon chain, it breaks the ties between modules
+// whose inputs are ready. Modules not listed come after, in registration order.
+var chainOrder = []string{"passive", "active", "filter", "webops", "vulnscan"}
+
+// chainRank returns the position of the named module in the recon chain
+func chainRank(name string) int {
+	for i, n := range chainOrder {
+		if n == name {
+			return i
+		}
+	}
+	return len(chainOrder)
+}
+
+// Register makes a module available to the pipeline. It panics if a module with the same name is already registered.
+func Register(m Module) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, registered := range registry {
+		if registered.Name() == m.Name() {
+			panic(fmt.Sprintf("mods: module %s registered twice", m.Name()))
+		}
+	}
+	registry = append(registry, m)
+	sort.SliceStable(registry, func(i, j int) bool {
+		return chainRank(registry[i].Name()) < chainRank(registry[j].Name())
+	})
+}
+
+// Modules returns the names of all registered modules in chain order
+func Modules() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	names := make([]string, 0, len(registry))
+	for _, m := range registry {
+		names = append(names, m.Name())
+	}
+
+	return names
+}
+
+// Pipeline returns the named modules ordered so that every module runs after
+// the modules producing its inputs. Modules not listed are left out even if they
+// produce an input, their files are then expected to exist already.
+func Pipeline(names []string) ([]Module, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	// Look up the selected modules, keeping chain order for ties
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[name] = true
+	}
+	var modules []Module
+	for _, m := range registry {
+		if selected[m.Name()] {
+			modules = append(modules, m)
+			delete(selected, m.Name())
+		}
+	}
+	if len(selected) > 0 {
+		var unknown []string
+		for name := range selected {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown modules: %s", strings.Join(unknown, ", "))
+	}
+
+	// Map every output to the module producing it
+	producers := make(map[string]int)
+	for i, m := range modules {
+		for _, output := range m.Outputs() {
+			producers[output] = i
+		}
+	}
+
+	// Count the modules each module waits for
+	dependents := make([][]int, len(modules))
+	pending := make([]int, len(modules))
+	for i, m := range modules {
+		deps := make(map[int]bool)
+		for _, input := range m.Inputs() {
+			if p, ok := producers[input]; ok && p != i && !deps[p] {
+				deps[p] = true
+				dependents[p] = append(dependents[p], i)
+				pending[i]++
+			}
+		}
+	}
+
+	// Kahn's algorithm, always picking the earliest module of the chain that is ready
+	var ordered []Module
+	done := make([]bool, len(modules))
+	for len(ordered) < len(modules) {
+		next := -1
+		for i := range modules {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next == -1 {
+			return nil, fmt.Errorf("modules have a dependency cycle")
+		}
+
+		done[next] = true
+		ordered = append(ordered, modules[next])
+		for _, d := range dependents[next] {
+			pending[d]--
+		}
+	}
+
+	return ordered, nil
+}
+
+// applyScope drops the out of scope hosts from the host list at filePath
+func applyScope(ctx context.Context, scope *utils.Scope, filePath, outDirPath string) error {
+	log := logger.FromContext(ctx)
+	if scope == nil {
+		return nil
+	}
+
+	dropped, err := scope.FilterFile(ctx, filePath, outDirPath)
+	if err != nil {
+		return fmt.Errorf("failed to apply scope to %s: %w", filepath.Base(filePath), err)
+	}
+	if dropped > 0 {
+		log.Warning("%v out of scope hosts dropped from %s, see %s", dropped, filepath.Base(filePath), utils.OutOfScopeFileName)
+	}
+
+	return nil
+}
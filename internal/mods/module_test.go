@@ -0,0 +1,38 @@
+package mods
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPipelineOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []string
+		want    []string
+	}{
+		{"all modules", Modules(), []string{"passive", "active", "filter", "webops", "vulnscan"}},
+		{"webops before vulnscan", []string{"vulnscan", "webops"}, []string{"webops", "vulnscan"}},
+		{"inputs first", []string{"filter", "active", "passive"}, []string{"passive", "active", "filter"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := Pipeline(tt.modules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range pipeline {
+				got = append(got, m.Name())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pipeline(%v) = %v, want %v", tt.modules, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Pipeline([]string{"nope"}); err == nil {
+		t.Error("Pipeline with an unknown module, want an error")
+	}
+}
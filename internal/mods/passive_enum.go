@@ -1,10 +1,15 @@
 package mods
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
@@ -14,10 +19,9 @@ import (
 	"github.com/fatih/color"
 )
 
-var (
-	subCount int
-	myLogger = logger.GetLogger()
-)
+// DanglingFileName lists the subdomains whose CNAME chain ends in NXDOMAIN, the
+// vuln-scan stage checks them for takeover along with the live ones
+const DanglingFileName = "dangling_subdomains.txt"
 
 type PassiveEnum struct {
 	Domain            string
@@ -26,9 +30,14 @@ type PassiveEnum struct {
 	EnableAmass       bool
 	EnableAssetfinder bool
 	EnableSubkill3r   bool
+	EnableAXFR        bool
+	EnableZoneWalk    bool
 	Subfinder         Subfinder
 	Amass             Amass
 	Subkill3r         Subkill3r
+	AXFR              AXFR
+	ZoneWalk          ZoneWalk
+	Scope             *utils.Scope
 }
 
 type Subfinder struct {
@@ -39,98 +48,180 @@ type Amass struct {
 	Timeout int
 }
 
+type AXFR struct {
+	Timeout int
+}
+
+type ZoneWalk struct {
+	Wordlists  []string
+	MaxQueries int
+}
+
 type Subkill3r struct {
 	Wordlist    string
 	ServerAddr  string
+	Resolvers   string
+	RecordTypes string
 	WorkerCount int
+	Retries     int
+}
+
+func init() {
+	Register(passiveEnumModule{})
+}
+
+// passiveEnumModule gathers subdomains from passive sources
+type passiveEnumModule struct{}
+
+func (passiveEnumModule) Name() string { return "passive" }
+
+func (passiveEnumModule) Inputs() []string { return nil }
+
+func (passiveEnumModule) Outputs() []string {
+	return []string{"passive_enum_subdomains.txt", "passive_sources", DanglingFileName, DNSRecordsFileName}
 }
 
-func RunSubfinder(domain, filePath string, numOfThreads int) error {
+func (passiveEnumModule) Config(env *Env) interface{} { return NewPassiveEnum(env) }
+
+func (passiveEnumModule) Run(ctx context.Context, env *Env) error {
+	err := InitSubdEnum(ctx, NewPassiveEnum(env))
+	// An interrupted run may not have applied the scope to the sources, they are stored when the module runs again
+	if ctx.Err() == nil {
+		recordPassive(env.Log, env.Store, env.OutDirPath)
+	}
+	return err
+}
+
+// NewPassiveEnum sets the PASSIVE_ENUM configs from the environment
+func NewPassiveEnum(env *Env) PassiveEnum {
+	config := env.Config
+
+	return PassiveEnum{
+		Domain:            env.Domain,
+		FilePath:          filepath.Join(env.OutDirPath, "passive_enum_subdomains.txt"),
+		OutDirPath:        env.OutDirPath,
+		EnableAssetfinder: config.EnableAssetfinder,
+		EnableAmass:       config.EnableAmass,
+		EnableSubkill3r:   config.EnableSubkill3r,
+		EnableAXFR:        config.EnableAXFR,
+		EnableZoneWalk:    config.EnableZoneWalk,
+		Subfinder: Subfinder{
+			NumOfThreads: config.SubfinderNumOfThreads,
+		},
+		Amass: Amass{
+			Timeout: config.AmassTimeout,
+		},
+		Subkill3r: Subkill3r{
+			Wordlist:    config.Subkill3rWordlist,
+			ServerAddr:  config.Subkill3rServerAddr,
+			Resolvers:   config.Subkill3rResolvers,
+			RecordTypes: config.Subkill3rRecordTypes,
+			WorkerCount: config.Subkill3rWorkerCount,
+			Retries:     config.Subkill3rRetries,
+		},
+		AXFR: AXFR{
+			Timeout: config.AXFRTimeout,
+		},
+		ZoneWalk: ZoneWalk{
+			Wordlists:  wordlists(config.Subkill3rWordlist, config.BruteforceWordlist),
+			MaxQueries: config.ZoneWalkMaxQueries,
+		},
+		Scope: env.Scope,
+	}
+}
+
+// wordlists returns the given wordlists, leaving out the unset and repeated ones
+func wordlists(paths ...string) []string {
+	var list []string
+	for _, path := range paths {
+		if path != "" && path != "none" && !containsString(list, path) {
+			list = append(list, path)
+		}
+	}
+	return list
+}
+
+func RunSubfinder(ctx context.Context, domain, filePath string, numOfThreads int) error {
+	log := logger.FromContext(ctx)
 	// fmt.Printf("\n[+]Starting subfinder\n")
-	myLogger.Info("Running subfinder")
+	log.Info("Running subfinder")
 
 	// printing the execution time
 	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "subfinder")
-
-	// Show progress
-	utils.ShowProgress()
+	defer utils.LogElapsedTime(log, startTime, "subfinder")
 
 	// Run subfinder
-	_, err := utils.RunCommand("subfinder", "-d", domain, "-o", filePath, "-t", numOfThreads)
+	_, err := utils.RunCommand(ctx, "subfinder", "-d", domain, "-o", filePath, "-t", numOfThreads)
 	if err != nil {
 		return err
 	}
 
 	// Count enumareted subdomains
-	subCount, err = utils.CountLines(filePath)
+	subCount, err := utils.CountLines(filePath)
 	if err != nil {
 		// log.Printf("Error measuring enumerated subdomains: %v ", err)
-		myLogger.Warning("Failed to measure number of gathered subdomains: %v", err)
+		log.Warning("Failed to measure number of gathered subdomains: %v", err)
 	}
 	// fmt.Printf("\r[+]%v subdomains gathered", countedLines)
-	myLogger.Info("%v subdomain found!", subCount)
+	log.Info("%v subdomain found by subfinder!", subCount)
 
 	// Log process completion and elapsed time
 	// fmt.Printf("\n[+]Subfinder executed successfully")
-	myLogger.Info("Subfinder executed successfully")
+	log.Info("Subfinder executed successfully")
 	return nil
 }
 
-func RunAssetfinder(domain, filePath string) error {
-	myLogger.Info("Running assetfinder")
+func RunAssetfinder(ctx context.Context, domain, filePath string) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running assetfinder")
 
 	// printing the execution time
 	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "assetfinder")
-
-	// Show progress
-	utils.ShowProgress()
+	defer utils.LogElapsedTime(log, startTime, "assetfinder")
 
 	// Run assetfinder
-	output, err := utils.RunCommand("assetfinder", "-subs-only", domain)
-	if err != nil {
-		return err
+	output, runErr := utils.RunCommand(ctx, "assetfinder", "-subs-only", domain)
+	if runErr != nil && ctx.Err() == nil {
+		return runErr
 	}
 
-	// Write output to specified file
-	err = utils.AppendToFile(filePath, output)
+	// Write output to specified file, including what was found before an interrupt
+	err := utils.AppendToFile(filePath, output)
 	if err != nil {
 		//log.Printf("Error appending to file %s: %v", filePath, err)
-		myLogger.Warning("Error appending to file %s: %v", filePath, err)
+		log.Warning("Error appending to file %s: %v", filePath, err)
+	}
+	if runErr != nil {
+		return runErr
 	}
 
 	// Count enumareted subdomains
-
-	oldSubCount := subCount
-	subCount, err = utils.CountLines(filePath)
+	subCount, err := utils.CountLines(filePath)
 	if err != nil {
 		//log.Printf("Error measuring enumerated subdomains: %v ", err)
-		myLogger.Warning("Error measuring enumerated subdomains: %v ", err)
+		log.Warning("Error measuring enumerated subdomains: %v ", err)
 	}
 	//fmt.Printf("\r[+]%v subdomains gathered", countedLines)
-	myLogger.Info("%v new subdomain found!", subCount-oldSubCount)
+	log.Info("%v subdomain found by assetfinder!", subCount)
 
 	// Log process completion and elapsed time
-	myLogger.Info("assetfinder executed successfully")
+	log.Info("assetfinder executed successfully")
 
 	return nil
 }
 
-func RunAmass(domain, filePath string, timeout int) error {
-	myLogger.Info("Running amass")
+func RunAmass(ctx context.Context, domain, filePath string, timeout int) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running amass")
 
 	// printing the execution time
 	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "amass")
-
-	// Show progress
-	utils.ShowProgress()
+	defer utils.LogElapsedTime(log, startTime, "amass")
 
 	// Run amass
-	output, err := utils.RunCommand("amass", "enum", "-passive", "-timeout", timeout, "-d", domain)
-	if err != nil {
-		return err
+	output, runErr := utils.RunCommand(ctx, "amass", "enum", "-passive", "-timeout", timeout, "-d", domain)
+	if runErr != nil && ctx.Err() == nil {
+		return runErr
 	}
 
 	// Process amass output and apply filter for getting subdomains
@@ -150,50 +241,99 @@ func RunAmass(domain, filePath string, timeout int) error {
 	// Join subdomains into a byte slice
 	filteredOutput := []byte(strings.Join(subdomains, "\n") + "\n")
 
-	// Write output to specified file
-	err = utils.AppendToFile(filePath, filteredOutput)
+	// Write output to specified file, including what was found before an interrupt
+	err := utils.AppendToFile(filePath, filteredOutput)
 	if err != nil {
-		myLogger.Warning("Error appending to file %s: %v", filePath, err)
+		log.Warning("Error appending to file %s: %v", filePath, err)
+	}
+	if runErr != nil {
+		return runErr
 	}
 
 	// Count enumareted subdomains
-	oldSubCount := subCount
 	subCount, err := utils.CountLines(filePath)
 	if err != nil {
-		myLogger.Warning("Error measuring enumerated subdomains: %v ", err)
+		log.Warning("Error measuring enumerated subdomains: %v ", err)
 	}
-	myLogger.Info("%v new subdomain found!", subCount-oldSubCount)
+	log.Info("%v subdomain found by amass!", subCount)
 
 	// Log process completion and elapsed time
-	myLogger.Info("amass executed successfully")
+	log.Info("amass executed successfully")
 
 	return nil
 }
 
-func RunSubkill3r(domain, filePath, wordlist, serverAddr string, workerCount int) error {
-	myLogger.Info("Running subkill3r")
+func RunSubkill3r(ctx context.Context, domain, filePath, danglingPath, wordlist, serverAddr, resolvers, recordTypes string, workerCount, retries int) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running subkill3r")
 
 	// printing the execution time
 	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "subkill3r")
+	defer utils.LogElapsedTime(log, startTime, "subkill3r")
 
-	// Show progress
-	utils.ShowProgress()
+	types, err := subkill3r.ParseRecordTypes(recordTypes)
+	if err != nil {
+		return err
+	}
 
-	var filteredResults []string
-	results, err := subkill3r.Subkill3r(domain, wordlist, serverAddr, workerCount)
+	pool, err := newResolverPool(log, serverAddr, resolvers, retries)
 	if err != nil {
 		return err
 	}
 
+	var filteredResults []string
+	results, runErr := subkill3r.Subkill3r(ctx, domain, wordlist, pool, workerCount, types)
+	if runErr != nil && ctx.Err() == nil {
+		return runErr
+	}
+
+	// Report per-resolver statistics
+	statsPath := filepath.Join(filepath.Dir(filePath), "subkill3r_resolver_stats.json")
+	if err := writeResolverStats(log, statsPath, pool); err != nil {
+		log.Warning("Failed to write resolver statistics: %v", err)
+	}
+
 	// Apply filter on gathered results to extract subdomains
+	var records []hostRecord
+	var dangling []string
+	index := make(map[string]int)
 	for _, r := range results {
-		filteredResults = append(filteredResults, r.Hostname, "\n")
+		if r.IPAdress == "" {
+			if r.Dangling() {
+				dangling = append(dangling, r.Hostname)
+			} else if others := otherRecords(r.Records); len(others) > 0 {
+				// A delegation without addresses is not a live host, its NS records still go to the takeover check
+				records = append(records, hostRecord{Host: r.Hostname, Records: others})
+			}
+			continue
+		}
+		i, ok := index[r.Hostname]
+		if !ok {
+			filteredResults = append(filteredResults, r.Hostname, "\n")
+			index[r.Hostname] = len(records)
+			records = append(records, hostRecord{Host: r.Hostname, CNAMEs: r.CNAMEChain, Records: otherRecords(r.Records)})
+			i = len(records) - 1
+		}
+		records[i].IPs = append(records[i].IPs, r.IPAdress)
+	}
+
+	// Keep the names pointing to nothing for the takeover check
+	if len(dangling) > 0 {
+		log.Info("%v subdomains with a dangling CNAME found by subkill3r", len(dangling))
+		if err := utils.AppendToFile(danglingPath, []byte(strings.Join(dangling, "\n")+"\n")); err != nil {
+			log.Warning("Error appending to file %s: %v", danglingPath, err)
+		}
+	}
+
+	// Keep the DNS answers for the provenance records
+	recordsPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".jsonl"
+	if err := writeHostRecords(recordsPath, records); err != nil {
+		log.Warning("Failed to write DNS answers to %s: %v", recordsPath, err)
 	}
 
 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		myLogger.Error("Error opening file %s: %v", filePath, err)
+		log.Error("Error opening file %s: %v", filePath, err)
 	}
 	defer file.Close()
 
@@ -201,79 +341,519 @@ func RunSubkill3r(domain, filePath, wordlist, serverAddr string, workerCount int
 	for _, result := range filteredResults {
 		_, err := file.Write([]byte(result))
 		if err != nil {
-			myLogger.Warning("Error writing to file %s: %v", filePath, err)
+			log.Warning("Error writing to file %s: %v", filePath, err)
 		}
 	}
 
 	// Count enumareted subdomains
-	oldSubCount := subCount
 	subCount, err := utils.CountLines(filePath)
 	if err != nil {
-		log.Printf("Error measuring enumerated subdomains: %v ", err)
+		log.Warning("Error measuring enumerated subdomains: %v ", err)
+	}
+	log.Info("%v subdomain found by subkill3r!", subCount)
+
+	if runErr != nil {
+		return runErr
 	}
-	myLogger.Info("%v new subdomain found!", subCount-oldSubCount)
 
-	myLogger.Info("subkill3r executed successfully")
+	log.Info("subkill3r executed successfully")
 
 	return nil
 }
 
-func InitSubdEnum(cfg PassiveEnum) error {
-	modName := "PASSIVE_ENUM"
-	myLogger.Info(color.CyanString("%s module initialized\n", modName))
+// newResolverPool builds the resolver pool of subkill3r, falling back to the single server when no list is given
+func newResolverPool(log logger.Logger, serverAddr, resolvers string, retries int) (*subkill3r.ResolverPool, error) {
+	addrs := []string{serverAddr}
+	if resolvers != "none" {
+		var err error
+		addrs, err = subkill3r.LoadResolvers(resolvers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load resolvers from %s: %v", resolvers, err)
+		}
+	}
+	pool, err := subkill3r.NewResolverPool(addrs, retries)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("%v resolvers loaded", len(addrs))
+
+	return pool, nil
+}
+
+// AXFRReport is an AXFR attempt as written to passive_sources/axfr.json
+type AXFRReport struct {
+	Zone       string `json:"zone"`
+	Nameserver string `json:"nameserver"`
+	Addr       string `json:"addr,omitempty"`
+	Allowed    bool   `json:"allowed"`
+	// Rcode is set when the nameserver declined the transfer, an Error without it is a connection failure
+	Rcode string `json:"rcode,omitempty"`
+	Names int    `json:"names"`
+	Error string `json:"error,omitempty"`
+}
+
+// RunAXFR tries a zone transfer of domain from each of its nameservers and
+// writes the names of every transferred zone to filePath
+func RunAXFR(ctx context.Context, domain, filePath, serverAddr, resolvers string, retries, timeout int) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running AXFR")
+
+	// printing the execution time
+	startTime := time.Now()
+	defer utils.LogElapsedTime(log, startTime, "AXFR")
+
+	pool, err := newResolverPool(log, serverAddr, resolvers, retries)
+	if err != nil {
+		return err
+	}
+
+	transfers, runErr := pool.ZoneTransfer(ctx, domain, time.Duration(timeout)*time.Second)
+	if runErr != nil && ctx.Err() == nil {
+		return runErr
+	}
+
+	var reports []AXFRReport
+	var hosts []string
+	var records []hostRecord
+	index := make(map[string]int)
+	for _, t := range transfers {
+		report := AXFRReport{Zone: domain, Nameserver: t.Nameserver, Addr: t.Addr, Names: len(t.Names)}
+		var rcodeErr *subkill3r.RcodeError
+		if errors.As(t.Err, &rcodeErr) {
+			report.Error = t.Err.Error()
+			report.Rcode = rcodeErr.Error()
+			log.Info("AXFR refused by %s (%s)", t.Nameserver, report.Rcode)
+		} else if t.Err != nil {
+			report.Error = t.Err.Error()
+			log.Warning("AXFR against %s failed: %v", t.Nameserver, t.Err)
+		} else {
+			report.Allowed = true
+			log.Warning(color.RedString("Zone transfer of %s allowed by %s (%s), %v names received", domain, t.Nameserver, t.Addr, len(t.Names)))
+		}
+		reports = append(reports, report)
+
+		for name, answers := range t.Names {
+			// Keep the hosts of the zone, wildcard owners are not hosts
+			if name == domain || !strings.HasSuffix(name, "."+domain) || strings.HasPrefix(name, "*.") {
+				continue
+			}
+			i, ok := index[name]
+			if !ok {
+				hosts = append(hosts, name)
+				index[name] = len(records)
+				records = append(records, hostRecord{Host: name})
+				i = len(records) - 1
+			}
+			for _, r := range answers {
+				switch r.Type {
+				case "A", "AAAA":
+					if !containsString(records[i].IPs, r.Value) {
+						records[i].IPs = append(records[i].IPs, r.Value)
+					}
+				case "CNAME":
+					if !containsString(records[i].CNAMEs, r.Value) {
+						records[i].CNAMEs = append(records[i].CNAMEs, r.Value)
+					}
+				}
+			}
+			records[i].Records = mergeRecords(records[i].Records, otherRecords(answers))
+		}
+	}
+
+	// Write the attempts, the names and their DNS answers
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err == nil {
+		err = os.WriteFile(strings.TrimSuffix(filePath, filepath.Ext(filePath))+".json", data, 0644)
+	}
+	if err != nil {
+		log.Warning("Failed to write AXFR report: %v", err)
+	}
+	recordsPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".jsonl"
+	if err := writeHostRecords(recordsPath, records); err != nil {
+		log.Warning("Failed to write DNS answers to %s: %v", recordsPath, err)
+	}
+	if len(hosts) > 0 {
+		if err := utils.AppendToFile(filePath, []byte(strings.Join(hosts, "\n")+"\n")); err != nil {
+			log.Warning("Error appending to file %s: %v", filePath, err)
+		}
+	}
+	log.Info("%v subdomain found by AXFR!", len(hosts))
+
+	if runErr != nil {
+		return runErr
+	}
+
+	log.Info("AXFR executed successfully")
+
+	return nil
+}
+
+// ZoneWalkReport is the outcome of a zone walk as written to passive_sources/zonewalk.json
+type ZoneWalkReport struct {
+	Zone     string                 `json:"zone"`
+	Denial   string                 `json:"denial"`
+	Complete bool                   `json:"complete"`
+	Queries  int                    `json:"queries"`
+	Names    int                    `json:"names"`
+	NSEC3    *subkill3r.NSEC3Params `json:"nsec3,omitempty"`
+	// Hashes lists every NSEC3 hash with the name it was cracked to, if any
+	Hashes []NSEC3Hash `json:"hashes,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type NSEC3Hash struct {
+	Hash string `json:"hash"`
+	Name string `json:"name,omitempty"`
+}
+
+// RunZoneWalk enumerates domain from its NSEC chain, or from its NSEC3 chain by
+// cracking the hashes against the wordlists, and writes the names to filePath
+func RunZoneWalk(ctx context.Context, domain, filePath, serverAddr, resolvers string, wordlists []string, workerCount, retries, maxQueries int) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running zone walk")
+
+	// printing the execution time
+	startTime := time.Now()
+	defer utils.LogElapsedTime(log, startTime, "zone walk")
+
+	pool, err := newResolverPool(log, serverAddr, resolvers, retries)
+	if err != nil {
+		return err
+	}
+
+	walk, runErr := pool.WalkZone(ctx, domain, maxQueries)
+	report := ZoneWalkReport{Zone: walk.Zone, Denial: walk.Denial, Complete: walk.Complete, Queries: walk.Queries}
+
+	var names []string
+	switch walk.Denial {
+	case "":
+		log.Info("%s is not DNSSEC signed, or the resolvers do not pass NSEC records", domain)
+	case "NSEC":
+		names = walk.Names
+		log.Info("Walked %v names of the NSEC chain of %s in %v queries", len(names), domain, walk.Queries)
+	case "NSEC3":
+		report.NSEC3 = &walk.NSEC3
+		log.Info("Collected %v NSEC3 hashes of %s in %v queries, cracking them against %v wordlists", len(walk.Hashes), domain, walk.Queries, len(wordlists))
+		cracked, err := walk.Crack(ctx, wordlists, workerCount)
+		if err != nil && runErr == nil {
+			runErr = err
+		}
+		for _, h := range walk.Hashes {
+			report.Hashes = append(report.Hashes, NSEC3Hash{Hash: h, Name: cracked[h]})
+			if cracked[h] != "" {
+				names = append(names, cracked[h])
+			}
+		}
+		log.Info("%v of %v NSEC3 hashes cracked", len(names), len(walk.Hashes))
+	}
+	if walk.Denial != "" && !walk.Complete {
+		log.Warning("The %s chain of %s is incomplete after %v queries, look for ZONEWALK_MAX_QUERIES in config file", walk.Denial, domain, walk.Queries)
+	}
+
+	// Wildcard owners are not hosts
+	var hosts []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, "*.") {
+			hosts = append(hosts, name)
+		}
+	}
+	report.Names = len(hosts)
+	if runErr != nil {
+		report.Error = runErr.Error()
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(strings.TrimSuffix(filePath, filepath.Ext(filePath))+".json", data, 0644)
+	}
+	if err != nil {
+		log.Warning("Failed to write zone walk report: %v", err)
+	}
+	if len(hosts) > 0 {
+		if err := utils.AppendToFile(filePath, []byte(strings.Join(hosts, "\n")+"\n")); err != nil {
+			log.Warning("Error appending to file %s: %v", filePath, err)
+		}
+	}
+	log.Info("%v subdomain found by zone walk!", len(hosts))
+
+	if runErr != nil {
+		return runErr
+	}
+
+	log.Info("Zone walk executed successfully")
+
+	return nil
+}
+
+// writeResolverStats logs a summary of the resolver pool and writes the per-resolver statistics to path.
+func writeResolverStats(log logger.Logger, path string, pool *subkill3r.ResolverPool) error {
+	stats := pool.Stats()
+
+	var queries, successes, lied, disabled int64
+	for _, s := range stats {
+		queries += s.Queries
+		successes += s.Successes
+		if s.Lied {
+			lied++
+		}
+		if s.Disabled {
+			disabled++
+		}
+	}
+	log.Info("%v resolvers used, %v queries sent, %v answered", len(stats), queries, successes)
+	log.Info("%v resolvers dropped (%v lying), %v still healthy", disabled, lied, pool.Healthy())
 
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// passiveSource is a single passive enumeration tool writing to its own file
+type passiveSource struct {
+	name  string
+	fatal bool
+	// first sources run before the others start
+	first bool
+	run   func(ctx context.Context, filePath string) error
+}
+
+// sourceReport holds the outcome of a passive source
+type sourceReport struct {
+	name     string
+	filePath string
+	elapsed  time.Duration
+	err      error
+	found    int
+	unique   int
+}
+
+// passiveSources returns the enabled passive sources for cfg
+func passiveSources(log logger.Logger, cfg PassiveEnum) []passiveSource {
 	// FATAL inital foothold for subd enum (can be altered later)
-	if err := RunSubfinder(cfg.Domain, cfg.FilePath, cfg.Subfinder.NumOfThreads); err != nil {
-		return fmt.Errorf(color.RedString("Error running subfinder for domain %s: %v\n", cfg.Domain, err))
+	sources := []passiveSource{
+		{
+			name:  "subfinder",
+			fatal: true,
+			run: func(ctx context.Context, filePath string) error {
+				return RunSubfinder(ctx, cfg.Domain, filePath, cfg.Subfinder.NumOfThreads)
+			},
+		},
 	}
 
 	if cfg.EnableAssetfinder {
+		sources = append(sources, passiveSource{
+			name: "assetfinder",
+			run: func(ctx context.Context, filePath string) error {
+				return RunAssetfinder(ctx, cfg.Domain, filePath)
+			},
+		})
+	}
 
-		if err := RunAssetfinder(cfg.Domain, cfg.FilePath); err != nil {
-			myLogger.Error("Error running assetfinder for domain %s: %v\n", cfg.Domain, err)
+	if cfg.EnableAmass {
+		sources = append(sources, passiveSource{
+			name: "amass",
+			run: func(ctx context.Context, filePath string) error {
+				return RunAmass(ctx, cfg.Domain, filePath, cfg.Amass.Timeout)
+			},
+		})
+	}
+
+	// A zone transfer is cheap and, when allowed, beats every wordlist
+	if cfg.EnableAXFR {
+		sources = append(sources, passiveSource{
+			name:  "axfr",
+			first: true,
+			run: func(ctx context.Context, filePath string) error {
+				return RunAXFR(ctx, cfg.Domain, filePath, cfg.Subkill3r.ServerAddr, cfg.Subkill3r.Resolvers, cfg.Subkill3r.Retries, cfg.AXFR.Timeout)
+			},
+		})
+	}
+
+	if cfg.EnableZoneWalk {
+		sources = append(sources, passiveSource{
+			name: "zonewalk",
+			run: func(ctx context.Context, filePath string) error {
+				return RunZoneWalk(ctx, cfg.Domain, filePath, cfg.Subkill3r.ServerAddr, cfg.Subkill3r.Resolvers, cfg.ZoneWalk.Wordlists, cfg.Subkill3r.WorkerCount, cfg.Subkill3r.Retries, cfg.ZoneWalk.MaxQueries)
+			},
+		})
+	}
+
+	if cfg.EnableSubkill3r {
+		if cfg.Subkill3r.Wordlist != "none" {
+			sources = append(sources, passiveSource{
+				name: "subkill3r",
+				run: func(ctx context.Context, filePath string) error {
+					err := RunSubkill3r(ctx, cfg.Domain, filePath, filepath.Join(cfg.OutDirPath, DanglingFileName), cfg.Subkill3r.Wordlist, cfg.Subkill3r.ServerAddr, cfg.Subkill3r.Resolvers, cfg.Subkill3r.RecordTypes, cfg.Subkill3r.WorkerCount, cfg.Subkill3r.Retries)
+					if err != nil && ctx.Err() == nil {
+						logger.FromContext(ctx).Warning("Look for SUBKILL3R_WORDLIST in config file to specify a wordlist\n")
+					}
+					return err
+				},
+			})
+		} else {
+			log.Warning("subkill3r is not activated because wordlist is not provided\n")
 		}
 	}
 
-	if cfg.EnableAmass {
+	return sources
+}
+
+// countSourceFinds sets the number of subdomains each source found, and how many of them no other source found
+func countSourceFinds(reports []*sourceReport) {
+	seenBy := make(map[string]int)
+	perSource := make([]map[string]bool, len(reports))
 
-		if err := RunAmass(cfg.Domain, cfg.FilePath, cfg.Amass.Timeout); err != nil {
-			myLogger.Error("Error running amass for cfg.Domain %s: %v\n", cfg.Domain, err)
+	for i, r := range reports {
+		perSource[i] = make(map[string]bool)
+		file, err := os.Open(r.filePath)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			host := utils.NormalizeHost(scanner.Text())
+			if host == "" || perSource[i][host] {
+				continue
+			}
+			perSource[i][host] = true
+			seenBy[host]++
 		}
+		file.Close()
 	}
 
-	if cfg.EnableSubkill3r {
+	for i, r := range reports {
+		r.found = len(perSource[i])
+		for host := range perSource[i] {
+			if seenBy[host] == 1 {
+				r.unique++
+			}
+		}
+	}
+}
 
-		if cfg.Subkill3r.Wordlist != "none" {
-			if err := RunSubkill3r(cfg.Domain, cfg.FilePath, cfg.Subkill3r.Wordlist, cfg.Subkill3r.ServerAddr, cfg.Subkill3r.WorkerCount); err != nil {
-				myLogger.Error("Error running subkill3r for cfg.Domain %s: %v", cfg.Domain, err)
-				myLogger.Warning("Look for SUBKILL3R_WORDLIST in config file to specify a wordlist\n")
+func InitSubdEnum(ctx context.Context, cfg PassiveEnum) error {
+	log := logger.FromContext(ctx)
+	modName := "PASSIVE_ENUM"
+	log.Info(color.CyanString("%s module initialized\n", modName))
+
+	// Every source writes to its own file, they are merged once all of them finish
+	sourcesDir := filepath.Join(cfg.OutDirPath, "passive_sources")
+	if err := os.MkdirAll(sourcesDir, 0755); err != nil {
+		return fmt.Errorf("Error while creating the directory passive_sources: %v", err)
+	}
+
+	sources := passiveSources(log, cfg)
+	reports := make([]*sourceReport, len(sources))
+
+	// Show progress
+	utils.ShowProgress()
+
+	// Run the enabled sources concurrently, once the ones running first are done
+	for _, first := range []bool{true, false} {
+		var wg sync.WaitGroup
+		for i, src := range sources {
+			if src.first != first {
+				continue
 			}
-		} else {
-			myLogger.Warning("subkill3r is not activated because wordlist is not provided\n")
+			reports[i] = &sourceReport{
+				name:     src.name,
+				filePath: filepath.Join(sourcesDir, src.name+".txt"),
+			}
+
+			wg.Add(1)
+			go func(src passiveSource, r *sourceReport) {
+				defer wg.Done()
+				startTime := time.Now()
+				log := logger.With(log, logger.Fields{"stage": src.name})
+				log.Debug("Running %s", src.name)
+				r.err = src.run(logger.NewContext(ctx, log), r.filePath)
+				r.elapsed = time.Since(startTime)
+				// Tools print names in any case and order, with wildcards and junk
+				if _, err := os.Stat(r.filePath); err == nil {
+					if err := utils.RemoveDuplicatesFromFile(r.filePath); err != nil {
+						log.Warning("Failed to normalize the output of %s: %v", src.name, err)
+					}
+				}
+				if r.err != nil {
+					log.Error("Error running %s for domain %s: %v\n", src.name, cfg.Domain, r.err)
+				}
+			}(src, reports[i])
 		}
+		wg.Wait()
 	}
 
-	// Count total enumerated subdomains
+	// Keep amass and assetfinder from pulling unrelated hosts into the run, every
+	// output built from the sources below only sees the hosts in scope
+	if cfg.Scope != nil {
+		for _, r := range reports {
+			if err := applyScope(ctx, cfg.Scope, r.filePath, cfg.OutDirPath); err != nil {
+				if ctx.Err() == nil {
+					return fmt.Errorf(color.RedString("%s module failed: %v", modName, err))
+				}
+				continue
+			}
+			if err := scopeSidecar(ctx, cfg.Scope, r.filePath); err != nil {
+				log.Warning("Failed to apply scope to the DNS answers of %s: %v", r.name, err)
+			}
+		}
+	}
+
+	// Report per-source timing and finds
+	countSourceFinds(reports)
+	for _, r := range reports {
+		status := "ok"
+		if r.err != nil {
+			status = "failed"
+		}
+		log.Info("%-12s %-7s %10s  %6v found  %6v unique", r.name, status, r.elapsed.Round(time.Millisecond), r.found, r.unique)
+	}
+
+	// Merge the source files into a single sorted list
+	var sourceFiles []string
+	for _, r := range reports {
+		sourceFiles = append(sourceFiles, filepath.Join("passive_sources", filepath.Base(r.filePath)))
+	}
+	if err := utils.MergeFiles(log, cfg.OutDirPath, filepath.Base(cfg.FilePath), sourceFiles); err != nil {
+		return fmt.Errorf(color.RedString("%s module failed: error merging source files: %v", modName, err))
+	}
+
+	// Merge the DNS answers of the sources
+	if hosts, err := WriteDNSRecords(log, cfg.OutDirPath); err != nil {
+		log.Warning("Failed to write %s: %v", DNSRecordsFileName, err)
+	} else {
+		log.Info("DNS records of %v hosts written to %s", hosts, DNSRecordsFileName)
+	}
+
+	// Count unique subdomains, the merge drops the duplicates
 	subCount, err := utils.CountLines(cfg.FilePath)
 	if err != nil {
-		myLogger.Error("\rError measuring enumerated subdomains: %v ", err)
+		log.Warning("\rError measuring enumerated subdomains: %v ", err)
 	}
-	myLogger.Info("%v total subdomains gathered", subCount)
+	log.Info("%v unique subdomains gathered\n", subCount)
 
-	// Removing duplicates: FATAL
-	if err := utils.RemoveDuplicatesFromFile(cfg.FilePath); err != nil {
-		return fmt.Errorf(color.RedString("%s module failed: error removing duplicates from the file %s: %v ", modName, cfg.FilePath, err))
+	danglingPath := filepath.Join(cfg.OutDirPath, DanglingFileName)
+	if _, err := os.Stat(danglingPath); err == nil {
+		if err := applyScope(ctx, cfg.Scope, danglingPath, cfg.OutDirPath); err != nil && ctx.Err() == nil {
+			return fmt.Errorf(color.RedString("%s module failed: %v", modName, err))
+		}
 	}
-	myLogger.Info("Removing duplicates from %s", cfg.FilePath)
 
-	// Count unique subdomains
-	subCount, err = utils.CountLines(cfg.FilePath)
-	if err != nil {
-		myLogger.Warning("\rError measuring enumerated subdomains: %v ", err)
+	// Stop here if interrupted, the results gathered so far are already on disk
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s module interrupted: %w", modName, ctx.Err())
+	}
+
+	// A failed foothold source fails the module
+	for i, r := range reports {
+		if r.err != nil && sources[i].fatal {
+			return fmt.Errorf(color.RedString("Error running %s for domain %s: %v\n", r.name, cfg.Domain, r.err))
+		}
 	}
-	myLogger.Info("%v unique subdomains gathered\n", subCount)
 
-	myLogger.Info(color.CyanString("%s module completed\n", modName))
+	log.Info(color.CyanString("%s module completed\n", modName))
 
 	return nil
 }
@@ -0,0 +1,85 @@
+package mods
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/notify"
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+)
+
+// RunPipeline runs modules in order, skipping the ones the run state records as
+// finished with the same config. Once a module runs, every module after it runs too.
+// A module gets the logger of env with its name attached, in its env and its context.
+func RunPipeline(ctx context.Context, env *Env, modules []Module, state *utils.RunState) error {
+	rerun := false
+
+	targetLog := env.Log
+	if targetLog == nil {
+		targetLog = logger.With(logger.FromContext(ctx), logger.Fields{"target": env.Domain})
+	}
+
+	for _, m := range modules {
+		log := logger.With(targetLog, logger.Fields{"module": m.Name()})
+		hash := configHash(m, env)
+		if !rerun && state.IsDone(m.Name(), hash) {
+			log.Info("Skipping %s module, already completed", m.Name())
+			continue
+		}
+		rerun = true
+
+		// Drop leftovers of a previous attempt so the module starts clean
+		for _, output := range m.Outputs() {
+			if err := os.RemoveAll(filepath.Join(env.OutDirPath, output)); err != nil {
+				log.Warning("Failed to remove previous output %s: %v", output, err)
+			}
+		}
+		if err := env.Store.DeleteStage(m.Name()); err != nil {
+			log.Warning("Failed to remove previous results of %s from the database: %v", m.Name(), err)
+		}
+
+		// The rows the module stores are tagged with its name
+		stageEnv := *env
+		stageEnv.Store = env.Store.Stage(m.Name())
+		stageEnv.Log = log
+
+		log.Debug("Running %s module", m.Name())
+		startTime := time.Now()
+		err := m.Run(logger.NewContext(ctx, log), &stageEnv)
+		if ctx.Err() != nil {
+			if err := state.Interrupt(m.Name(), hash); err != nil {
+				log.Warning("Failed to save run state: %v", err)
+			}
+			return fmt.Errorf("%s module interrupted: %w", m.Name(), ctx.Err())
+		}
+		if err := state.Finish(m.Name(), hash, m.Outputs(), err); err != nil {
+			log.Warning("Failed to save run state: %v", err)
+		}
+		if err != nil {
+			env.Notifier.Notify(ctx, notify.Event{
+				Type:    notify.StageFailed,
+				Domain:  env.Domain,
+				RunDir:  env.OutDirPath,
+				Stage:   m.Name(),
+				Message: fmt.Sprintf("%s module failed: %v", m.Name(), err),
+			})
+			return fmt.Errorf("%s module failed: %w", m.Name(), err)
+		}
+		log.Info("%s module finished in %s", m.Name(), time.Since(startTime).Round(time.Second))
+	}
+
+	return nil
+}
+
+// configHash hashes the part of the config m depends on, or the whole config when m doesn't say.
+// The workspace is left out, the files extracted to it are the same on every run.
+func configHash(m Module, env *Env) string {
+	if c, ok := m.(Configurable); ok {
+		return utils.ConfigHash(c.Config(env), env.Workspace)
+	}
+	return utils.ConfigHash(env.Config, env.Workspace)
+}
@@ -0,0 +1,59 @@
+package mods
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+)
+
+// countingModule counts its runs, its config holds paths in the workspace
+type countingModule struct{ runs int }
+
+func (m *countingModule) Name() string      { return "counting" }
+func (m *countingModule) Inputs() []string  { return nil }
+func (m *countingModule) Outputs() []string { return nil }
+
+func (m *countingModule) Config(env *Env) interface{} {
+	return map[string]string{"wordlist": env.Config.BruteforceWordlist, "temp": env.TempDir}
+}
+
+func (m *countingModule) Run(ctx context.Context, env *Env) error {
+	m.runs++
+	return nil
+}
+
+func TestRunPipelineResume(t *testing.T) {
+	dir := t.TempDir()
+	state, err := utils.NewRunState(dir, "ex.test", "embedded", "", []string{"counting"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every run extracts the default wordlist to a workspace of its own
+	newEnv := func(workspace, wordlist string) *Env {
+		env := &Env{Domain: "ex.test", OutDirPath: dir, Workspace: workspace, TempDir: filepath.Join(workspace, filepath.Base(dir))}
+		env.Config.BruteforceWordlist = wordlist
+		return env
+	}
+	m := &countingModule{}
+	steps := []struct {
+		name string
+		env  *Env
+		runs int
+	}{
+		{"first run", newEnv("/tmp/r3conwhal3-111", "/tmp/r3conwhal3-111/subdomains-top-20k.txt"), 1},
+		{"resumed in a new workspace", newEnv("/tmp/r3conwhal3-222", "/tmp/r3conwhal3-222/subdomains-top-20k.txt"), 1},
+		{"resumed with another wordlist", newEnv("/tmp/r3conwhal3-333", "/opt/words.txt"), 2},
+	}
+
+	for _, step := range steps {
+		if err := RunPipeline(context.Background(), step.env, []Module{m}, state); err != nil {
+			t.Fatal(err)
+		}
+		if m.runs != step.runs {
+			t.Errorf("%s: module ran %v times, want %v", step.name, m.runs, step.runs)
+		}
+	}
+}
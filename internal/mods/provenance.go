@@ -0,0 +1,221 @@
+package mods
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/subkill3r"
+)
+
+// ProvenanceFileName is written next to ultimate_subdomains.txt
+const ProvenanceFileName = "subdomains_provenance.jsonl"
+
+// Provenance records which sources found a host, when it was first seen and what it resolved to
+type Provenance struct {
+	Host      string    `json:"host"`
+	Sources   []string  `json:"sources"`
+	FirstSeen time.Time `json:"first_seen"`
+	IPs       []string  `json:"ips,omitempty"`
+	CNAMEs    []string  `json:"cnames,omitempty"`
+	// Records holds the MX, NS, TXT and SOA answers of the host
+	Records []subkill3r.Record `json:"records,omitempty"`
+}
+
+// hostRecord is a line of the JSONL files sources write next to their host lists,
+// and of the DNS records output merging them
+type hostRecord struct {
+	Host    string             `json:"host"`
+	IPs     []string           `json:"ips,omitempty"`
+	CNAMEs  []string           `json:"cnames,omitempty"`
+	Records []subkill3r.Record `json:"records,omitempty"`
+}
+
+// provenanceSources maps the host lists outside passive_sources to the source that produced them
+var provenanceSources = map[string]string{
+	"active_enum_subdomains.txt": "bruteforce",
+	RecursiveFileName:            "subkill3r-recursive",
+	"resolved_subs.txt":          "permutation",
+}
+
+// WriteProvenance builds a provenance record for every host in ultimate_subdomains.txt
+// from the source files of the run and writes them as JSONL.
+func WriteProvenance(log logger.Logger, outDirPath string) (int, error) {
+	records := make(map[string]*Provenance)
+
+	// Collect the host lists of every source
+	sourceFiles := make(map[string]string)
+	passiveFiles, _ := filepath.Glob(filepath.Join(outDirPath, "passive_sources", "*.txt"))
+	for _, path := range passiveFiles {
+		sourceFiles[path] = strings.TrimSuffix(filepath.Base(path), ".txt")
+	}
+	for name, source := range provenanceSources {
+		sourceFiles[filepath.Join(outDirPath, name)] = source
+	}
+
+	for path, source := range sourceFiles {
+		if err := readSourceHosts(path, source, records); err != nil {
+			log.Warning("Failed to read %s: %v", path, err)
+		}
+	}
+
+	// Attach the DNS answers recorded on the way
+	dnsPath := filepath.Join(outDirPath, DNSRecordsFileName)
+	if err := readHostRecords(dnsPath, records); err != nil && !os.IsNotExist(err) {
+		log.Warning("Failed to read %s: %v", dnsPath, err)
+	}
+
+	// Write a record for every host that made it to the final list
+	hosts, err := os.Open(filepath.Join(outDirPath, "ultimate_subdomains.txt"))
+	if err != nil {
+		return 0, err
+	}
+	defer hosts.Close()
+
+	out, err := os.Create(filepath.Join(outDirPath, ProvenanceFileName))
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	writer := bufio.NewWriter(out)
+	encoder := json.NewEncoder(writer)
+	count := 0
+
+	scanner := bufio.NewScanner(hosts)
+	for scanner.Scan() {
+		host := utils.NormalizeHost(scanner.Text())
+		if host == "" {
+			continue
+		}
+		record, ok := records[host]
+		if !ok {
+			record = &Provenance{Host: host, Sources: []string{}}
+		}
+		sort.Strings(record.Sources)
+		if err := encoder.Encode(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, err
+	}
+
+	return count, writer.Flush()
+}
+
+// readSourceHosts adds source to the record of every host listed in path
+func readSourceHosts(path, source string, records map[string]*Provenance) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The source finished writing its list when the file was last modified
+	seen := info.ModTime()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		host := utils.NormalizeHost(scanner.Text())
+		if host == "" {
+			continue
+		}
+		record := provenanceFor(records, host)
+		if !containsString(record.Sources, source) {
+			record.Sources = append(record.Sources, source)
+		}
+		if record.FirstSeen.IsZero() || seen.Before(record.FirstSeen) {
+			record.FirstSeen = seen
+		}
+	}
+
+	return scanner.Err()
+}
+
+// readHostRecords merges the DNS answers of a JSONL host record file into the records
+func readHostRecords(path string, records map[string]*Provenance) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var hr hostRecord
+		if err := json.Unmarshal(scanner.Bytes(), &hr); err != nil {
+			continue
+		}
+		host := utils.NormalizeHost(hr.Host)
+		if host == "" {
+			continue
+		}
+		record := provenanceFor(records, host)
+		for _, ip := range hr.IPs {
+			if !containsString(record.IPs, ip) {
+				record.IPs = append(record.IPs, ip)
+			}
+		}
+		for _, cname := range hr.CNAMEs {
+			cname = utils.NormalizeHost(cname)
+			if cname != "" && !containsString(record.CNAMEs, cname) {
+				record.CNAMEs = append(record.CNAMEs, cname)
+			}
+		}
+		record.Records = mergeRecords(record.Records, hr.Records)
+	}
+
+	return scanner.Err()
+}
+
+// writeHostRecords writes the DNS answers found for each host as JSONL
+func writeHostRecords(path string, records []hostRecord) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+func provenanceFor(records map[string]*Provenance, host string) *Provenance {
+	record, ok := records[host]
+	if !ok {
+		record = &Provenance{Host: host}
+		records[host] = record
+	}
+	return record
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
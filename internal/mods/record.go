@@ -0,0 +1,356 @@
+package mods
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/store"
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/prober"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/subkill3r"
+)
+
+// storeBatchSize is the number of hosts of a list stored in one transaction
+const storeBatchSize = 1000
+
+// The functions below load the files written by a module into the results database.
+// The database only mirrors the files, a failure is logged and never fails the module.
+
+// recordPassive stores the hosts found by every passive source and their DNS answers,
+// the source lists and dns_records.jsonl only hold the hosts in scope
+func recordPassive(log logger.Logger, st *store.Store, outDirPath string) {
+	if st == nil {
+		return
+	}
+
+	sourceFiles, _ := filepath.Glob(filepath.Join(outDirPath, "passive_sources", "*.txt"))
+	for _, path := range sourceFiles {
+		recordHostList(log, st, path, strings.TrimSuffix(filepath.Base(path), ".txt"))
+	}
+
+	recordHostRecords(log, st, filepath.Join(outDirPath, DNSRecordsFileName))
+	recordZoneTransfers(log, st, filepath.Join(outDirPath, "passive_sources", "axfr.json"))
+}
+
+// recordZoneTransfers stores every nameserver that allowed a zone transfer as a finding
+func recordZoneTransfers(log logger.Logger, st *store.Store, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warning("Failed to store zone transfers: %v", err)
+		}
+		return
+	}
+
+	var reports []AXFRReport
+	if err := json.Unmarshal(data, &reports); err != nil {
+		log.Warning("Failed to parse zone transfers: %v", err)
+		return
+	}
+
+	var findings []store.Finding
+	for _, r := range reports {
+		if !r.Allowed {
+			continue
+		}
+		findings = append(findings, store.Finding{
+			Host:     r.Zone,
+			Type:     "zone-transfer",
+			Severity: "high",
+			Source:   "axfr",
+			Detail:   fmt.Sprintf("%s (%s) transferred %v names", r.Nameserver, r.Addr, r.Names),
+		})
+	}
+	if err := st.AddFindings(findings); err != nil {
+		log.Warning("Failed to store zone transfers: %v", err)
+	}
+}
+
+// recordActive stores the hosts found by brute-forcing and permutations
+func recordActive(log logger.Logger, st *store.Store, outDirPath string) {
+	if st == nil {
+		return
+	}
+
+	for name, source := range provenanceSources {
+		recordHostList(log, st, filepath.Join(outDirPath, name), source)
+	}
+}
+
+// recordFilter stores the provenance of the final hosts and the live web services
+func recordFilter(log logger.Logger, st *store.Store, outDirPath string) {
+	if st == nil {
+		return
+	}
+
+	var hosts []store.Host
+	var records []store.DNSRecord
+	err := readJSONLines(filepath.Join(outDirPath, ProvenanceFileName), func(line []byte) {
+		var p Provenance
+		if json.Unmarshal(line, &p) != nil {
+			return
+		}
+		hosts = append(hosts, store.Host{Name: p.Host, Sources: p.Sources, FirstSeen: p.FirstSeen})
+		records = append(records, dnsRecords(p.Host, p.IPs, p.CNAMEs, p.Records)...)
+	})
+	if err == nil {
+		err = st.AddHosts(hosts)
+	}
+	if err == nil {
+		err = st.AddDNSRecords(records)
+	}
+	if err != nil {
+		log.Warning("Failed to store subdomain provenance: %v", err)
+	}
+
+	var live []string
+	var services []store.HTTPService
+	err = readJSONLines(filepath.Join(outDirPath, HTTPProbeFileName), func(line []byte) {
+		var r prober.Result
+		if json.Unmarshal(line, &r) != nil {
+			return
+		}
+		live = append(live, r.Host)
+		services = append(services, store.HTTPService{
+			URL:           r.URL,
+			Host:          r.Host,
+			StatusCode:    r.StatusCode,
+			Title:         r.Title,
+			ContentLength: int(r.ContentLength),
+			Webserver:     r.Server,
+		})
+	})
+	if err != nil {
+		log.Warning("Failed to store live subdomains: %v", err)
+		return
+	}
+
+	if err := st.MarkLive(live); err != nil {
+		log.Warning("Failed to store live subdomains: %v", err)
+	}
+	if err := st.AddHTTPServices(services); err != nil {
+		log.Warning("Failed to store web services: %v", err)
+	}
+}
+
+// recordWebOps stores the screenshots taken and the paths found by ffuf
+func recordWebOps(log logger.Logger, st *store.Store, cfg WebOps) {
+	if st == nil {
+		return
+	}
+
+	// gowitness names screenshots after the URL, e.g. https-sub.example.com.png
+	shotFiles, _ := filepath.Glob(filepath.Join(cfg.OutDirPath, "screenshots", "*.png"))
+	var shots []store.Screenshot
+	for _, path := range shotFiles {
+		name := strings.TrimSuffix(filepath.Base(path), ".png")
+		rawURL := name
+		for _, scheme := range []string{"https", "http"} {
+			if strings.HasPrefix(name, scheme+"-") {
+				rawURL = scheme + "://" + strings.TrimPrefix(name, scheme+"-")
+				break
+			}
+		}
+		shots = append(shots, store.Screenshot{Path: path, Host: hostOfURL(rawURL), URL: rawURL})
+	}
+	if err := st.AddScreenshots(shots); err != nil {
+		log.Warning("Failed to store screenshots: %v", err)
+	}
+
+	// Only the JSON output of ffuf can be parsed
+	if cfg.FFUF.OutputFormat != "json" {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.OutDirPath, "web_ops", cfg.FFUF.Output+".json"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warning("Failed to store ffuf results: %v", err)
+		}
+		return
+	}
+
+	var out struct {
+		Results []struct {
+			Input         map[string]string `json:"input"`
+			URL           string            `json:"url"`
+			Status        int               `json:"status"`
+			Length        int               `json:"length"`
+			Words         int               `json:"words"`
+			Lines         int               `json:"lines"`
+			Host          string            `json:"host"`
+			ContentLength int               `json:"content-length"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		log.Warning("Failed to parse ffuf results: %v", err)
+		return
+	}
+
+	var hits []store.FuzzHit
+	for _, r := range out.Results {
+		host := r.Host
+		if host == "" {
+			host = hostOfURL(r.URL)
+		}
+		hits = append(hits, store.FuzzHit{
+			URL:           r.URL,
+			Host:          utils.NormalizeHost(strings.Split(host, ":")[0]),
+			Path:          "/" + r.Input["FUZZDIR"],
+			StatusCode:    r.Status,
+			ContentLength: r.Length,
+			Words:         r.Words,
+			Lines:         r.Lines,
+		})
+	}
+	if err := st.AddFuzzHits(hits); err != nil {
+		log.Warning("Failed to store ffuf results: %v", err)
+	}
+}
+
+// recordVulnScan stores the subdomain takeover findings
+func recordVulnScan(log logger.Logger, st *store.Store, outDirPath string) {
+	if st == nil {
+		return
+	}
+
+	found, err := takeoverFindings(outDirPath)
+	if err != nil {
+		log.Warning("Failed to store takeover findings: %v", err)
+		return
+	}
+
+	var findings []store.Finding
+	for _, f := range found {
+		findings = append(findings, store.Finding{
+			Host:     f.Subdomain,
+			Type:     "subdomain-takeover",
+			Severity: f.Confidence,
+			Source:   "takeover",
+			Detail:   f.Service,
+		})
+	}
+	if err := st.AddFindings(findings); err != nil {
+		log.Warning("Failed to store takeover findings: %v", err)
+	}
+}
+
+// recordHostList stores every host listed in path as found by source, storeBatchSize hosts at a time
+func recordHostList(log logger.Logger, st *store.Store, path, source string) {
+	seen, _ := os.Stat(path)
+	hosts := make([]store.Host, 0, storeBatchSize)
+	flush := func() error {
+		err := st.AddHosts(hosts)
+		hosts = hosts[:0]
+		return err
+	}
+
+	err := utils.ScanLines(path, func(line string) error {
+		h := store.Host{Name: utils.NormalizeHost(line), Sources: []string{source}}
+		if h.Name == "" {
+			return nil
+		}
+		if seen != nil {
+			h.FirstSeen = seen.ModTime()
+		}
+		hosts = append(hosts, h)
+		if len(hosts) < storeBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(hosts) > 0 {
+		err = flush()
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Warning("Failed to store hosts of %s: %v", path, err)
+	}
+}
+
+// recordHostRecords stores the DNS answers of a JSONL host record file
+func recordHostRecords(log logger.Logger, st *store.Store, path string) {
+	var records []store.DNSRecord
+	err := readJSONLines(path, func(line []byte) {
+		var hr hostRecord
+		if json.Unmarshal(line, &hr) != nil {
+			return
+		}
+		records = append(records, dnsRecords(utils.NormalizeHost(hr.Host), hr.IPs, hr.CNAMEs, hr.Records)...)
+	})
+	if err == nil {
+		err = st.AddDNSRecords(records)
+	}
+	if err != nil {
+		log.Warning("Failed to store DNS records of %s: %v", path, err)
+	}
+}
+
+func dnsRecords(host string, ips, cnames []string, others []subkill3r.Record) []store.DNSRecord {
+	var records []store.DNSRecord
+	for _, ip := range ips {
+		recordType := "A"
+		if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+			recordType = "AAAA"
+		}
+		records = append(records, store.DNSRecord{Host: host, Type: recordType, Value: ip})
+	}
+	for _, cname := range cnames {
+		if cname = utils.NormalizeHost(cname); cname == "" {
+			continue
+		}
+		records = append(records, store.DNSRecord{Host: host, Type: "CNAME", Value: cname})
+	}
+	for _, r := range others {
+		records = append(records, store.DNSRecord{Host: host, Type: r.Type, Value: r.Value})
+	}
+	return records
+}
+
+// hostOfURL returns the host name of a URL, a bare host is returned as is
+func hostOfURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		return utils.NormalizeHost(strings.Split(rawURL, "/")[0])
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return utils.NormalizeHost(rawURL)
+	}
+	return utils.NormalizeHost(u.Hostname())
+}
+
+// readLines returns the non-empty lines of the file at path, for the lists a module needs whole
+func readLines(path string) ([]string, error) {
+	var lines []string
+	err := utils.ScanLines(path, func(line string) error {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+		return nil
+	})
+
+	return lines, err
+}
+
+// readJSONLines calls fn with every line of the JSONL file at path
+func readJSONLines(path string, fn func(line []byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fn(scanner.Bytes())
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,42 @@
+package mods
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/store"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+)
+
+func TestRecordHostList(t *testing.T) {
+	dir := t.TempDir()
+	st, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	// More hosts than a batch, with blank lines and invalid names in between
+	var list strings.Builder
+	for i := 0; i < 2*storeBatchSize+10; i++ {
+		fmt.Fprintf(&list, "H%d.ex.test.\n\nbad host\n", i)
+	}
+	path := filepath.Join(dir, "subfinder.txt")
+	if err := os.WriteFile(path, []byte(list.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recordHostList(logger.GetLogger(), st.Stage("passive"), path, "subfinder")
+	recordHostList(logger.GetLogger(), st.Stage("passive"), filepath.Join(dir, "missing.txt"), "amass")
+
+	_, rows, err := st.Query("SELECT COUNT(*) FROM hosts WHERE name LIKE 'h%.ex.test'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprint(2*storeBatchSize + 10); rows[0][0] != want {
+		t.Errorf("hosts stored = %v, want %v", rows[0][0], want)
+	}
+}
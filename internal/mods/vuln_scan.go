@@ -1,148 +1,250 @@
 package mods
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/LiterallyEthical/r3conwhal3/internal/notify"
 	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/subkill3r"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/takeover"
 	"github.com/fatih/color"
 )
 
+// TakeoverFileName lists the subdomain takeover findings in the vuln_scan directory
+const TakeoverFileName = "subdomain_takeover_scan.json"
+
 type VulnScan struct {
-	OutdirPath  string
-	Subzy       Subzy
-	EnableSubzy bool
+	OutdirPath     string
+	Takeover       Takeover
+	EnableTakeover bool
+	Scope          *utils.Scope
 }
 
-type Subzy struct {
-	Concurrency int
-	Timeout     int
-	HideFails   bool
-	HTTPS       bool
-	VerifySSL   bool
-	Vuln        bool
+type Takeover struct {
+	Fingerprints string
+	Resolvers    string
+	Retries      int
+	Concurrency  int
+	Timeout      int
 }
 
-type SubzyOutput struct {
-	Subdomain     string `json:"subdomain,omitempty"`
-	Status        string `json:"status,omitempty"`
-	Engine        string `json:"engine,omitempty"`
-	Documentation string `json:"documentation,omitempty"`
-	Discussion    string `json:"discussion,omitempty"`
+func init() {
+	Register(vulnScanModule{})
 }
 
-func RunSubzy(outdirPath string, concurrency, timeout int, hideFails, HTTPS, verifySSL, vuln bool) error {
+// vulnScanModule scans the subdomains for vulnerabilities
+type vulnScanModule struct{}
 
-	myLogger.Info("Running subzy")
+func (vulnScanModule) Name() string { return "vulnscan" }
 
-	// Printing the execution time
-	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "subzy")
+func (vulnScanModule) Inputs() []string {
+	return []string{"ultimate_subdomains.txt", DanglingFileName, DNSRecordsFileName}
+}
 
-	// Show progress
-	utils.ShowProgress()
+func (vulnScanModule) Outputs() []string { return []string{"vuln_scan"} }
 
-	// Prepare the command arguments
-	outFolder := filepath.Join(outdirPath, "vuln_scan")
-	if err := os.Mkdir(outFolder, 0755); err != nil {
-		return fmt.Errorf("Error while creating the directory vuln_scan: %v", err)
-	}
+func (vulnScanModule) Config(env *Env) interface{} { return NewVulnScan(env) }
 
-	outFile := filepath.Join(outFolder, "subdomain_takeover_scan.json")
-	targets := filepath.Join(outdirPath, "live_subdomains.txt")
+func (vulnScanModule) Run(ctx context.Context, env *Env) error {
+	err := InitVulnScan(ctx, NewVulnScan(env))
+	recordVulnScan(env.Log, env.Store, env.OutDirPath)
+	notifyTakeovers(ctx, env)
+	return err
+}
 
-	cmdArgs := []string{
-		"run",
-		"--targets", targets,
-		"--output", outFile,
-		"--concurrency", fmt.Sprint(concurrency),
-		"--timeout", fmt.Sprint(timeout),
+// notifyTakeovers sends a notification listing the subdomains open to takeover
+func notifyTakeovers(ctx context.Context, env *Env) {
+	if env.Notifier == nil {
+		return
 	}
 
-	if hideFails {
-		cmdArgs = append(cmdArgs, "--hide_fails")
+	findings, err := takeoverFindings(env.OutDirPath)
+	if err != nil || len(findings) == 0 {
+		return
 	}
 
-	if HTTPS {
-		cmdArgs = append(cmdArgs, "--https")
+	var hosts []string
+	for _, f := range findings {
+		hosts = append(hosts, fmt.Sprintf("%s [%s, %s confidence]", f.Subdomain, f.Service, f.Confidence))
 	}
+	env.Notifier.Notify(ctx, notify.Event{
+		Type:    notify.Takeover,
+		Domain:  env.Domain,
+		RunDir:  env.OutDirPath,
+		Stage:   vulnScanModule{}.Name(),
+		Message: fmt.Sprintf("%v subdomains vulnerable to subdomain takeover", len(hosts)),
+		Hosts:   hosts,
+	})
+}
 
-	if verifySSL {
-		cmdArgs = append(cmdArgs, "--verify_ssl")
+// takeoverFindings returns the subdomain takeover findings of a run, none if the check did not run
+func takeoverFindings(outDirPath string) ([]takeover.Finding, error) {
+	data, err := os.ReadFile(filepath.Join(outDirPath, "vuln_scan", TakeoverFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	if vuln {
-		cmdArgs = append(cmdArgs, "--vuln")
+	var findings []takeover.Finding
+	if err := json.Unmarshal(data, &findings); err != nil {
+		return nil, err
 	}
 
-	// Convert cmdArgs to []interface{} for RunCommand
-	interfaceArgs := make([]interface{}, len(cmdArgs))
-	for i, arg := range cmdArgs {
-		interfaceArgs[i] = arg
+	return findings, nil
+}
+
+// NewVulnScan sets the VULN_SCAN configs from the environment
+func NewVulnScan(env *Env) VulnScan {
+	config := env.Config
+
+	return VulnScan{
+		OutdirPath:     env.OutDirPath,
+		EnableTakeover: config.EnableTakeover,
+		Scope:          env.Scope,
+		Takeover: Takeover{
+			Fingerprints: config.TakeoverFingerprints,
+			Resolvers:    config.TakeoverResolvers,
+			Retries:      config.TakeoverRetries,
+			Concurrency:  config.TakeoverConcurrency,
+			Timeout:      config.TakeoverTimeout,
+		},
 	}
+}
+
+// RunTakeover checks every subdomain of the run against the fingerprint database
+// and writes the findings with their evidence to vuln_scan/subdomain_takeover_scan.json.
+// Only the DNS records of the hosts in scope are checked.
+func RunTakeover(ctx context.Context, outdirPath string, cfg Takeover, scope *utils.Scope) error {
+	log := logger.FromContext(ctx)
+	log.Info("Running subdomain takeover check")
 
-	// Run gowitness
-	_, err := utils.RunCommand("subzy", interfaceArgs...)
+	// Printing the execution time
+	startTime := time.Now()
+	defer utils.LogElapsedTime(log, startTime, "subdomain takeover check")
+
+	fingerprints, err := takeover.LoadFingerprints(cfg.Fingerprints)
 	if err != nil {
-		return fmt.Errorf("Error while running command subzy: %v", err)
+		return fmt.Errorf("failed to load fingerprints: %v", err)
 	}
 
-	// Read the JSON file
-	file, err := os.Open(outFile)
+	addrs, err := subkill3r.LoadResolvers(cfg.Resolvers)
 	if err != nil {
-		return fmt.Errorf("Failed to open file: %s", err)
+		return fmt.Errorf("failed to load resolvers from %s: %v", cfg.Resolvers, err)
+	}
+	pool, err := subkill3r.NewResolverPool(addrs, cfg.Retries)
+	if err != nil {
+		return err
 	}
-	defer file.Close()
 
-	// Read the file's content
-	byteValue, err := io.ReadAll(file)
+	subdomains, err := readLines(filepath.Join(outdirPath, "ultimate_subdomains.txt"))
 	if err != nil {
-		return fmt.Errorf("Failed to read file: %s", err)
+		return fmt.Errorf("failed to read subdomains: %v", err)
 	}
 
-	// Parse the JSON data
-	var out []SubzyOutput
-	err = json.Unmarshal(byteValue, &out)
+	// Dangling names never make it to the resolved lists, check them too
+	dangling, err := readLines(filepath.Join(outdirPath, DanglingFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read dangling subdomains: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, host := range subdomains {
+		seen[host] = true
+	}
+	for _, host := range dangling {
+		if !seen[host] {
+			seen[host] = true
+			subdomains = append(subdomains, host)
+		}
+	}
+	log.Info("Checking %v subdomains against %v fingerprints", len(subdomains), len(fingerprints))
+
+	outFolder := filepath.Join(outdirPath, "vuln_scan")
+	if err := os.Mkdir(outFolder, 0755); err != nil {
+		return fmt.Errorf("Error while creating the directory vuln_scan: %v", err)
+	}
+
+	checker := takeover.New(fingerprints, pool, takeover.Options{
+		Concurrency: cfg.Concurrency,
+		Timeout:     time.Duration(cfg.Timeout) * time.Second,
+	})
+
+	findings := []takeover.Finding{}
+	checker.Run(ctx, subdomains, func(f takeover.Finding) {
+		findings = append(findings, f)
+	})
+
+	// NS delegations and SPF includes come from the DNS records of the run
+	records, err := scopedDNSRecords(ctx, outdirPath, scope)
 	if err != nil {
-		return fmt.Errorf("Failed to unmarshal JSON: %s", err)
-	}
-
-	// Log the subzy output
-	anyVuln := false
-	subzyLabels := [3]string{"VULNERABLE", "DISCUSSION", "DOCUMENTATION"}
-	for _, o := range out {
-		if o.Status == "vulnerable" {
-			myLogger.Info("The following subdomain flagged as vulnerable to subdomain takeover")
-			myLogger.Info("[ %s ]  -  %s [ %s ]", color.RedString(subzyLabels[0]), o.Subdomain, color.RedString(o.Engine))
-			myLogger.Info("[ %s ]  -  %s", color.YellowString(subzyLabels[1]), o.Discussion)
-			myLogger.Info("[ %s ]  -  %s", color.CyanString(subzyLabels[2]), o.Documentation)
-			anyVuln = true
+		log.Warning("Failed to read %s: %v", DNSRecordsFileName, err)
+	}
+	for _, hr := range records {
+		if ctx.Err() != nil {
+			break
+		}
+		findings = append(findings, checker.CheckRecords(ctx, hr.Host, hr.Records)...)
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Subdomain < findings[j].Subdomain })
+
+	// Keep the findings of an interrupted check
+	data, err := json.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outFolder, TakeoverFileName), data, 0644); err != nil {
+		return fmt.Errorf("Failed to write findings: %v", err)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Log the findings
+	labels := [4]string{"VULNERABLE", "CNAME CHAIN", "EVIDENCE", "DOCUMENTATION"}
+	for _, f := range findings {
+		evidence := f.Snippet
+		if len(f.Records) > 0 {
+			evidence = fmt.Sprintf("%s (%s)", evidence, strings.Join(f.Records, ", "))
+		}
+		if evidence == "" {
+			evidence = fmt.Sprintf("CNAME chain ends in %s", f.Rcode)
 		}
+		log.Info("The following subdomain flagged as vulnerable to subdomain takeover")
+		log.Info("[ %s ]  -  %s [ %s ] [ %s confidence ]", color.RedString(labels[0]), f.Subdomain, color.RedString(f.Service), f.Confidence)
+		log.Info("[ %s ]  -  %s", color.YellowString(labels[1]), strings.Join(append([]string{f.Subdomain}, f.CNAMEChain...), " -> "))
+		log.Info("[ %s ]  -  %s", color.YellowString(labels[2]), evidence)
+		log.Info("[ %s ]  -  %s", color.CyanString(labels[3]), f.Documentation)
 	}
 
-	if !anyVuln {
-		myLogger.Info("Target subdomains are not vulnerable to subdomain takeover")
+	if len(findings) == 0 {
+		log.Info("Target subdomains are not vulnerable to subdomain takeover")
 	}
 
-	myLogger.Info("Subzy executed successfully")
+	log.Info("Subdomain takeover check executed successfully")
 	return nil
 }
 
-func InitVulnScan(cfg VulnScan) error {
+func InitVulnScan(ctx context.Context, cfg VulnScan) error {
+	log := logger.FromContext(ctx)
 	modName := "VULN_SCAN"
-	myLogger.Info(color.YellowString("%s module initialized\n", modName))
+	log.Info(color.YellowString("%s module initialized\n", modName))
 
-	if cfg.EnableSubzy {
-		if err := RunSubzy(cfg.OutdirPath, cfg.Subzy.Concurrency, cfg.Subzy.Timeout, cfg.Subzy.HideFails, cfg.Subzy.HTTPS, cfg.Subzy.VerifySSL, cfg.Subzy.Vuln); err != nil {
-			return fmt.Errorf(color.RedString("Error running subzy: %v\n", err))
+	if cfg.EnableTakeover {
+		if err := RunTakeover(ctx, cfg.OutdirPath, cfg.Takeover, cfg.Scope); err != nil {
+			return fmt.Errorf(color.RedString("Error running subdomain takeover check: %v\n", err))
 		}
 	}
 
-	myLogger.Info(color.YellowString("%s module completed\n", modName))
+	log.Info(color.YellowString("%s module completed\n", modName))
 
 	return nil
 }
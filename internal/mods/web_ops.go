@@ -1,18 +1,21 @@
 package mods
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
 	"github.com/LiterallyEthical/r3conwhal3/web"
 	"github.com/fatih/color"
 )
 
 type WebOps struct {
 	OutDirPath      string
+	TempDir         string
 	Gowitness       Gowitness
 	FFUF            FFUF
 	EnableGowitness bool
@@ -44,13 +47,71 @@ type FFUF struct {
 	SE                 bool
 }
 
-func RunGowitness(outdirPath string, timeout, resolutionX, resolutionY, numOfThreads int, fullpage, screenshotFilter bool, screenshotFilterCodes string) error {
+func init() {
+	Register(webOpsModule{})
+}
+
+// webOpsModule takes screenshots of and fuzzes the live subdomains
+type webOpsModule struct{}
+
+func (webOpsModule) Name() string { return "webops" }
+
+func (webOpsModule) Inputs() []string { return []string{"live_subdomains.txt"} }
 
-	myLogger.Info("Running gowitness")
+func (webOpsModule) Outputs() []string { return []string{"screenshots", "web_ops"} }
+
+func (webOpsModule) Config(env *Env) interface{} { return NewWebOps(env) }
+
+func (webOpsModule) Run(ctx context.Context, env *Env) error {
+	cfg := NewWebOps(env)
+	err := InitWebOps(ctx, cfg)
+	recordWebOps(env.Log, env.Store, cfg)
+	return err
+}
+
+// NewWebOps sets the WEB_OPS configs from the environment
+func NewWebOps(env *Env) WebOps {
+	config := env.Config
+
+	return WebOps{
+		OutDirPath:      env.OutDirPath,
+		TempDir:         env.TempDir,
+		EnableGowitness: config.EnableGowitness,
+		EnableFFUF:      config.EnableFFUF,
+		EnableWebGalery: config.EnableWebGalery,
+		Gowitness: Gowitness{
+			Timeout:               config.GowitnessTimeout,
+			ResolutionX:           config.GowitnessResolutionX,
+			ResolutionY:           config.GowitnessResolutionY,
+			NumOfThreads:          config.GowitnessNumOfThreads,
+			Fullpage:              config.GowitnessFullpage,
+			ScreenshotFilter:      config.GowitnessScreenshotFilter,
+			ScreenshotFilterCodes: config.GowitnessScreenshotFilterCodes,
+		},
+		FFUF: FFUF{
+			NumOfThreads:       config.FFUFNumOfThreads,
+			Maxtime:            config.FFUFMaxtime,
+			Rate:               config.FFUFRate,
+			Timeout:            config.FFUFTimeout,
+			Wordlist:           config.FFUFWordlist,
+			MatchHTTPCode:      config.FFUFMatchHTTPCode,
+			FilterResponseSize: config.FFUFFilterResponseSize,
+			OutputFormat:       config.FFUFOutputFormat,
+			Output:             config.FFUFOutput,
+			SF:                 config.FFUFSF,
+			SE:                 config.FFUFSE,
+		},
+	}
+}
+
+func RunGowitness(ctx context.Context, outdirPath string, timeout, resolutionX, resolutionY, numOfThreads int, fullpage, screenshotFilter bool, screenshotFilterCodes string) error {
+	log := logger.FromContext(ctx)
+
+	log.Info("Running gowitness")
 
 	// Printing the execution time
 	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "gowitness")
+	defer utils.LogElapsedTime(log, startTime, "gowitness")
 
 	// Show progress
 	utils.ShowProgress()
@@ -90,7 +151,7 @@ func RunGowitness(outdirPath string, timeout, resolutionX, resolutionY, numOfThr
 	}
 
 	// Run gowitness
-	_, err := utils.RunCommand("gowitness", interfaceArgs...)
+	_, err := utils.RunCommand(ctx, "gowitness", interfaceArgs...)
 	if err != nil {
 		return err
 	}
@@ -109,20 +170,24 @@ func RunWebServer(outdirPath string) error {
 	return nil
 }
 
-func RunFFUF(numOfThreads, maxtime, rate, timeout int, outDirPath, wordlist, matchHTTPCode, filterResponseSize, outputFormat, output string, SF, SE bool) error {
+func RunFFUF(ctx context.Context, numOfThreads, maxtime, rate, timeout int, outDirPath, tempDir, wordlist, matchHTTPCode, filterResponseSize, outputFormat, output string, SF, SE bool) error {
+	log := logger.FromContext(ctx)
 
-	myLogger.Info("Running ffuf")
+	log.Info("Running ffuf")
 
 	// Printing the execution time
 	startTime := time.Now()
-	defer utils.LogElapsedTime(startTime, "ffuf")
+	defer utils.LogElapsedTime(log, startTime, "ffuf")
 
 	// Show progress
 	utils.ShowProgress()
 
 	// wordlist
 	src := filepath.Join(outDirPath, "live_subdomains.txt")
-	domainWordlist := filepath.Join(".tmp", "live_subdomains.txt")
+	domainWordlist := filepath.Join(tempDir, "live_subdomains.txt")
+	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
 
 	if err := utils.CopyFile(src, domainWordlist); err != nil {
 		return fmt.Errorf("Failed to copy file: %s", err)
@@ -166,7 +231,7 @@ func RunFFUF(numOfThreads, maxtime, rate, timeout int, outDirPath, wordlist, mat
 	}
 
 	// Run FFUF
-	_, err := utils.RunCommand("ffuf", interfaceArgs...)
+	_, err := utils.RunCommand(ctx, "ffuf", interfaceArgs...)
 	if err != nil {
 		return err
 	}
@@ -174,28 +239,29 @@ func RunFFUF(numOfThreads, maxtime, rate, timeout int, outDirPath, wordlist, mat
 	return nil
 }
 
-func InitWebOps(cfg WebOps) error {
+func InitWebOps(ctx context.Context, cfg WebOps) error {
+	log := logger.FromContext(ctx)
 	modName := "WEB_OPS"
-	myLogger.Info(color.MagentaString("%s module initialized\n", modName))
+	log.Info(color.MagentaString("%s module initialized\n", modName))
 
 	if cfg.EnableGowitness {
 
 		// Web screenshoting
-		myLogger.Info(color.MagentaString("WEB_SCREENSHOTING is activated"))
-		if err := RunGowitness(cfg.OutDirPath, cfg.Gowitness.Timeout, cfg.Gowitness.ResolutionX, cfg.Gowitness.ResolutionY, cfg.Gowitness.NumOfThreads, cfg.Gowitness.Fullpage, cfg.Gowitness.ScreenshotFilter, cfg.Gowitness.ScreenshotFilterCodes); err != nil {
+		log.Info(color.MagentaString("WEB_SCREENSHOTING is activated"))
+		if err := RunGowitness(ctx, cfg.OutDirPath, cfg.Gowitness.Timeout, cfg.Gowitness.ResolutionX, cfg.Gowitness.ResolutionY, cfg.Gowitness.NumOfThreads, cfg.Gowitness.Fullpage, cfg.Gowitness.ScreenshotFilter, cfg.Gowitness.ScreenshotFilterCodes); err != nil {
 			return fmt.Errorf(color.RedString("Error running gowitness: %v", err))
 		}
 	}
 
-	if cfg.EnableFFUF {
+	if cfg.EnableFFUF && ctx.Err() == nil {
 		// Directory fuzzing
-		myLogger.Info(color.MagentaString("DIRECTORY_FUZZING is activated"))
-		if err := RunFFUF(cfg.FFUF.NumOfThreads, cfg.FFUF.Maxtime, cfg.FFUF.Rate, cfg.FFUF.Timeout, cfg.OutDirPath, cfg.FFUF.Wordlist, cfg.FFUF.MatchHTTPCode, cfg.FFUF.FilterResponseSize, cfg.FFUF.OutputFormat, cfg.FFUF.Output, cfg.FFUF.SF, cfg.FFUF.SE); err != nil {
+		log.Info(color.MagentaString("DIRECTORY_FUZZING is activated"))
+		if err := RunFFUF(ctx, cfg.FFUF.NumOfThreads, cfg.FFUF.Maxtime, cfg.FFUF.Rate, cfg.FFUF.Timeout, cfg.OutDirPath, cfg.TempDir, cfg.FFUF.Wordlist, cfg.FFUF.MatchHTTPCode, cfg.FFUF.FilterResponseSize, cfg.FFUF.OutputFormat, cfg.FFUF.Output, cfg.FFUF.SF, cfg.FFUF.SE); err != nil {
 			return fmt.Errorf(color.RedString("Error running FFUF: %v", err))
 		}
 	}
 
-	myLogger.Info(color.MagentaString("%s module completed\n", modName))
+	log.Info(color.MagentaString("%s module completed\n", modName))
 
 	return nil
 }
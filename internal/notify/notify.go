@@ -0,0 +1,222 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+)
+
+// Event types a notification can be sent for
+const (
+	RunStart    = "run_start"
+	RunFinish   = "run_finish"
+	StageFailed = "stage_failed"
+	Takeover    = "takeover"
+	NewLive     = "new_live"
+)
+
+// Events lists every event type in the order they usually happen
+var Events = []string{RunStart, RunFinish, StageFailed, Takeover, NewLive}
+
+// DefaultTemplate renders the message when NOTIFY_TEMPLATE is not set
+const DefaultTemplate = "[r3conwhal3] {{.Domain}}: {{.Message}}{{range .Hosts}}\n- {{.}}{{end}}"
+
+// Discord rejects messages longer than this
+const discordMaxLength = 2000
+
+// ansiColor matches the colour codes error messages carry for the terminal
+var ansiColor = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// Event is something worth telling about a run
+type Event struct {
+	Type    string    `json:"type"`
+	Domain  string    `json:"domain"`
+	RunDir  string    `json:"run_dir,omitempty"`
+	Stage   string    `json:"stage,omitempty"`
+	Message string    `json:"message"`
+	Hosts   []string  `json:"hosts,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// channel is a destination and the payload format it expects
+type channel struct {
+	name    string
+	url     string
+	payload func(e Event, text string) interface{}
+}
+
+// Notifier sends events to the configured channels. A nil Notifier sends nothing.
+type Notifier struct {
+	channels []channel
+	events   map[string]bool
+	tmpl     *template.Template
+	client   *http.Client
+}
+
+// New sets up a notifier from the NOTIFY configs, it returns nil if no channel is configured
+func New(config utils.Config) (*Notifier, error) {
+	n := &Notifier{
+		events: make(map[string]bool),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if config.NotifyWebhookURL != "" {
+		n.channels = append(n.channels, channel{name: "webhook", url: config.NotifyWebhookURL, payload: func(e Event, text string) interface{} {
+			return struct {
+				Event
+				Text string `json:"text"`
+			}{e, text}
+		}})
+	}
+	if config.NotifySlackURL != "" {
+		n.channels = append(n.channels, channel{name: "slack", url: config.NotifySlackURL, payload: func(e Event, text string) interface{} {
+			return map[string]string{"text": text}
+		}})
+	}
+	if config.NotifyDiscordURL != "" {
+		n.channels = append(n.channels, channel{name: "discord", url: config.NotifyDiscordURL, payload: func(e Event, text string) interface{} {
+			return map[string]string{"content": truncate(text, discordMaxLength)}
+		}})
+	}
+	if config.NotifyTelegramURL != "" {
+		if config.NotifyTelegramChatID == "" {
+			return nil, fmt.Errorf("NOTIFY_TELEGRAM_CHAT_ID is required with NOTIFY_TELEGRAM_URL")
+		}
+		chatID := config.NotifyTelegramChatID
+		n.channels = append(n.channels, channel{name: "telegram", url: config.NotifyTelegramURL, payload: func(e Event, text string) interface{} {
+			return map[string]string{"chat_id": chatID, "text": text}
+		}})
+	}
+	if len(n.channels) == 0 {
+		return nil, nil
+	}
+
+	// Select the events to send
+	for _, event := range strings.Split(config.NotifyEvents, ",") {
+		event = strings.TrimSpace(event)
+		switch {
+		case event == "" || event == "all":
+			for _, e := range Events {
+				n.events[e] = true
+			}
+		case containsEvent(event):
+			n.events[event] = true
+		default:
+			return nil, fmt.Errorf("unknown notify event %q, expected one of %s or all", event, strings.Join(Events, ", "))
+		}
+	}
+
+	// Env files cannot hold newlines, a literal \n stands for one
+	text := config.NotifyTemplate
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New("notify").Parse(strings.ReplaceAll(text, `\n`, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid NOTIFY_TEMPLATE: %v", err)
+	}
+	n.tmpl = tmpl
+
+	return n, nil
+}
+
+// Notify sends the event to every channel if its type is selected. Failures are
+// logged and returned, they never stop the run.
+func (n *Notifier) Notify(ctx context.Context, e Event) error {
+	if n == nil || !n.events[e.Type] {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Message = ansiColor.ReplaceAllString(e.Message, "")
+
+	var text bytes.Buffer
+	if err := n.tmpl.Execute(&text, e); err != nil {
+		logger.FromContext(ctx).Warning("Failed to render %s notification: %v", e.Type, err)
+		return err
+	}
+
+	var errs []string
+	for _, c := range n.channels {
+		if err := n.post(ctx, c.url, c.payload(e, text.String())); err != nil {
+			logger.FromContext(ctx).Warning("Failed to send %s notification to %s: %v", e.Type, c.name, err)
+			errs = append(errs, fmt.Sprintf("%s: %v", c.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("notification failed: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// post sends payload to endpoint. The URLs of the channels hold their secret, such
+// as the bot token of Telegram, so the errors returned never include them.
+func (n *Notifier) post(ctx context.Context, endpoint string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// A notification about an interrupted run is still worth sending
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), n.client.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return redactURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return redactURL(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// redactURL drops the request URL from the errors of net/http and net/url
+func redactURL(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		return fmt.Errorf("%s request failed: %w", strings.ToLower(urlErr.Op), urlErr.Err)
+	}
+	return err
+}
+
+// truncate cuts text to max characters, ending it with "..." when cut. Multi-byte
+// characters are kept whole.
+func truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+func containsEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
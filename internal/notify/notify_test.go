@@ -0,0 +1,283 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/LiterallyEthical/r3conwhal3/internal/utils"
+)
+
+// recorder is an HTTP endpoint keeping the JSON body of every request it gets
+type recorder struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+	status int
+}
+
+func startRecorder(t *testing.T) (*recorder, *httptest.Server) {
+	t.Helper()
+
+	r := &recorder{status: http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("invalid JSON payload %s: %v", data, err)
+		}
+		r.mu.Lock()
+		r.bodies = append(r.bodies, body)
+		status := r.status
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return r, server
+}
+
+func (r *recorder) received() []map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]map[string]interface{}(nil), r.bodies...)
+}
+
+func TestPayloadFormats(t *testing.T) {
+	event := Event{Type: Takeover, Domain: "ex.test", Message: "2 takeovers", Hosts: []string{"a.ex.test", "b.ex.test"}}
+	text := "[r3conwhal3] ex.test: 2 takeovers\n- a.ex.test\n- b.ex.test"
+
+	tests := []struct {
+		name   string
+		config func(url string) utils.Config
+		want   map[string]interface{}
+	}{
+		{
+			name:   "slack",
+			config: func(url string) utils.Config { return utils.Config{NotifySlackURL: url} },
+			want:   map[string]interface{}{"text": text},
+		},
+		{
+			name:   "discord",
+			config: func(url string) utils.Config { return utils.Config{NotifyDiscordURL: url} },
+			want:   map[string]interface{}{"content": text},
+		},
+		{
+			name: "telegram",
+			config: func(url string) utils.Config {
+				return utils.Config{NotifyTelegramURL: url, NotifyTelegramChatID: "-100123"}
+			},
+			want: map[string]interface{}{"chat_id": "-100123", "text": text},
+		},
+		{
+			name:   "webhook",
+			config: func(url string) utils.Config { return utils.Config{NotifyWebhookURL: url} },
+			want: map[string]interface{}{
+				"type":    Takeover,
+				"domain":  "ex.test",
+				"message": "2 takeovers",
+				"hosts":   []interface{}{"a.ex.test", "b.ex.test"},
+				"text":    text,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, server := startRecorder(t)
+			n, err := New(tt.config(server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := n.Notify(context.Background(), event); err != nil {
+				t.Fatal(err)
+			}
+
+			bodies := r.received()
+			if len(bodies) != 1 {
+				t.Fatalf("got %d requests, want 1", len(bodies))
+			}
+			for k, want := range tt.want {
+				got, _ := json.Marshal(bodies[0][k])
+				wantJSON, _ := json.Marshal(want)
+				if string(got) != string(wantJSON) {
+					t.Errorf("%s = %s, want %s", k, got, wantJSON)
+				}
+			}
+		})
+	}
+}
+
+func TestTelegramRequiresChatID(t *testing.T) {
+	if _, err := New(utils.Config{NotifyTelegramURL: "https://api.telegram.org/botX/sendMessage"}); err == nil {
+		t.Error("New without NOTIFY_TELEGRAM_CHAT_ID, want an error")
+	}
+}
+
+func TestNoChannel(t *testing.T) {
+	n, err := New(utils.Config{NotifyEvents: "takeover"})
+	if err != nil || n != nil {
+		t.Fatalf("New without channels = %v, %v, want nil, nil", n, err)
+	}
+	// A nil notifier sends nothing
+	if err := n.Notify(context.Background(), Event{Type: Takeover}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	tests := []struct {
+		events string
+		sent   []string
+	}{
+		{"", Events},
+		{"all", Events},
+		{"takeover, new_live", []string{Takeover, NewLive}},
+		{"stage_failed", []string{StageFailed}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.events, func(t *testing.T) {
+			r, server := startRecorder(t)
+			n, err := New(utils.Config{NotifySlackURL: server.URL, NotifyEvents: tt.events, NotifyTemplate: "{{.Type}}"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range Events {
+				n.Notify(context.Background(), Event{Type: e, Domain: "ex.test"})
+			}
+
+			var sent []string
+			for _, body := range r.received() {
+				sent = append(sent, body["text"].(string))
+			}
+			if strings.Join(sent, ",") != strings.Join(tt.sent, ",") {
+				t.Errorf("sent %v, want %v", sent, tt.sent)
+			}
+		})
+	}
+
+	if _, err := New(utils.Config{NotifySlackURL: "http://127.0.0.1", NotifyEvents: "nope"}); err == nil {
+		t.Error("New with an unknown event, want an error")
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		event    Event
+		want     string
+	}{
+		{
+			name:  "default",
+			event: Event{Type: RunFinish, Domain: "ex.test", Message: "scan finished"},
+			want:  "[r3conwhal3] ex.test: scan finished",
+		},
+		{
+			name:     "escaped newline",
+			template: `{{.Type}} {{.Domain}}\n{{.Stage}}`,
+			event:    Event{Type: StageFailed, Domain: "ex.test", Stage: "active"},
+			want:     "stage_failed ex.test\nactive",
+		},
+		{
+			name:     "colours stripped",
+			template: "{{.Message}}",
+			event:    Event{Type: StageFailed, Message: "\x1b[31mactive module failed\x1b[0m"},
+			want:     "active module failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, server := startRecorder(t)
+			n, err := New(utils.Config{NotifySlackURL: server.URL, NotifyTemplate: tt.template})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := n.Notify(context.Background(), tt.event); err != nil {
+				t.Fatal(err)
+			}
+			if got := r.received()[0]["text"]; got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := New(utils.Config{NotifySlackURL: "http://127.0.0.1", NotifyTemplate: "{{.Nope"}); err == nil {
+		t.Error("New with an invalid template, want an error")
+	}
+}
+
+func TestDiscordTruncation(t *testing.T) {
+	r, server := startRecorder(t)
+	n, err := New(utils.Config{NotifyDiscordURL: server.URL, NotifyTemplate: "{{.Message}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Notify(context.Background(), Event{Type: NewLive, Message: strings.Repeat("é", 3000)}); err != nil {
+		t.Fatal(err)
+	}
+
+	content := r.received()[0]["content"].(string)
+	if !utf8.ValidString(content) {
+		t.Error("truncated content is not valid UTF-8")
+	}
+	if n := utf8.RuneCountInString(content); n != discordMaxLength {
+		t.Errorf("content has %d characters, want %d", n, discordMaxLength)
+	}
+	if !strings.HasSuffix(content, "...") {
+		t.Error("truncated content does not end with ...")
+	}
+}
+
+func TestErrorsHideChannelURL(t *testing.T) {
+	const token = "123456:SECRET-TOKEN"
+
+	tests := []struct {
+		name string
+		url  func(t *testing.T) string
+	}{
+		{
+			name: "bad status",
+			url: func(t *testing.T) string {
+				r, server := startRecorder(t)
+				r.status = http.StatusUnauthorized
+				return server.URL + "/bot" + token + "/sendMessage"
+			},
+		},
+		{
+			name: "connection refused",
+			url: func(t *testing.T) string {
+				server := httptest.NewServer(http.NotFoundHandler())
+				server.Close()
+				return server.URL + "/bot" + token + "/sendMessage"
+			},
+		},
+		{
+			name: "invalid url",
+			url:  func(t *testing.T) string { return "http://bad host/bot" + token + "/sendMessage" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := New(utils.Config{NotifyTelegramURL: tt.url(t), NotifyTelegramChatID: "1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = n.Notify(context.Background(), Event{Type: RunStart, Domain: "ex.test"})
+			if err == nil {
+				t.Fatal("Notify succeeded, want an error")
+			}
+			if strings.Contains(err.Error(), token) {
+				t.Errorf("error leaks the token: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !cgo
+
+package store
+
+// The results database is built on github.com/mattn/go-sqlite3, a cgo package that
+// fails every query at run time when built without cgo. Refuse to build instead:
+// set CGO_ENABLED=1 and install a C compiler such as gcc.
+var _ = r3conwhal3_requires_cgo__set_CGO_ENABLED_1_and_install_gcc
@@ -0,0 +1,60 @@
+package store
+
+import "sort"
+
+// CannedQuery is a named query offered by the query subcommand
+type CannedQuery struct {
+	Description string
+	SQL         string
+}
+
+// CannedQueries are the queries available by name
+var CannedQueries = map[string]CannedQuery{
+	"hosts": {
+		Description: "Every host with the sources that found it",
+		SQL: `SELECT h.name, group_concat(s.source, ',') AS sources, h.first_seen, h.live
+			FROM hosts h LEFT JOIN host_sources s ON s.host = h.name
+			GROUP BY h.name ORDER BY h.name`,
+	},
+	"live": {
+		Description: "Live hosts and their web services",
+		SQL: `SELECT h.name, w.url, w.status_code, w.title
+			FROM hosts h LEFT JOIN http_services w ON w.host = h.name
+			WHERE h.live = 1 ORDER BY h.name`,
+	},
+	"dns": {
+		Description: "DNS records of every host",
+		SQL:         `SELECT host, type, value FROM dns_records ORDER BY host, type, value`,
+	},
+	"fuzz": {
+		Description: "Paths found by directory fuzzing",
+		SQL:         `SELECT host, url, status_code, content_length FROM fuzz_hits ORDER BY host, url`,
+	},
+	"screenshots": {
+		Description: "Screenshots taken of the live hosts",
+		SQL:         `SELECT host, url, path FROM screenshots ORDER BY host`,
+	},
+	"findings": {
+		Description: "Findings reported by the scanners",
+		SQL:         `SELECT host, type, severity, source, detail FROM findings ORDER BY host, type`,
+	},
+	"forbidden-with-findings": {
+		Description: "Live hosts with a 403 fuzzing hit and a finding",
+		SQL: `SELECT DISTINCT h.name, fz.url, f.type, f.severity
+			FROM hosts h
+			JOIN fuzz_hits fz ON fz.host = h.name AND fz.status_code = 403
+			JOIN findings f ON f.host = h.name
+			WHERE h.live = 1 ORDER BY h.name`,
+	},
+}
+
+// CannedQueryNames returns the names of the canned queries in alphabetical order
+func CannedQueryNames() []string {
+	names := make([]string, 0, len(CannedQueries))
+	for name := range CannedQueries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,359 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// FileName is the results database kept in every run directory
+const FileName = "r3conwhal3.db"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS hosts (
+	name       TEXT PRIMARY KEY,
+	first_seen DATETIME,
+	live       INTEGER NOT NULL DEFAULT 0,
+	stage      TEXT NOT NULL DEFAULT '',
+	live_stage TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS host_sources (
+	host   TEXT NOT NULL,
+	source TEXT NOT NULL,
+	stage  TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (host, source)
+);
+CREATE TABLE IF NOT EXISTS dns_records (
+	host  TEXT NOT NULL,
+	type  TEXT NOT NULL,
+	value TEXT NOT NULL,
+	stage TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (host, type, value)
+);
+CREATE TABLE IF NOT EXISTS http_services (
+	url            TEXT PRIMARY KEY,
+	host           TEXT NOT NULL,
+	status_code    INTEGER,
+	title          TEXT,
+	content_length INTEGER,
+	webserver      TEXT,
+	stage          TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS fuzz_hits (
+	url            TEXT PRIMARY KEY,
+	host           TEXT NOT NULL,
+	path           TEXT,
+	status_code    INTEGER,
+	content_length INTEGER,
+	words          INTEGER,
+	lines          INTEGER,
+	stage          TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS screenshots (
+	path  TEXT PRIMARY KEY,
+	host  TEXT NOT NULL,
+	url   TEXT,
+	stage TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS findings (
+	host     TEXT NOT NULL,
+	type     TEXT NOT NULL,
+	severity TEXT NOT NULL DEFAULT '',
+	source   TEXT NOT NULL DEFAULT '',
+	detail   TEXT NOT NULL DEFAULT '',
+	stage    TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (host, type, source, detail)
+);
+`
+
+// stageTables are the tables whose rows are tagged with the stage that inserted them
+var stageTables = []string{"host_sources", "dns_records", "http_services", "fuzz_hits", "screenshots", "findings", "hosts"}
+
+// Store is the SQLite database holding the structured results of a run. Rows
+// are tagged with the stage of the store that inserted them, see Stage.
+type Store struct {
+	db    *sql.DB
+	stage string
+}
+
+// Host is a discovered host and the sources that found it
+type Host struct {
+	Name      string
+	Sources   []string
+	FirstSeen time.Time
+}
+
+// DNSRecord is an answer recorded for a host
+type DNSRecord struct {
+	Host  string
+	Type  string
+	Value string
+}
+
+// HTTPService is a web service found on a host
+type HTTPService struct {
+	URL           string
+	Host          string
+	StatusCode    int
+	Title         string
+	ContentLength int
+	Webserver     string
+}
+
+// FuzzHit is a path found by directory fuzzing
+type FuzzHit struct {
+	URL           string
+	Host          string
+	Path          string
+	StatusCode    int
+	ContentLength int
+	Words         int
+	Lines         int
+}
+
+// Screenshot is a screenshot file taken of a web service
+type Screenshot struct {
+	Path string
+	Host string
+	URL  string
+}
+
+// Finding is an issue reported by a scanner
+type Finding struct {
+	Host     string
+	Type     string
+	Severity string
+	Source   string
+	Detail   string
+}
+
+// Open opens the database of the run in outDirPath, creating it if needed
+func Open(outDirPath string) (*Store, error) {
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", filepath.Join(outDirPath, FileName))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema: %v", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// OpenReadOnly opens the existing database of the run in outDirPath for queries.
+// SQLite refuses every write on the connection, whatever the query does.
+func OpenReadOnly(outDirPath string) (*Store, error) {
+	dsn := fmt.Sprintf("file:%s?mode=ro&_query_only=1&_busy_timeout=5000", filepath.Join(outDirPath, FileName))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Stage returns a store sharing the database of s whose inserts are tagged with
+// stage, so they can be removed by DeleteStage. A nil store stays nil.
+func (s *Store) Stage(stage string) *Store {
+	if s == nil {
+		return nil
+	}
+	return &Store{db: s.db, stage: stage}
+}
+
+// DeleteStage removes every row inserted by stage, before the stage runs again
+func (s *Store) DeleteStage(stage string) error {
+	if s == nil {
+		return nil
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`UPDATE hosts SET live = 0, live_stage = '' WHERE live_stage = ?`, stage); err != nil {
+			return err
+		}
+		for _, table := range stageTables {
+			if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE stage = ?`, table), stage); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddHosts inserts the hosts, merging their sources and keeping the earliest first seen time
+func (s *Store) AddHosts(hosts []Host) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, h := range hosts {
+			var firstSeen interface{}
+			if !h.FirstSeen.IsZero() {
+				firstSeen = h.FirstSeen.UTC()
+			}
+			if _, err := tx.Exec(`INSERT INTO hosts (name, first_seen, stage) VALUES (?, ?, ?)
+				ON CONFLICT(name) DO UPDATE SET first_seen = CASE
+					WHEN hosts.first_seen IS NULL OR (excluded.first_seen IS NOT NULL AND excluded.first_seen < hosts.first_seen)
+					THEN excluded.first_seen ELSE hosts.first_seen END`, h.Name, firstSeen, s.stage); err != nil {
+				return err
+			}
+			for _, source := range h.Sources {
+				if _, err := tx.Exec(`INSERT OR IGNORE INTO host_sources (host, source, stage) VALUES (?, ?, ?)`, h.Name, source, s.stage); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// MarkLive flags the hosts as serving HTTP
+func (s *Store) MarkLive(hosts []string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, host := range hosts {
+			if _, err := tx.Exec(`INSERT INTO hosts (name, live, stage, live_stage) VALUES (?, 1, ?, ?)
+				ON CONFLICT(name) DO UPDATE SET live = 1, live_stage = excluded.live_stage`, host, s.stage, s.stage); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddDNSRecords inserts the DNS answers, existing ones are kept
+func (s *Store) AddDNSRecords(records []DNSRecord) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, r := range records {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO dns_records (host, type, value, stage) VALUES (?, ?, ?, ?)`, r.Host, r.Type, r.Value, s.stage); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddHTTPServices inserts the web services, replacing the ones with the same URL
+func (s *Store) AddHTTPServices(services []HTTPService) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, svc := range services {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO http_services (url, host, status_code, title, content_length, webserver, stage) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				svc.URL, svc.Host, nullInt(svc.StatusCode), nullString(svc.Title), nullInt(svc.ContentLength), nullString(svc.Webserver), s.stage); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddFuzzHits inserts the fuzzing hits, replacing the ones with the same URL
+func (s *Store) AddFuzzHits(hits []FuzzHit) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, h := range hits {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO fuzz_hits (url, host, path, status_code, content_length, words, lines, stage) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				h.URL, h.Host, h.Path, h.StatusCode, h.ContentLength, h.Words, h.Lines, s.stage); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddScreenshots inserts the screenshots, replacing the ones with the same path
+func (s *Store) AddScreenshots(shots []Screenshot) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, shot := range shots {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO screenshots (path, host, url, stage) VALUES (?, ?, ?, ?)`, shot.Path, shot.Host, shot.URL, s.stage); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddFindings inserts the findings, replacing the severity of the ones already recorded
+func (s *Store) AddFindings(findings []Finding) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, f := range findings {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO findings (host, type, severity, source, detail, stage) VALUES (?, ?, ?, ?, ?, ?)`,
+				f.Host, f.Type, f.Severity, f.Source, f.Detail, s.stage); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Query runs a SQL query and returns the column names and the rows as text.
+// Open the store with OpenReadOnly to run queries that must not change it.
+func (s *Store) Query(query string, args ...interface{}) ([]string, [][]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var result [][]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make([]string, len(columns))
+		for i, v := range values {
+			row[i] = v.String
+		}
+		result = append(result, row)
+	}
+
+	return columns, result, rows.Err()
+}
+
+func (s *Store) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func nullInt(v int) interface{} {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
+func nullString(v string) interface{} {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"testing"
+)
+
+func openTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	st, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	return st, dir
+}
+
+func count(t *testing.T, st *Store, query string) string {
+	t.Helper()
+
+	_, rows, err := st.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows[0][0]
+}
+
+func TestDeleteStage(t *testing.T) {
+	st, _ := openTestStore(t)
+	passive, filter := st.Stage("passive"), st.Stage("filter")
+
+	if err := passive.AddHosts([]Host{{Name: "www.ex.test", Sources: []string{"subfinder"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := passive.AddDNSRecords([]DNSRecord{{Host: "www.ex.test", Type: "A", Value: "10.0.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := filter.AddHosts([]Host{{Name: "www.ex.test", Sources: []string{"bruteforce"}}, {Name: "api.ex.test", Sources: []string{"bruteforce"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := filter.MarkLive([]string{"www.ex.test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := filter.AddHTTPServices([]HTTPService{{URL: "https://www.ex.test", Host: "www.ex.test", StatusCode: 200}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.DeleteStage("filter"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`SELECT count(*) FROM hosts`, "1"},
+		{`SELECT count(*) FROM hosts WHERE live = 1`, "0"},
+		{`SELECT group_concat(source) FROM host_sources`, "subfinder"},
+		{`SELECT count(*) FROM dns_records`, "1"},
+		{`SELECT count(*) FROM http_services`, "0"},
+	}
+	for _, tt := range tests {
+		if got := count(t, st, tt.query); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	if err := st.DeleteStage("passive"); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(t, st, `SELECT count(*) FROM hosts`); got != "0" {
+		t.Errorf("hosts left after deleting every stage = %s", got)
+	}
+}
+
+func TestNilStore(t *testing.T) {
+	var st *Store
+	if st.Stage("passive") != nil {
+		t.Error("Stage of a nil store is not nil")
+	}
+	if err := st.DeleteStage("passive"); err != nil {
+		t.Errorf("DeleteStage on a nil store = %v", err)
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	st, dir := openTestStore(t)
+	if err := st.AddHosts([]Host{{Name: "www.ex.test", Sources: []string{"subfinder"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := OpenReadOnly(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+
+	for _, query := range []string{
+		`DELETE FROM hosts`,
+		`DROP TABLE hosts`,
+		`CREATE TABLE x (y TEXT)`,
+	} {
+		if _, _, err := ro.Query(query); err == nil {
+			t.Errorf("Query(%s) on a read-only store succeeded", query)
+		}
+	}
+	if got := count(t, ro, `SELECT count(*) FROM hosts`); got != "1" {
+		t.Errorf("hosts after the refused writes = %s, want 1", got)
+	}
+
+	// The query subcommand never creates a database
+	if _, err := OpenReadOnly(t.TempDir()); err == nil {
+		t.Error("OpenReadOnly of a run without a database succeeded")
+	}
+}
+
+func TestCannedQueries(t *testing.T) {
+	st, _ := openTestStore(t)
+	if err := st.AddHosts([]Host{{Name: "www.ex.test", Sources: []string{"subfinder", "amass"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.MarkLive([]string{"www.ex.test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range CannedQueryNames() {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := st.Query(CannedQueries[name].SQL); err != nil {
+				t.Errorf("query %s: %v", name, err)
+			}
+		})
+	}
+
+	_, rows, err := st.Query(CannedQueries["live"].SQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0][0] != "www.ex.test" {
+		t.Errorf("live = %v, want www.ex.test", rows)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"embed"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 
@@ -13,28 +12,53 @@ import (
 
 type Config struct {
 	OutDir                         string `mapstructure:"OUT_DIR"`
+	ScopeFile                      string `mapstructure:"SCOPE_FILE"`
+	TargetConcurrency              int    `mapstructure:"TARGET_CONCURRENCY"`
+	SortMemoryMB                   int    `mapstructure:"SORT_MEMORY_MB"`
+	LogLevel                       string `mapstructure:"LOG_LEVEL"`
+	LogFormat                      string `mapstructure:"LOG_FORMAT"`
 	EnableSubkill3r                bool   `mapstructure:"ENABLE_SUBKILL3R"`
+	EnableAXFR                     bool   `mapstructure:"ENABLE_AXFR"`
+	EnableZoneWalk                 bool   `mapstructure:"ENABLE_ZONEWALK"`
 	EnableAssetfinder              bool   `mapstructure:"ENABLE_ASSETFINDER"`
 	EnableAmass                    bool   `mapstructure:"ENABLE_AMASS"`
 	EnableGowitness                bool   `mapstructure:"ENABLE_GOWITNESS"`
 	EnableFFUF                     bool   `mapstructure:"ENABLE_FFUF"`
 	EnableWebGalery                bool   `mapstructure:"ENABLE_WEB_GALERY"`
-	EnableSubzy                    bool   `mapstructure:"ENABLE_SUBZY"`
+	EnableTakeover                 bool   `mapstructure:"ENABLE_TAKEOVER"`
 	Subkill3rWorkerCount           int    `mapstructure:"SUBKILL3R_WORKER_COUNT"`
 	Subkill3rServerAddr            string `mapstructure:"SUBKILL3R_SERVER_ADDR"`
 	Subkill3rWordlist              string `mapstructure:"SUBKILL3R_WORDLIST"`
-	PurednsWordlist                string `mapstructure:"PUREDNS_WORDLIST"`
-	PurednsResolvers               string `mapstructure:"PUREDNS_RESOLVERS"`
-	PurednsNumOfThreads            int    `mapstructure:"PUREDNS_NUM_OF_THREADS"`
-	GotatorPermlist                string `mapstructure:"GOTATOR_PERMLIST"`
-	GotatorDepth                   int    `mapstructure:"GOTATOR_DEPTH"`
-	GotatorNumbers                 int    `mapstructure:"GOTATOR_NUMBERS"`
-	GotatorNumOfThreads            int    `mapstructure:"GOTATOR_NUM_OF_THREADS"`
-	GotatorMindup                  bool   `mapstructure:"GOTATOR_MINDUP"`
-	GotatorAdv                     bool   `mapstructure:"GOTATOR_ADV"`
-	GotatorMd                      bool   `mapstructure:"GOTATOR_MD"`
+	Subkill3rResolvers             string `mapstructure:"SUBKILL3R_RESOLVERS"`
+	Subkill3rRetries               int    `mapstructure:"SUBKILL3R_RETRIES"`
+	Subkill3rRecordTypes           string `mapstructure:"SUBKILL3R_RECORD_TYPES"`
+	AXFRTimeout                    int    `mapstructure:"AXFR_TIMEOUT"`
+	ZoneWalkMaxQueries             int    `mapstructure:"ZONEWALK_MAX_QUERIES"`
+	BruteforceWordlist             string `mapstructure:"BRUTEFORCE_WORDLIST"`
+	BruteforceResolvers            string `mapstructure:"BRUTEFORCE_RESOLVERS"`
+	BruteforceTrustedResolvers     string `mapstructure:"BRUTEFORCE_TRUSTED_RESOLVERS"`
+	BruteforceWorkerCount          int    `mapstructure:"BRUTEFORCE_WORKER_COUNT"`
+	BruteforceRateLimit            int    `mapstructure:"BRUTEFORCE_RATE_LIMIT"`
+	BruteforceRetries              int    `mapstructure:"BRUTEFORCE_RETRIES"`
+	PermuteWordlist                string `mapstructure:"PERMUTE_WORDLIST"`
+	PermuteDepth                   int    `mapstructure:"PERMUTE_DEPTH"`
+	PermuteNumbers                 int    `mapstructure:"PERMUTE_NUMBERS"`
+	PermuteLearn                   bool   `mapstructure:"PERMUTE_LEARN"`
+	PermuteMaxCandidates           int    `mapstructure:"PERMUTE_MAX_CANDIDATES"`
+	EnableRecursive                bool   `mapstructure:"ENABLE_RECURSIVE"`
+	RecursiveWordlist              string `mapstructure:"RECURSIVE_WORDLIST"`
+	RecursiveDepth                 int    `mapstructure:"RECURSIVE_DEPTH"`
+	RecursiveMaxPerLevel           int    `mapstructure:"RECURSIVE_MAX_PER_LEVEL"`
+	RecursiveMinChildren           int    `mapstructure:"RECURSIVE_MIN_CHILDREN"`
+	RecursivePatterns              string `mapstructure:"RECURSIVE_PATTERNS"`
 	SubfinderNumOfThreads          int    `mapstructure:"SUBFINDER_NUM_OF_THREADS"`
 	AmassTimeout                   int    `mapstructure:"AMASS_TIMEOUT"`
+	ProberConcurrency              int    `mapstructure:"PROBER_CONCURRENCY"`
+	ProberPorts                    string `mapstructure:"PROBER_PORTS"`
+	ProberSchemes                  string `mapstructure:"PROBER_SCHEMES"`
+	ProberFollowRedirects          bool   `mapstructure:"PROBER_FOLLOW_REDIRECTS"`
+	ProberMaxRedirects             int    `mapstructure:"PROBER_MAX_REDIRECTS"`
+	ProberTimeout                  int    `mapstructure:"PROBER_TIMEOUT"`
 	GowitnessTimeout               int    `mapstructure:"GOWITNESS_TIMEOUT"`
 	GowitnessResolutionX           int    `mapstructure:"GOWITNESS_RESOLUTION_X"`
 	GowitnessResolutionY           int    `mapstructure:"GOWITNESS_RESOLUTION_Y"`
@@ -53,15 +77,63 @@ type Config struct {
 	FFUFOutput                     string `mapstructure:"FFUF_OUTPUT"`
 	FFUFSF                         bool   `mapstructure:"FFUF_SF"`
 	FFUFSE                         bool   `mapstructure:"FFUF_SE"`
-	SUBZYConcurrency               int    `mapstructure:"SUBZY_CONCURRENCY"`
-	SUBZYTimeout                   int    `mapstructure:"SUBZY_TIMEOUT"`
-	SUBZYHideFails                 bool   `mapstructure:"SUBZY_HIDE_FAILS"`
-	SUBZYHTTPS                     bool   `mapstructure:"SUBZY_HTTPS"`
-	SUBZYVerifySSL                 bool   `mapstructure:"SUBZY_VERIFY_SSL"`
-	SUBZYVuln                      bool   `mapstructure:"SUBZY_VULN"`
+	TakeoverFingerprints           string `mapstructure:"TAKEOVER_FINGERPRINTS"`
+	TakeoverResolvers              string `mapstructure:"TAKEOVER_RESOLVERS"`
+	TakeoverRetries                int    `mapstructure:"TAKEOVER_RETRIES"`
+	TakeoverConcurrency            int    `mapstructure:"TAKEOVER_CONCURRENCY"`
+	TakeoverTimeout                int    `mapstructure:"TAKEOVER_TIMEOUT"`
+	NotifyEvents                   string `mapstructure:"NOTIFY_EVENTS"`
+	NotifyTemplate                 string `mapstructure:"NOTIFY_TEMPLATE"`
+	NotifyWebhookURL               string `mapstructure:"NOTIFY_WEBHOOK_URL"`
+	NotifySlackURL                 string `mapstructure:"NOTIFY_SLACK_URL"`
+	NotifyDiscordURL               string `mapstructure:"NOTIFY_DISCORD_URL"`
+	NotifyTelegramURL              string `mapstructure:"NOTIFY_TELEGRAM_URL"`
+	NotifyTelegramChatID           string `mapstructure:"NOTIFY_TELEGRAM_CHAT_ID"`
 }
 
-func LoadConfig(path string, docFS embed.FS) (config Config, err error) {
+// legacyKeys are the keys of the external tools r3conwhal3 no longer runs and the keys
+// that replaced them. The keys left without a replacement have no equivalent.
+var legacyKeys = []struct{ old, new string }{
+	{"PUREDNS_WORDLIST", "BRUTEFORCE_WORDLIST"},
+	{"PUREDNS_RESOLVERS", "BRUTEFORCE_RESOLVERS"},
+	{"PUREDNS_NUM_OF_THREADS", "BRUTEFORCE_WORKER_COUNT"},
+	{"GOTATOR_PERMLIST", "PERMUTE_WORDLIST"},
+	{"GOTATOR_DEPTH", "PERMUTE_DEPTH"},
+	{"GOTATOR_NUMBERS", "PERMUTE_NUMBERS"},
+	{"GOTATOR_NUM_OF_THREADS", ""},
+	{"GOTATOR_MINDUP", ""},
+	{"GOTATOR_ADV", ""},
+	{"GOTATOR_MD", ""},
+	{"ENABLE_SUBZY", "ENABLE_TAKEOVER"},
+	{"SUBZY_CONCURRENCY", "TAKEOVER_CONCURRENCY"},
+	{"SUBZY_TIMEOUT", "TAKEOVER_TIMEOUT"},
+	{"SUBZY_HIDE_FAILS", ""},
+	{"SUBZY_HTTPS", ""},
+	{"SUBZY_VERIFY_SSL", ""},
+	{"SUBZY_VULN", ""},
+}
+
+// applyLegacyKeys reads the legacy keys of the config file as the keys that replaced
+// them, unless those are set too, and warns about every legacy key found
+func applyLegacyKeys() {
+	for _, k := range legacyKeys {
+		if !viper.InConfig(k.old) {
+			continue
+		}
+		switch {
+		case k.new == "":
+			myLogger.Warning("%s is no longer used and is ignored, remove it from config file", k.old)
+		case viper.InConfig(k.new):
+			myLogger.Warning("%s is deprecated and ignored, %s is set", k.old, k.new)
+		default:
+			myLogger.Warning("%s is deprecated, rename it to %s in config file", k.old, k.new)
+			viper.RegisterAlias(k.old, k.new)
+		}
+	}
+}
+
+// LoadConfig reads config.env from path, the default wordlists and resolvers are extracted to tempDir
+func LoadConfig(path, tempDir string, docFS embed.FS) (config Config, err error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("env")
 	viper.AutomaticEnv()
@@ -69,55 +141,62 @@ func LoadConfig(path string, docFS embed.FS) (config Config, err error) {
 	// Get the user's home directory
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatalf(fmt.Sprintf("Couldn't find user's home directory, %v", err))
-		return
+		return config, fmt.Errorf("couldn't find user's home directory: %v", err)
 	}
 
 	// Set the default value for outDir
 	defaultDir := filepath.Join(homeDir, "r3conwhal3", "results")
 
 	// Set the default path for subkill3r wordlist to
-	subkill3r_wordlist, err := ExtractEmbeddedFileToTempDir(docFS, "docs/subdomains-1000.txt", "subdomains-1000.txt")
+	subkill3r_wordlist, err := ExtractEmbeddedFileToTempDir(docFS, tempDir, "docs/subdomains-1000.txt", "subdomains-1000.txt")
 	if err != nil {
-		log.Panic(err)
+		return config, err
 	}
 
-	// Set the default path for puredns wordlist
-	puredns_wordlist, err := ExtractEmbeddedFileToTempDir(docFS, "docs/subdomains-top-20k.txt", "subdomains-top-20k.txt")
+	// Set the default path for the brute-force wordlist
+	bruteforce_wordlist, err := ExtractEmbeddedFileToTempDir(docFS, tempDir, "docs/subdomains-top-20k.txt", "subdomains-top-20k.txt")
 	if err != nil {
-		log.Panic(err)
+		return config, err
 	}
 
-	// Set the default resolvers for puredns
-	puredns_resolvers, err := ExtractEmbeddedFileToTempDir(docFS, "docs/resolvers.txt", "resolvers.txt")
+	// Set the default resolvers
+	public_resolvers, err := ExtractEmbeddedFileToTempDir(docFS, tempDir, "docs/resolvers.txt", "resolvers.txt")
 	if err != nil {
-		log.Panic(err)
+		return config, err
 	}
 
-	// Set the default permutation list for gotator
-	gotator_permlist, err := ExtractEmbeddedFileToTempDir(docFS, "docs/permlist.txt", "permlist.txt")
+	// Set the default permutation words
+	permute_wordlist, err := ExtractEmbeddedFileToTempDir(docFS, tempDir, "docs/permlist.txt", "permlist.txt")
 	if err != nil {
-		log.Panic(err)
+		return config, err
 	}
 
 	// Set the default dir fuzzing wordlist for ffuf
-	ffuf_wordlist, err := ExtractEmbeddedFileToTempDir(docFS, "docs/common.txt", "commmon.txt")
+	ffuf_wordlist, err := ExtractEmbeddedFileToTempDir(docFS, tempDir, "docs/common.txt", "commmon.txt")
 	if err != nil {
-		log.Panic(err)
+		return config, err
 	}
 
 	// Setting default values
 
 	// main configs
 	viper.SetDefault("OUT_DIR", defaultDir)
+	viper.SetDefault("SCOPE_FILE", "")
+	viper.SetDefault("TARGET_CONCURRENCY", 1)
+	viper.SetDefault("SORT_MEMORY_MB", 64)
+	viper.SetDefault("LOG_LEVEL", "info")
+	viper.SetDefault("LOG_FORMAT", "text")
 	viper.SetDefault("ENABLE_WEB_GALERY", true)
 
 	// PASSIVE_ENUM configs
 	viper.SetDefault("ENABLE_ASSETFINDER", true)
 	viper.SetDefault("ENABLE_AMASS", true)
 	viper.SetDefault("ENABLE_SUBKILL3R", true)
+	viper.SetDefault("ENABLE_AXFR", true)
+	viper.SetDefault("ENABLE_ZONEWALK", true)
 	viper.SetDefault("ENABLE_GOWITNESS", true)
 	viper.SetDefault("ENABLE_FFUF", true)
+	viper.SetDefault("ENABLE_TAKEOVER", true)
 
 	// subfinder configs
 	viper.SetDefault("SUBFINDER_NUM_OF_THREADS", 100)
@@ -129,22 +208,50 @@ func LoadConfig(path string, docFS embed.FS) (config Config, err error) {
 	viper.SetDefault("SUBKILL3R_WORDLIST", subkill3r_wordlist)
 	viper.SetDefault("SUBKILL3R_WORKER_COUNT", 1000)
 	viper.SetDefault("SUBKILL3R_SERVER_ADDR", "8.8.8.8:53")
+	viper.SetDefault("SUBKILL3R_RESOLVERS", public_resolvers)
+	viper.SetDefault("SUBKILL3R_RETRIES", 3)
+	viper.SetDefault("SUBKILL3R_RECORD_TYPES", "A,AAAA,CNAME,MX,NS,TXT")
+
+	// AXFR configs, the nameservers are looked up through the subkill3r resolvers
+	viper.SetDefault("AXFR_TIMEOUT", 10)
+
+	// Zone walk configs, NSEC3 hashes are cracked against SUBKILL3R_WORDLIST and BRUTEFORCE_WORDLIST
+	viper.SetDefault("ZONEWALK_MAX_QUERIES", 10000)
 
 	// ACTIVE_ENUM configs
 
-	// puredns configs
-	viper.SetDefault("PUREDNS_WORDLIST", puredns_wordlist)
-	viper.SetDefault("PUREDNS_RESOLVERS", puredns_resolvers)
-	viper.SetDefault("PUREDNS_NUM_OF_THREADS", 100)
+	// mass resolver configs, BRUTEFORCE_RATE_LIMIT is in queries per second per resolver
+	viper.SetDefault("BRUTEFORCE_WORDLIST", bruteforce_wordlist)
+	viper.SetDefault("BRUTEFORCE_RESOLVERS", public_resolvers)
+	viper.SetDefault("BRUTEFORCE_TRUSTED_RESOLVERS", "8.8.8.8,8.8.4.4,1.1.1.1,1.0.0.1,9.9.9.9")
+	viper.SetDefault("BRUTEFORCE_WORKER_COUNT", 500)
+	viper.SetDefault("BRUTEFORCE_RATE_LIMIT", 10)
+	viper.SetDefault("BRUTEFORCE_RETRIES", 3)
+
+	// permutation configs, candidates are resolved through the mass resolver
+	viper.SetDefault("PERMUTE_WORDLIST", permute_wordlist)
+	viper.SetDefault("PERMUTE_DEPTH", 1)
+	viper.SetDefault("PERMUTE_NUMBERS", 3)
+	viper.SetDefault("PERMUTE_LEARN", true)
+	viper.SetDefault("PERMUTE_MAX_CANDIDATES", 1000000)
+
+	// recursive brute-force configs, resolving goes through the subkill3r resolvers
+	viper.SetDefault("ENABLE_RECURSIVE", false)
+	viper.SetDefault("RECURSIVE_WORDLIST", subkill3r_wordlist)
+	viper.SetDefault("RECURSIVE_DEPTH", 2)
+	viper.SetDefault("RECURSIVE_MAX_PER_LEVEL", 10)
+	viper.SetDefault("RECURSIVE_MIN_CHILDREN", 5)
+	viper.SetDefault("RECURSIVE_PATTERNS", "dev*,stg*,stag*,test*,qa*,uat*,int,internal*,corp*")
+
+	// FILTER_LIVE_DOMAINS configs
 
-	// gotator configs
-	viper.SetDefault("GOTATOR_PERMLIST", gotator_permlist)
-	viper.SetDefault("GOTATOR_DEPTH", 1)
-	viper.SetDefault("GOTATOR_NUMBERS", 3)
-	viper.SetDefault("GOTATOR_NUM_OF_THREADS", 100)
-	viper.SetDefault("GOTATOR_MINDUP", false)
-	viper.SetDefault("GOTATOR_ADV", false)
-	viper.SetDefault("GOTATOR_MD", false)
+	// HTTP prober configs
+	viper.SetDefault("PROBER_CONCURRENCY", 50)
+	viper.SetDefault("PROBER_PORTS", "")
+	viper.SetDefault("PROBER_SCHEMES", "https,http")
+	viper.SetDefault("PROBER_FOLLOW_REDIRECTS", true)
+	viper.SetDefault("PROBER_MAX_REDIRECTS", 10)
+	viper.SetDefault("PROBER_TIMEOUT", 10)
 
 	// WEB_OPS configs
 
@@ -169,15 +276,23 @@ func LoadConfig(path string, docFS embed.FS) (config Config, err error) {
 	viper.SetDefault("FFUF_SF", false)
 	viper.SetDefault("FFUF_SE", false)
 
-	// WEB_OPS configs
+	// VULN_SCAN configs
+
+	// subdomain takeover configs, an empty fingerprint path uses the built-in database
+	viper.SetDefault("TAKEOVER_FINGERPRINTS", "")
+	viper.SetDefault("TAKEOVER_RESOLVERS", public_resolvers)
+	viper.SetDefault("TAKEOVER_RETRIES", 3)
+	viper.SetDefault("TAKEOVER_CONCURRENCY", 20)
+	viper.SetDefault("TAKEOVER_TIMEOUT", 10)
 
-	// subzy configs
-	viper.SetDefault("SUBZY_CONCURRENCY", 10)
-	viper.SetDefault("SUBZY_TIMEOUT", 10)
-	viper.SetDefault("SUBZY_HIDE_FAILS", false)
-	viper.SetDefault("SUBZY_HTTPS", false)
-	viper.SetDefault("SUBZY_VERIFY_SSL", false)
-	viper.SetDefault("SUBZY_VULN", false)
+	// Set the default values for NOTIFY
+	viper.SetDefault("NOTIFY_EVENTS", "all")
+	viper.SetDefault("NOTIFY_TEMPLATE", "")
+	viper.SetDefault("NOTIFY_WEBHOOK_URL", "")
+	viper.SetDefault("NOTIFY_SLACK_URL", "")
+	viper.SetDefault("NOTIFY_DISCORD_URL", "")
+	viper.SetDefault("NOTIFY_TELEGRAM_URL", "")
+	viper.SetDefault("NOTIFY_TELEGRAM_CHAT_ID", "")
 
 	if path == "embedded" {
 		// Use the passed embedded FS to read the config file
@@ -200,7 +315,12 @@ func LoadConfig(path string, docFS embed.FS) (config Config, err error) {
 		}
 	}
 
+	applyLegacyKeys()
+
 	// Unmarshal the read configuraiton into the Config struct
 	err = viper.Unmarshal(&config)
+	if err == nil && config.SortMemoryMB > 0 {
+		SortMemoryBudget = config.SortMemoryMB << 20
+	}
 	return config, err
 }
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestApplyLegacyKeys(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.SetConfigType("env")
+	viper.SetDefault("BRUTEFORCE_WORDLIST", "default.txt")
+	viper.SetDefault("PERMUTE_DEPTH", 1)
+	viper.SetDefault("TAKEOVER_TIMEOUT", 10)
+	config := []byte("PUREDNS_WORDLIST=old.txt\nGOTATOR_DEPTH=2\nGOTATOR_MINDUP=true\nSUBZY_TIMEOUT=5\nTAKEOVER_TIMEOUT=30\n")
+	if err := viper.ReadConfig(bytes.NewBuffer(config)); err != nil {
+		t.Fatal(err)
+	}
+
+	applyLegacyKeys()
+
+	if got := viper.GetString("BRUTEFORCE_WORDLIST"); got != "old.txt" {
+		t.Errorf("BRUTEFORCE_WORDLIST = %q, want the PUREDNS_WORDLIST value", got)
+	}
+	if got := viper.GetInt("PERMUTE_DEPTH"); got != 2 {
+		t.Errorf("PERMUTE_DEPTH = %v, want the GOTATOR_DEPTH value", got)
+	}
+	// The new key wins over its legacy key
+	if got := viper.GetInt("TAKEOVER_TIMEOUT"); got != 30 {
+		t.Errorf("TAKEOVER_TIMEOUT = %v, want 30", got)
+	}
+
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BruteforceWordlist != "old.txt" || cfg.PermuteDepth != 2 || cfg.TakeoverTimeout != 30 {
+		t.Errorf("Config = %+v", cfg)
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	first := Config{BruteforceWordlist: "/tmp/r3conwhal3-111/words.txt"}
+	second := Config{BruteforceWordlist: "/tmp/r3conwhal3-222/words.txt"}
+	if ConfigHash(first, "/tmp/r3conwhal3-111") != ConfigHash(second, "/tmp/r3conwhal3-222") {
+		t.Error("configs differing by their workspace only hash differently")
+	}
+	if ConfigHash(first, "") == ConfigHash(second, "") {
+		t.Error("configs with different paths hash the same without a workspace")
+	}
+
+	// Backslashes are escaped in JSON, the workspace is matched escaped too
+	windows := Config{FFUFWordlist: `C:\Temp\r3conwhal3-111\common.txt`}
+	other := Config{FFUFWordlist: `C:\Temp\r3conwhal3-222\common.txt`}
+	if ConfigHash(windows, `C:\Temp\r3conwhal3-111`) != ConfigHash(other, `C:\Temp\r3conwhal3-222`) {
+		t.Error("workspace paths escaped in JSON hash differently")
+	}
+}
@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"bufio"
+	"container/heap"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SortMemoryBudget is the number of bytes of host names sorted in memory,
+// larger lists are sorted in runs on disk and merged. Set from SORT_MEMORY_MB.
+var SortMemoryBudget = 64 << 20
+
+// MaxLineLength is the longest line read from a host list
+const MaxLineLength = 1 << 20
+
+// NormalizeHost lowercases host and removes its trailing dot and *. prefix.
+// It returns "" when the result is not a valid host name.
+func NormalizeHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	for strings.HasPrefix(host, "*.") {
+		host = host[2:]
+	}
+	if host == "" || len(host) > 253 {
+		return ""
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return ""
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' {
+				return ""
+			}
+		}
+	}
+	return host
+}
+
+// SortHosts reads the host names of every file in inputs and writes them to
+// output normalized, sorted and without duplicates. Invalid names are dropped.
+// Output may be one of the inputs, it is replaced once everything is read.
+// It returns the number of hosts written.
+func SortHosts(inputs []string, output string) (int, error) {
+	dir := filepath.Dir(output)
+	var runs []string
+	defer func() {
+		for _, run := range runs {
+			os.Remove(run)
+		}
+	}()
+
+	// Sort the hosts in chunks that fit the budget, the chunks that do not fit are kept on disk
+	var chunk []string
+	size := 0
+	for _, input := range inputs {
+		err := ScanLines(input, func(line string) error {
+			host := NormalizeHost(line)
+			if host == "" {
+				return nil
+			}
+			chunk = append(chunk, host)
+			size += len(host) + 16 // the string header
+			if size < SortMemoryBudget {
+				return nil
+			}
+			run, err := writeRun(dir, chunk)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			chunk, size = nil, 0
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	sortUnique(&chunk)
+
+	tmp, err := os.CreateTemp(dir, ".sort-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	writer := bufio.NewWriter(tmp)
+
+	count := 0
+	err = mergeRuns(runs, chunk, func(host string) error {
+		count++
+		_, err := writer.WriteString(host + "\n")
+		return err
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), output)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// ScanLines calls fn with every line of the file at path. The lines longer than
+// MaxLineLength are no host names, they are skipped with a warning.
+func ScanLines(path string, fn func(line string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	var line []byte
+	length := 0
+	for {
+		part, isPrefix, err := reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// A long line comes in parts, only the start of an oversize one is kept
+		length += len(part)
+		if length <= MaxLineLength {
+			line = append(line, part...)
+		}
+		if isPrefix {
+			continue
+		}
+
+		if length > MaxLineLength {
+			myLogger.Warning("Skipped a line of %d bytes in %s", length, path)
+		} else if err := fn(string(line)); err != nil {
+			return err
+		}
+		line, length = line[:0], 0
+	}
+}
+
+// sortUnique sorts hosts in place and drops the duplicates
+func sortUnique(hosts *[]string) {
+	sort.Strings(*hosts)
+	unique := (*hosts)[:0]
+	for i, host := range *hosts {
+		if i == 0 || host != unique[len(unique)-1] {
+			unique = append(unique, host)
+		}
+	}
+	*hosts = unique
+}
+
+// writeRun writes the sorted and deduplicated hosts to a temporary file in dir
+func writeRun(dir string, hosts []string) (string, error) {
+	sortUnique(&hosts)
+
+	file, err := os.CreateTemp(dir, ".sort-run-*")
+	if err != nil {
+		return "", err
+	}
+	writer := bufio.NewWriter(file)
+	for _, host := range hosts {
+		if _, err = writer.WriteString(host + "\n"); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// runHead is the next host of a sorted run
+type runHead struct {
+	host    string
+	scanner *bufio.Scanner
+}
+
+type runHeap []*runHead
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].host < h[j].host }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runHead)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
+
+// mergeRuns calls fn with every host of the sorted runs and of the sorted
+// chunk in memory, in order and once each
+func mergeRuns(runs, chunk []string, fn func(host string) error) error {
+	h := &runHeap{}
+	for _, run := range runs {
+		file, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		if scanner.Scan() {
+			heap.Push(h, &runHead{host: scanner.Text(), scanner: scanner})
+		} else if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	last, i := "", 0
+	emit := func(host string) error {
+		if host == last {
+			return nil
+		}
+		last = host
+		return fn(host)
+	}
+	for h.Len() > 0 || i < len(chunk) {
+		// The chunk in memory is merged as if it was one more run
+		if h.Len() == 0 || (i < len(chunk) && chunk[i] <= (*h)[0].host) {
+			if err := emit(chunk[i]); err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+
+		head := (*h)[0]
+		if err := emit(head.host); err != nil {
+			return err
+		}
+		if head.scanner.Scan() {
+			head.host = head.scanner.Text()
+			heap.Fix(h, 0)
+		} else {
+			if err := head.scanner.Err(); err != nil {
+				return err
+			}
+			heap.Pop(h)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := map[string]string{
+		"www.ex.test":                    "www.ex.test",
+		"  WWW.Ex.Test.  ":               "www.ex.test",
+		"*.ex.test":                      "ex.test",
+		"*.*.dev.ex.test":                "dev.ex.test",
+		"_dmarc.ex.test":                 "_dmarc.ex.test",
+		"10.0.0.1":                       "10.0.0.1",
+		"":                               "",
+		".":                              "",
+		"www..ex.test":                   "",
+		"-www.ex.test":                   "",
+		"www-.ex.test":                   "",
+		"www ex.test":                    "",
+		"https://www.ex.test":            "",
+		strings.Repeat("a", 64):          "",
+		strings.Repeat("a", 63):          strings.Repeat("a", 63),
+		strings.Repeat("a.", 127) + "aa": "",
+	}
+	for host, want := range tests {
+		if got := NormalizeHost(host); got != want {
+			t.Errorf("NormalizeHost(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestSortHosts(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget int
+	}{
+		{name: "in memory", budget: 64 << 20},
+		// Every few hosts go to a run on disk, the runs are merged
+		{name: "chunked merge", budget: 64},
+		{name: "one host per run", budget: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(budget int) { SortMemoryBudget = budget }(SortMemoryBudget)
+			SortMemoryBudget = tt.budget
+
+			dir := t.TempDir()
+			first := filepath.Join(dir, "first.txt")
+			second := filepath.Join(dir, "second.txt")
+			if err := os.WriteFile(first, []byte("www.ex.test\nMAIL.ex.test.\napi.ex.test\n*.dev.ex.test\nnot a host\nwww.ex.test\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(second, []byte("api.ex.test\nzz.ex.test\n\nWWW.EX.TEST\naa.ex.test\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// The output replaces one of the inputs
+			count, err := SortHosts([]string{first, second}, first)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "aa.ex.test\napi.ex.test\ndev.ex.test\nmail.ex.test\nwww.ex.test\nzz.ex.test\n"
+			got, err := os.ReadFile(first)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want || count != 6 {
+				t.Errorf("SortHosts() = %v\n%s\nwant 6\n%s", count, got, want)
+			}
+
+			// The runs and the temporary output are removed
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 {
+				var names []string
+				for _, e := range entries {
+					names = append(names, e.Name())
+				}
+				t.Errorf("files left in the directory: %v", names)
+			}
+		})
+	}
+}
+
+func TestSortHostsMissingInput(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "out.txt")
+	if _, err := SortHosts([]string{filepath.Join(dir, "missing.txt")}, output); !os.IsNotExist(err) {
+		t.Errorf("SortHosts() with a missing input = %v, want a not exist error", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("the output was written despite the error")
+	}
+}
+
+func TestScanLinesSkipsOversizeLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	data := "a.ex.test\r\n" + strings.Repeat("x", 2*MaxLineLength) + "\n" + strings.Repeat("y", 70*1024) + "\nb.ex.test"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	if err := ScanLines(path, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || lines[0] != "a.ex.test" || len(lines[1]) != 70*1024 || lines[2] != "b.ex.test" {
+		t.Errorf("ScanLines() returned %v lines, want a.ex.test, the 70KB line and b.ex.test", len(lines))
+	}
+
+	// A merge goes on past the oversize line
+	output := filepath.Join(filepath.Dir(path), "out.txt")
+	if n, err := SortHosts([]string{path}, output); err != nil || n != 2 {
+		t.Errorf("SortHosts() = %v, %v, want the 2 hosts", n, err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package utils
+
+import "os/exec"
+
+// setProcessGroup is a no-op on platforms without process groups; the
+// command itself is still killed when its context is cancelled.
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// OutOfScopeFileName lists every host dropped by the scope in a run directory
+const OutOfScopeFileName = "out_of_scope.txt"
+
+// scopeLookupWorkers bounds the concurrent lookups done to match hosts against CIDRs
+const scopeLookupWorkers = 20
+
+// scopeBatchSize is the number of hosts of a list checked at once
+const scopeBatchSize = 4096
+
+// Scope decides which hosts may be touched. A scope file holds one rule per line:
+//
+//	*.example.com      example.com and every subdomain of it
+//	api.example.com    this exact host
+//	10.0.0.0/24        hosts resolving into the range, a bare IP is a /32
+//	!^dev\.            hosts matching the regular expression are excluded
+//
+// A host is in scope when it matches no exclude and, if any include rule is
+// given, at least one include. A nil Scope allows every host.
+type Scope struct {
+	rules     []string
+	exact     map[string]bool
+	wildcards []string
+	cidrs     []*net.IPNet
+	excludes  []*regexp.Regexp
+}
+
+// LoadScope parses the scope file at path, an empty path returns a nil Scope
+func LoadScope(path string) (*Scope, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := &Scope{exact: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if err := s.addRule(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Scope) addRule(line string) error {
+	rule := strings.TrimSpace(line)
+	if rule == "" || strings.HasPrefix(rule, "#") {
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(rule, "!"):
+		re, err := regexp.Compile(strings.TrimSpace(rule[1:]))
+		if err != nil {
+			return fmt.Errorf("invalid exclude %q: %v", rule, err)
+		}
+		s.excludes = append(s.excludes, re)
+	case strings.Contains(rule, "/"):
+		_, cidr, err := net.ParseCIDR(rule)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q: %v", rule, err)
+		}
+		s.cidrs = append(s.cidrs, cidr)
+	case net.ParseIP(rule) != nil:
+		ip := net.ParseIP(rule)
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+		s.cidrs = append(s.cidrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	case strings.HasPrefix(rule, "*."):
+		s.wildcards = append(s.wildcards, normalizeScopeHost(rule[2:]))
+	default:
+		s.exact[normalizeScopeHost(rule)] = true
+	}
+
+	s.rules = append(s.rules, rule)
+	return nil
+}
+
+// MarshalJSON returns the rules of the scope, so a changed scope changes the config hash of a stage
+func (s *Scope) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(s.rules)
+}
+
+// Allows reports whether host is in scope. Hosts are only resolved when a CIDR
+// rule is needed to decide.
+func (s *Scope) Allows(ctx context.Context, host string) bool {
+	if s == nil {
+		return true
+	}
+
+	host = normalizeScopeHost(host)
+	for _, re := range s.excludes {
+		if re.MatchString(host) {
+			return false
+		}
+	}
+
+	if len(s.exact) == 0 && len(s.wildcards) == 0 && len(s.cidrs) == 0 {
+		return true
+	}
+	if s.exact[host] {
+		return true
+	}
+	for _, zone := range s.wildcards {
+		if host == zone || strings.HasSuffix(host, "."+zone) {
+			return true
+		}
+	}
+	if len(s.cidrs) == 0 {
+		return false
+	}
+
+	// Match addresses against the ranges, resolving names first
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return false
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		for _, cidr := range s.cidrs {
+			if cidr.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// FilterFile removes the out of scope hosts from the host list at path and appends
+// them to out_of_scope.txt in outDirPath. It returns the number of hosts dropped.
+// The list is streamed in batches, the kept hosts replace it once every host is checked.
+func (s *Scope) FilterFile(ctx context.Context, path, outDirPath string) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	kept, err := os.CreateTemp(filepath.Dir(path), ".scope-kept-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(kept.Name())
+	defer kept.Close()
+	dropped, err := os.CreateTemp(outDirPath, ".scope-dropped-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(dropped.Name())
+	defer dropped.Close()
+
+	keptWriter, droppedWriter := bufio.NewWriter(kept), bufio.NewWriter(dropped)
+	droppedCount := 0
+	batch := make([]string, 0, scopeBatchSize)
+	flush := func() error {
+		for i, ok := range s.allowsAll(ctx, batch) {
+			w := keptWriter
+			if !ok {
+				w = droppedWriter
+				droppedCount++
+			}
+			if _, err := fmt.Fprintln(w, batch[i]); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		// Failed lookups of an interrupted run say nothing about the scope, keep the list as is
+		return ctx.Err()
+	}
+
+	err = ScanLines(path, func(line string) error {
+		if host := strings.TrimSpace(line); host != "" {
+			batch = append(batch, host)
+		}
+		if len(batch) < scopeBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		err = keptWriter.Flush()
+	}
+	if err == nil {
+		err = droppedWriter.Flush()
+	}
+	if err != nil || droppedCount == 0 {
+		return 0, err
+	}
+
+	if err := kept.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(kept.Name(), 0644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(kept.Name(), path); err != nil {
+		return 0, err
+	}
+
+	// The dropped hosts join the ones of the previous steps
+	outOfScope := filepath.Join(outDirPath, OutOfScopeFileName)
+	inputs := []string{dropped.Name()}
+	if _, err := os.Stat(outOfScope); err == nil {
+		inputs = append(inputs, outOfScope)
+	}
+	if _, err := SortHosts(inputs, outOfScope); err != nil {
+		return droppedCount, err
+	}
+
+	return droppedCount, nil
+}
+
+// allowsAll checks hosts concurrently, lookups may be needed for CIDR rules
+func (s *Scope) allowsAll(ctx context.Context, hosts []string) []bool {
+	allowed := make([]bool, len(hosts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < scopeLookupWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				allowed[i] = s.Allows(ctx, hosts[i])
+			}
+		}()
+	}
+	for i := range hosts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return allowed
+}
+
+// normalizeScopeHost normalizes host the way the host lists are, addresses are kept as they are
+func normalizeScopeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return NormalizeHost(host)
+}
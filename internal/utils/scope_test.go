@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeScope(t *testing.T, rules ...string) *Scope {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "scope.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(rules, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := LoadScope(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScopeAllows(t *testing.T) {
+	s := writeScope(t, "# in scope", "*.ex.test", "api.other.test", "10.0.0.0/24", "192.0.2.7", "2001:db8:0::7", "!^dev\\.", "")
+
+	tests := map[string]bool{
+		"ex.test":           true,
+		"www.ex.test":       true,
+		"WWW.EX.TEST.":      true,
+		"dev.ex.test":       false,
+		"notex.test":        false,
+		"api.other.test":    true,
+		"www.other.test":    false,
+		"10.0.0.42":         true,
+		"10.0.1.1":          false,
+		"192.0.2.7":         true,
+		"192.0.2.8":         false,
+		"nothing.invalid.":  false,
+		" Api.Other.Test. ": true,
+		"*.www.ex.test":     true,
+		"2001:DB8::7":       true,
+	}
+	for host, want := range tests {
+		if got := s.Allows(context.Background(), host); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestScopeExcludesOnly(t *testing.T) {
+	s := writeScope(t, "!staging")
+	if !s.Allows(context.Background(), "www.ex.test") || s.Allows(context.Background(), "staging.ex.test") {
+		t.Error("a scope of excludes only must allow every other host")
+	}
+
+	var none *Scope
+	if !none.Allows(context.Background(), "anything.test") {
+		t.Error("a nil scope must allow every host")
+	}
+}
+
+func TestLoadScopeErrors(t *testing.T) {
+	for _, rule := range []string{"10.0.0.0/33", "![unclosed"} {
+		path := filepath.Join(t.TempDir(), "scope.txt")
+		os.WriteFile(path, []byte("*.ex.test\n"+rule+"\n"), 0644)
+		_, err := LoadScope(path)
+		if err == nil || !strings.Contains(err.Error(), ":2:") {
+			t.Errorf("LoadScope with %q = %v, want an error on line 2", rule, err)
+		}
+	}
+
+	if s, err := LoadScope(""); s != nil || err != nil {
+		t.Errorf("LoadScope(\"\") = %v, %v, want nil, nil", s, err)
+	}
+}
+
+func TestScopeMarshalJSON(t *testing.T) {
+	s := writeScope(t, "*.ex.test", "# comment", "!^dev\\.")
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `["*.ex.test","!^dev\\."]` {
+		t.Errorf("MarshalJSON = %s", data)
+	}
+}
+
+func TestFilterFile(t *testing.T) {
+	s := writeScope(t, "*.ex.test")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts.txt")
+	if err := os.WriteFile(path, []byte("www.ex.test\nwww.other.test\napi.ex.test\ncdn.other.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped, err := s.FilterFile(context.Background(), path, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 2 {
+		t.Errorf("dropped = %v, want 2", dropped)
+	}
+
+	kept, _ := os.ReadFile(path)
+	if string(kept) != "www.ex.test\napi.ex.test\n" {
+		t.Errorf("kept = %q", kept)
+	}
+	out, _ := os.ReadFile(filepath.Join(dir, OutOfScopeFileName))
+	if string(out) != "cdn.other.test\nwww.other.test\n" {
+		t.Errorf("%s = %q", OutOfScopeFileName, out)
+	}
+}
+
+func TestFilterFileBatches(t *testing.T) {
+	s := writeScope(t, "*.ex.test")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts.txt")
+
+	var list, want strings.Builder
+	for i := 0; i < 3*scopeBatchSize; i++ {
+		if i%3 == 0 {
+			fmt.Fprintf(&list, "h%d.other.test\n", i)
+			continue
+		}
+		fmt.Fprintf(&list, "h%d.ex.test\n", i)
+		fmt.Fprintf(&want, "h%d.ex.test\n", i)
+	}
+	if err := os.WriteFile(path, []byte(list.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outOfScope := filepath.Join(dir, OutOfScopeFileName)
+	if err := os.WriteFile(outOfScope, []byte("old.other.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped, err := s.FilterFile(context.Background(), path, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != scopeBatchSize {
+		t.Errorf("dropped = %v, want %v", dropped, scopeBatchSize)
+	}
+	if kept, _ := os.ReadFile(path); string(kept) != want.String() {
+		t.Errorf("kept %v bytes, want the %v bytes of the in scope hosts in order", len(kept), want.Len())
+	}
+	if n, _ := CountLines(outOfScope); n != scopeBatchSize+1 {
+		t.Errorf("%s has %v lines, want the previous host and the dropped ones", OutOfScopeFileName, n)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			t.Errorf("temporary file %s left behind", e.Name())
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// StateFileName is the checkpoint file kept in every run directory
+const StateFileName = ".r3conwhal3_state.json"
+
+// Stage statuses recorded in the state file
+const (
+	StageDone        = "done"
+	StageFailed      = "failed"
+	StageInterrupted = "interrupted"
+)
+
+// StageState records the outcome of a single stage of a run
+type StageState struct {
+	Status     string    `json:"status"`
+	ConfigHash string    `json:"config_hash"`
+	Outputs    []string  `json:"outputs,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// RunState is the checkpoint of a run, used to resume it later
+type RunState struct {
+	Domain    string                 `json:"domain"`
+	ConfigDir string                 `json:"config_dir"`
+	ScopeFile string                 `json:"scope_file,omitempty"`
+	Modules   []string               `json:"modules"`
+	StartedAt time.Time              `json:"started_at"`
+	Stages    map[string]*StageState `json:"stages"`
+
+	dir string
+	mu  sync.Mutex
+}
+
+// NewRunState creates the checkpoint of a new run in dir and writes it to disk
+func NewRunState(dir, domain, configDir, scopeFile string, modules []string) (*RunState, error) {
+	// The stage configs hold paths under the run directory, keep them the same when resuming from elsewhere
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Keep the config dir and scope file usable when resuming from another working directory
+	if configDir != "embedded" {
+		if abs, err := filepath.Abs(configDir); err == nil {
+			configDir = abs
+		}
+	}
+	if scopeFile != "" {
+		if abs, err := filepath.Abs(scopeFile); err == nil {
+			scopeFile = abs
+		}
+	}
+
+	s := &RunState{
+		Domain:    domain,
+		ConfigDir: configDir,
+		ScopeFile: scopeFile,
+		Modules:   modules,
+		StartedAt: time.Now(),
+		Stages:    make(map[string]*StageState),
+		dir:       dir,
+	}
+
+	return s, s.Save()
+}
+
+// LoadRunState reads the checkpoint of the run in dir
+func LoadRunState(dir string) (*RunState, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, StateFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+
+	s := &RunState{dir: dir}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %v", err)
+	}
+	if s.Stages == nil {
+		s.Stages = make(map[string]*StageState)
+	}
+
+	return s, nil
+}
+
+// Dir returns the absolute path of the run directory
+func (s *RunState) Dir() string {
+	return s.dir
+}
+
+// Save writes the checkpoint to the run directory, replacing the previous one atomically
+func (s *RunState) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, StateFileName)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// IsDone reports whether stage finished with the given config and all of its outputs are still there
+func (s *RunState) IsDone(stage, configHash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.Stages[stage]
+	if !ok || st.Status != StageDone || st.ConfigHash != configHash {
+		return false
+	}
+	for _, output := range st.Outputs {
+		if _, err := os.Stat(filepath.Join(s.dir, output)); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Finish records the outcome of stage and saves the checkpoint.
+// Only the outputs that exist in the run directory are recorded.
+func (s *RunState) Finish(stage, configHash string, outputs []string, stageErr error) error {
+	st := &StageState{
+		Status:     StageDone,
+		ConfigHash: configHash,
+		FinishedAt: time.Now(),
+	}
+	if stageErr != nil {
+		st.Status = StageFailed
+		st.Error = stageErr.Error()
+	}
+
+	for _, output := range outputs {
+		if _, err := os.Stat(filepath.Join(s.dir, output)); err == nil {
+			st.Outputs = append(st.Outputs, output)
+		}
+	}
+
+	s.mu.Lock()
+	s.Stages[stage] = st
+	s.mu.Unlock()
+
+	return s.Save()
+}
+
+// Interrupt marks stage as interrupted and saves the checkpoint
+func (s *RunState) Interrupt(stage, configHash string) error {
+	s.mu.Lock()
+	s.Stages[stage] = &StageState{
+		Status:     StageInterrupted,
+		ConfigHash: configHash,
+		FinishedAt: time.Now(),
+	}
+	s.mu.Unlock()
+
+	return s.Save()
+}
+
+// ConfigHash returns a stable hash of a stage config, used to detect config changes between runs.
+// The paths under volatileDir, which changes from one run to the next, hash the same on every run.
+func ConfigHash(cfg interface{}, volatileDir string) string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	if volatileDir != "" {
+		// The directory is replaced as it appears in the JSON strings
+		dir, _ := json.Marshal(volatileDir)
+		data = bytes.ReplaceAll(data, bytes.Trim(dir, `"`), []byte("$WORKSPACE"))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
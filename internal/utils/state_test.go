@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunState(t *testing.T) {
+	dir := t.TempDir()
+	state, err := NewRunState(dir, "ex.test", "embedded", "", []string{"passive", "active", "filter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "passive.txt"), []byte("www.ex.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := state.Finish("passive", "hash-p", []string{"passive.txt", "missing.txt"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Finish("active", "hash-a", nil, errors.New("resolver failed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Interrupt("filter", "hash-f"); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadRunState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Domain != "ex.test" || len(loaded.Modules) != 3 {
+		t.Errorf("loaded state = %+v", loaded)
+	}
+	if st := loaded.Stages["passive"]; st == nil || len(st.Outputs) != 1 || st.Outputs[0] != "passive.txt" {
+		t.Errorf("passive stage = %+v, want only the existing output", st)
+	}
+	if st := loaded.Stages["active"]; st == nil || st.Status != StageFailed || st.Error != "resolver failed" {
+		t.Errorf("active stage = %+v", st)
+	}
+
+	tests := []struct {
+		stage, hash string
+		want        bool
+	}{
+		{"passive", "hash-p", true},
+		{"passive", "hash-changed", false},
+		{"active", "hash-a", false},
+		{"filter", "hash-f", false},
+		{"webops", "hash-w", false},
+	}
+	for _, tt := range tests {
+		if got := loaded.IsDone(tt.stage, tt.hash); got != tt.want {
+			t.Errorf("IsDone(%s, %s) = %v, want %v", tt.stage, tt.hash, got, tt.want)
+		}
+	}
+
+	// A removed output makes the stage run again
+	if err := os.Remove(filepath.Join(dir, "passive.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.IsDone("passive", "hash-p") {
+		t.Error("IsDone() with a removed output = true")
+	}
+
+	if _, err := LoadRunState(t.TempDir()); err == nil {
+		t.Error("LoadRunState() of a directory without state file succeeded")
+	}
+}
+
+func TestRunStateDir(t *testing.T) {
+	parent := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(parent); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := os.Mkdir("run", 0755); err != nil {
+		t.Fatal(err)
+	}
+	state, err := NewRunState("run", "ex.test", "embedded", "", []string{"passive"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs := filepath.Join(parent, "run")
+	if state.Dir() != abs {
+		t.Errorf("Dir() = %s, want %s", state.Dir(), abs)
+	}
+
+	// A stage config holds the run directory, resuming through another path hashes the same
+	stageConfig := func(dir, workspace string) string {
+		cfg := map[string]string{"out": dir, "wordlist": filepath.Join(workspace, "words.txt")}
+		return ConfigHash(cfg, workspace)
+	}
+	hash := stageConfig(state.Dir(), "/tmp/r3conwhal3-111")
+	if err := state.Finish("passive", hash, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"run", "./run/", abs} {
+		loaded, err := LoadRunState(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !loaded.IsDone("passive", stageConfig(loaded.Dir(), "/tmp/r3conwhal3-222")) {
+			t.Errorf("stage not done when resumed from %s", path)
+		}
+	}
+}
+
+func TestConfigHashStages(t *testing.T) {
+	dir := t.TempDir()
+	state, err := NewRunState(dir, "ex.test", "embedded", "", []string{"passive", "active"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passive := map[string]interface{}{"threads": 10, "wordlist": "/tmp/r3conwhal3-111/words.txt"}
+	active := map[string]interface{}{"depth": 1, "resolvers": "/tmp/r3conwhal3-111/resolvers.txt"}
+	for stage, cfg := range map[string]interface{}{"passive": passive, "active": active} {
+		if err := state.Finish(stage, ConfigHash(cfg, "/tmp/r3conwhal3-111"), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the stage whose config changed runs again
+	resumed := map[string]interface{}{"depth": 2, "resolvers": "/tmp/r3conwhal3-222/resolvers.txt"}
+	passive["wordlist"] = "/tmp/r3conwhal3-222/words.txt"
+	if !state.IsDone("passive", ConfigHash(passive, "/tmp/r3conwhal3-222")) {
+		t.Error("passive stage with the same config is not done")
+	}
+	if state.IsDone("active", ConfigHash(resumed, "/tmp/r3conwhal3-222")) {
+		t.Error("active stage with a changed config is done")
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bufio"
+	"context"
 	"embed"
 	"fmt"
 	"io"
@@ -20,7 +21,10 @@ var (
 	myLogger = logger.GetLogger()
 )
 
-func RunCommand(command string, args ...interface{}) ([]byte, error) {
+// RunCommand runs command with args and returns its combined output. The command
+// and all of its children are killed when ctx is cancelled; whatever it printed
+// until then is returned together with the error.
+func RunCommand(ctx context.Context, command string, args ...interface{}) ([]byte, error) {
 
 	var strArgs []string
 	for _, arg := range args {
@@ -36,12 +40,18 @@ func RunCommand(command string, args ...interface{}) ([]byte, error) {
 		}
 	}
 
-	cmd := exec.Command(command, strArgs...)
+	cmd := exec.CommandContext(ctx, command, strArgs...)
+	setProcessGroup(cmd)
+	// Don't wait forever on pipes held open by orphaned grandchildren
+	cmd.WaitDelay = 5 * time.Second
 
 	// Capture command output
 	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return output, fmt.Errorf("%s interrupted: %w", command, ctx.Err())
+	}
 	if err != nil {
-		return nil, fmt.Errorf("\n[-]error running %s: %v\n%s", command, err, output)
+		return output, fmt.Errorf("\n[-]error running %s: %v\n%s", command, err, output)
 	}
 
 	return output, nil
@@ -75,9 +85,9 @@ func ShowProgress() {
 	}
 }
 
-func LogElapsedTime(startTime time.Time, operation string) {
+func LogElapsedTime(log logger.Logger, startTime time.Time, operation string) {
 	elapsedTime := time.Since(startTime)
-	myLogger.Info("%s completed in %s\n", operation, elapsedTime)
+	log.Info("%s completed in %s\n", operation, elapsedTime)
 }
 
 func CheckInstallations(tools []string) error {
@@ -134,54 +144,10 @@ func CountLines(filename string) (int, error) {
 	return lineCount, nil
 }
 
-// Remove duplicates from the given file
+// Remove duplicates from the given file, its hosts are normalized and sorted
 func RemoveDuplicatesFromFile(filename string) error {
-	// Open the file with read and write permissions
-	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// Create scanner to read the file line by line
-	scanner := bufio.NewScanner(file)
-
-	// Create a map to store unique lines
-	uniqueLines := make(map[string]bool)
-
-	// Scan the file line by line
-	for scanner.Scan() {
-		// Read the current line
-		line := scanner.Text()
-		uniqueLines[line] = true
-	}
-
-	if err := scanner.Err(); err != nil {
-		return err
-	}
-
-	// Move the file cursor to the beginning
-	if _, err := file.Seek(0, 0); err != nil {
-		return err
-	}
-
-	// Truncate the file to remove existing content
-	if err := file.Truncate(0); err != nil {
-		return err
-	}
-
-	// Writes to file without duplicates
-	writer := bufio.NewWriter(file)
-
-	for line := range uniqueLines {
-		// Write each unique line to the file
-		fmt.Fprintln(writer, line)
-	}
-
-	// ensure all data is written to the file
-	writer.Flush()
-
-	return nil
+	_, err := SortHosts([]string{filename}, filename)
+	return err
 }
 
 func CreateDir(dirName, domain string) (string, error) {
@@ -193,24 +159,38 @@ func CreateDir(dirName, domain string) (string, error) {
 		}
 	}
 
-	// Extracting the target domain name
-	domainPrefix := strings.Split(domain, ".")[0]
-
 	// Get the current timestamp
 	timestamp := time.Now().Format("2006-01-02-15:04")
 
-	// Combine domain prefix with timestamp
-	subdirName := fmt.Sprintf("%s_%s", domainPrefix, timestamp)
+	// Combine the full domain with timestamp, so example.com and example.org never share a directory
+	subdirName := fmt.Sprintf("%s_%s", sanitizeDirName(domain), timestamp)
 
-	// Create the subdirectory
+	// Create the subdirectory, never reusing the directory of another run started in the same minute
 	subdirPath := filepath.Join(dirName, subdirName)
-	if err := os.MkdirAll(subdirPath, os.ModePerm); err != nil {
-		return "", fmt.Errorf("error creating subdirectory: %v", err)
+	for i := 2; ; i++ {
+		err := os.Mkdir(subdirPath, os.ModePerm)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("error creating subdirectory: %v", err)
+		}
+		subdirPath = filepath.Join(dirName, fmt.Sprintf("%s-%d", subdirName, i))
 	}
 
 	return subdirPath, nil
 }
 
+// sanitizeDirName lowercases domain and replaces the characters not allowed in a host name with "_"
+func sanitizeDirName(domain string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(strings.Trim(domain, ". ")))
+}
+
 // print banner in ascii art format
 func Banner(bannerPath string) {
 	b, err := os.ReadFile(bannerPath)
@@ -220,10 +200,8 @@ func Banner(bannerPath string) {
 	fmt.Println(color.CyanString(string(b)))
 }
 
-// ExtractEmbeddedFileToTempDir reads an embedded file and writes it to a temporary directory named ".tmp", returning the path to the newly created temporary file.
-func ExtractEmbeddedFileToTempDir(docFS embed.FS, embeddedFilePath, tempFileName string) (string, error) {
-	tempDir := ".tmp" // Hardcoded temporary directory
-
+// ExtractEmbeddedFileToTempDir reads an embedded file and writes it to tempDir, returning the path to the newly created temporary file.
+func ExtractEmbeddedFileToTempDir(docFS embed.FS, tempDir, embeddedFilePath, tempFileName string) (string, error) {
 	// Ensure the temporary directory exists
 	if err := os.MkdirAll(tempDir, os.ModePerm); err != nil {
 		return "", fmt.Errorf("failed to create temporary directory: %v", err)
@@ -244,9 +222,10 @@ func ExtractEmbeddedFileToTempDir(docFS embed.FS, embeddedFilePath, tempFileName
 	return tmpFilePath, nil
 }
 
-// It search for existence of specificFiles in the given directory and merge them to a new file
-func MergeFiles(pathToDir, outFileName string, specificFiles []string) error {
-	var mergedContent []byte
+// It search for existence of specificFiles in the given directory and merge them to a new file.
+// The merged hosts are normalized, sorted and deduplicated.
+func MergeFiles(log logger.Logger, pathToDir, outFileName string, specificFiles []string) error {
+	var inputs []string
 
 	// Iterate over the list of specific values
 	for _, fileName := range specificFiles {
@@ -256,48 +235,21 @@ func MergeFiles(pathToDir, outFileName string, specificFiles []string) error {
 		if _, err := os.Stat(filePath); err != nil {
 			if os.IsNotExist(err) {
 				// The file does not exist, so it needs to be handled
-				myLogger.Warning("File does not exist: %s", filePath)
+				log.Warning("File does not exist: %s", filePath)
 				continue // Skip this file
 			} else {
 				return err
 			}
 		}
 
-		// Read the content of the file
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			return err
-		}
-
-		// Append the content of current file to the mergedContent
-		mergedContent = append(mergedContent, content...)
+		inputs = append(inputs, filePath)
 	}
 
 	// Construct the path for outFileName
 	outPath := filepath.Join(pathToDir, outFileName)
 
-	// Write the merged content to the specified file
-	err := os.WriteFile(outPath, mergedContent, 0644)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Clean unnecessary resources such as tmp files
-func CleanUp() {
-	// Delete tmp dir and all its contents
-	tmpDir := ".tmp"
-	if err := os.RemoveAll(tmpDir); err != nil {
-		myLogger.Error("Error deleting tmp directory: %v\n", err)
-	}
-
-	// Delete noisy output of subzy
-	subzyDir := os.ExpandEnv("$HOME/subzy")
-	if err := os.RemoveAll(subzyDir); err != nil && !os.IsNotExist(err) {
-		myLogger.Error("Error deleting subzy directory: %v\n", err)
-	}
+	_, err := SortHosts(inputs, outPath)
+	return err
 }
 
 // Copy file from src to dst
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateDir(t *testing.T) {
+	base := t.TempDir()
+
+	com, err := CreateDir(base, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	org, err := CreateDir(base, "Example.ORG.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if com == org {
+		t.Fatalf("example.com and example.org share %s", com)
+	}
+	if !strings.HasPrefix(filepath.Base(com), "example.com_") || !strings.HasPrefix(filepath.Base(org), "example.org_") {
+		t.Errorf("run dirs = %s, %s, want the full domain as prefix", com, org)
+	}
+
+	// A second run in the same minute gets its own directory
+	again, err := CreateDir(base, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == com {
+		t.Errorf("second run reused %s", com)
+	}
+}
+
+func TestSanitizeDirName(t *testing.T) {
+	tests := map[string]string{
+		"example.com":        "example.com",
+		"Sub.Example.COM.":   "sub.example.com",
+		"a/b\\c:d.test":      "a_b_c_d.test",
+		"xn--bcher-kva.test": "xn--bcher-kva.test",
+	}
+	for in, want := range tests {
+		if got := sanitizeDirName(in); got != want {
+			t.Errorf("sanitizeDirName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
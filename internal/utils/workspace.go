@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ownerFileName marks a workspace with the PID of the run that created it
+const ownerFileName = ".owner"
+
+// Workspace is the temporary directory of a run. Every run gets its own, so
+// runs started from the same directory never see each other's files.
+type Workspace struct {
+	Dir  string
+	keep bool
+}
+
+// NewWorkspace creates a workspace in the system temporary directory ($TMPDIR).
+// With keep the workspace is left on disk by CleanUp, for debugging.
+func NewWorkspace(keep bool) (*Workspace, error) {
+	dir, err := os.MkdirTemp("", "r3conwhal3-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+
+	owner := []byte(strconv.Itoa(os.Getpid()))
+	if err := os.WriteFile(filepath.Join(dir, ownerFileName), owner, 0644); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+
+	return &Workspace{Dir: dir, keep: keep}, nil
+}
+
+// Path joins elem to the workspace directory
+func (w *Workspace) Path(elem ...string) string {
+	return filepath.Join(append([]string{w.Dir}, elem...)...)
+}
+
+// Keep leaves the workspace on disk at CleanUp, for files still in use
+func (w *Workspace) Keep() {
+	w.keep = true
+}
+
+// CleanUp removes the workspace and all its contents, unless it is kept or
+// was not created by this process
+func (w *Workspace) CleanUp() {
+	if w.keep {
+		myLogger.Info("Temporary files kept in %s", w.Dir)
+		return
+	}
+
+	owner, err := os.ReadFile(filepath.Join(w.Dir, ownerFileName))
+	if err != nil || strings.TrimSpace(string(owner)) != strconv.Itoa(os.Getpid()) {
+		myLogger.Warning("Not deleting %s, it is not the temporary directory of this run", w.Dir)
+		return
+	}
+
+	if err := os.RemoveAll(w.Dir); err != nil {
+		myLogger.Error("Error deleting tmp directory: %v\n", err)
+	}
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWorkspaceCleanUp(t *testing.T) {
+	ws, err := NewWorkspace(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.CleanUp()
+	if _, err := os.Stat(ws.Dir); !os.IsNotExist(err) {
+		t.Errorf("workspace %s still exists after CleanUp", ws.Dir)
+	}
+
+	// A workspace still in use is left on disk
+	ws, err = NewWorkspace(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(ws.Dir) })
+	ws.Keep()
+	ws.CleanUp()
+	if _, err := os.Stat(ws.Dir); err != nil {
+		t.Errorf("kept workspace removed: %v", err)
+	}
+}
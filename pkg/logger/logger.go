@@ -1,10 +1,19 @@
 package logger
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/fatih/color"
 )
@@ -22,10 +31,28 @@ func init() {
 
 }
 
+// GetLogger returns the logger shared by every package. Packages keep it in a
+// variable at init time, so it is configured in place by SetLevel, SetJSON and AddFile.
 func GetLogger() Logger {
 	return myLogger
 }
 
+// ctxKey is the context key of the logger carried by a context
+type ctxKey struct{}
+
+// NewContext returns a copy of ctx carrying l, the code running under it logs through l
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the shared logger if there is none
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(ctxKey{}).(Logger); ok {
+		return l
+	}
+	return myLogger
+}
+
 type Logger interface {
 	Info(format string, args ...interface{})
 	Warning(format string, args ...interface{})
@@ -33,70 +60,277 @@ type Logger interface {
 	Debug(format string, args ...interface{})
 }
 
+// Level is the severity of a log line, lines below the level of the logger are dropped
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+var levels = []struct {
+	name  string
+	tag   string
+	color func(format string, a ...interface{}) string
+}{
+	LevelDebug:   {"debug", "[DBG]", color.CyanString},
+	LevelInfo:    {"info", "[INF]", color.GreenString},
+	LevelWarning: {"warning", "[WRN]", color.YellowString},
+	LevelError:   {"error", "[ERR]", color.RedString},
+}
+
+func (l Level) String() string {
+	return levels[l].name
+}
+
+// ParseLevel returns the level named s: debug, info, warning (or warn) or error
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warn" {
+		return LevelWarning, nil
+	}
+	for l, level := range levels {
+		if level.name == s {
+			return Level(l), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info, warning or error", s)
+}
+
+// Fields are key/value pairs attached to every line of a logger, such as the target and the module
+type Fields map[string]string
+
+// ansi matches the color codes of messages formatted with the color package
+var ansi = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// sink is a destination of the log lines
+type sink struct {
+	w     io.Writer
+	color bool
+	// flags are the log package flags of the text lines written to a file
+	flags int
+	// target only takes the lines of this target and the ones of no target, "" takes every line
+	target string
+}
+
+// core is the state shared by a logger and the loggers derived from it with With
+type core struct {
+	mu     sync.Mutex
+	level  Level
+	json   bool
+	flags  [4]int
+	stdout *sink
+	files  []*sink
+}
+
 // defaultLogger is the default implementation of the Logger interface.
 type defaultLogger struct {
-	infoLogger    *log.Logger
-	warningLogger *log.Logger
-	errorLogger   *log.Logger
-	debugLogger   *log.Logger
-	mu            sync.Mutex
+	core   *core
+	fields Fields
 }
 
 // NewLogger creates a new instance of the defaultLogger with optional configurations.
+// The flags are the log package flags of the text lines written to stdout.
 func NewLogger(infoFlags, warningFlags, errorFlags int) (Logger, error) {
-	infoLogger := log.New(os.Stdout, color.GreenString("[INF] "), infoFlags)
-	if infoLogger == nil {
-		return nil, fmt.Errorf("failed to create info logger")
+	c := &core{
+		level: LevelInfo,
+		flags: [4]int{
+			LevelDebug:   log.Ldate | log.Ltime | log.Lshortfile,
+			LevelInfo:    infoFlags,
+			LevelWarning: warningFlags,
+			LevelError:   errorFlags,
+		},
+		// color turns itself off when stdout is not a terminal
+		stdout: &sink{w: os.Stdout, color: !color.NoColor},
 	}
 
-	warningLogger := log.New(os.Stdout, color.YellowString("[WRN] "), warningFlags)
-	if warningLogger == nil {
-		return nil, fmt.Errorf("failed to create warning logger")
+	return &defaultLogger{core: c}, nil
+}
+
+func (l *defaultLogger) Info(format string, args ...interface{}) {
+	l.log(LevelInfo, format, args...)
+}
+
+func (l *defaultLogger) Warning(format string, args ...interface{}) {
+	l.log(LevelWarning, format, args...)
+}
+
+func (l *defaultLogger) Error(format string, args ...interface{}) {
+	l.log(LevelError, format, args...)
+}
+
+func (l *defaultLogger) Debug(format string, args ...interface{}) {
+	l.log(LevelDebug, format, args...)
+}
+
+// With returns a logger writing the lines of l with fields attached.
+// Loggers not created by this package are returned as is.
+func With(l Logger, fields Fields) Logger {
+	dl, ok := l.(*defaultLogger)
+	if !ok {
+		return l
 	}
 
-	errorLogger := log.New(os.Stdout, color.RedString("[ERR] "), errorFlags)
-	if errorLogger == nil {
-		return nil, fmt.Errorf("failed to create error logger")
+	merged := make(Fields, len(dl.fields)+len(fields))
+	for k, v := range dl.fields {
+		merged[k] = v
 	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return &defaultLogger{core: dl.core, fields: merged}
+}
+
+// SetLevel drops the lines of the shared logger below level
+func SetLevel(level Level) {
+	c := myLogger.(*defaultLogger).core
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.level = level
+}
 
-	debugLogger := log.New(os.Stdout, color.CyanString("[DBG] "), log.Ldate|log.Ltime|log.Lshortfile)
-	if debugLogger == nil {
-		return nil, fmt.Errorf("failed to create debug logger")
+// SetJSON switches the shared logger to one JSON object per line, for log ingestion
+func SetJSON(enabled bool) {
+	c := myLogger.(*defaultLogger).core
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.json = enabled
+}
+
+// AddFile appends the lines of the shared logger to the file at path until the
+// returned closer is closed. With a target, the lines of other targets are left out.
+func AddFile(path, target string) (io.Closer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
 	}
 
-	return &defaultLogger{
-		infoLogger:    infoLogger,
-		warningLogger: warningLogger,
-		errorLogger:   errorLogger,
-		debugLogger:   debugLogger,
-	}, nil
+	c := myLogger.(*defaultLogger).core
+	s := &sink{w: file, flags: log.LstdFlags, target: target}
+	c.mu.Lock()
+	c.files = append(c.files, s)
+	c.mu.Unlock()
+
+	return closerFunc(func() error {
+		c.mu.Lock()
+		for i, f := range c.files {
+			if f == s {
+				c.files = append(c.files[:i], c.files[i+1:]...)
+				break
+			}
+		}
+		c.mu.Unlock()
+		return file.Close()
+	}), nil
 }
 
-func (l *defaultLogger) Info(format string, args ...interface{}) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func (l *defaultLogger) log(level Level, format string, args ...interface{}) {
+	c := l.core
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if level < c.level {
+		return
+	}
+
+	now := time.Now()
 	message := fmt.Sprintf(format, args...)
-	l.infoLogger.Println(message)
+	file, line := "???", 0
+	if c.flags[level]&(log.Lshortfile|log.Llongfile) != 0 {
+		if _, f, n, ok := runtime.Caller(2); ok {
+			file, line = f, n
+		}
+	}
 
+	for _, s := range append([]*sink{c.stdout}, c.files...) {
+		if s.target != "" && l.fields["target"] != "" && l.fields["target"] != s.target {
+			continue
+		}
+		// stdout keeps the flags the logger was created with, files are always timestamped
+		flags := s.flags
+		if s == c.stdout {
+			flags = c.flags[level]
+		}
+
+		var out string
+		if c.json {
+			out = l.jsonLine(level, now, message)
+		} else {
+			out = l.textLine(level, now, message, s.color, flags, file, line)
+		}
+		io.WriteString(s.w, out)
+	}
 }
 
-func (l *defaultLogger) Warning(format string, args ...interface{}) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	message := fmt.Sprintf(format, args...)
-	l.warningLogger.Println(message)
+// textLine formats a line as the tag of its level, the message and the fields as key=value
+func (l *defaultLogger) textLine(level Level, now time.Time, message string, colored bool, flags int, file string, line int) string {
+	var b strings.Builder
+
+	tag := levels[level].tag
+	if colored {
+		tag = levels[level].color(tag)
+	} else {
+		message = ansi.ReplaceAllString(message, "")
+	}
+	b.WriteString(tag + " ")
+
+	if flags&log.Ldate != 0 {
+		b.WriteString(now.Format("2006/01/02 "))
+	}
+	if flags&(log.Ltime|log.Lmicroseconds) != 0 {
+		if flags&log.Lmicroseconds != 0 {
+			b.WriteString(now.Format("15:04:05.000000 "))
+		} else {
+			b.WriteString(now.Format("15:04:05 "))
+		}
+	}
+	if flags&(log.Lshortfile|log.Llongfile) != 0 {
+		if flags&log.Lshortfile != 0 {
+			file = filepath.Base(file)
+		}
+		fmt.Fprintf(&b, "%s:%d: ", file, line)
+	}
+
+	b.WriteString(strings.TrimRight(message, "\n"))
+	for _, k := range l.fieldKeys() {
+		fmt.Fprintf(&b, " %s=%s", k, l.fields[k])
+	}
+	b.WriteString("\n")
+
+	return b.String()
 }
 
-func (l *defaultLogger) Error(format string, args ...interface{}) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	message := fmt.Sprintf(format, args...)
-	l.errorLogger.Println(message)
+// jsonLine formats a line as a JSON object with the time, level, message and fields
+func (l *defaultLogger) jsonLine(level Level, now time.Time, message string) string {
+	entry := map[string]string{
+		"time":    now.Format(time.RFC3339Nano),
+		"level":   level.String(),
+		"message": strings.TrimSpace(strings.TrimLeft(ansi.ReplaceAllString(message, ""), "\r")),
+	}
+	for k, v := range l.fields {
+		if _, ok := entry[k]; !ok {
+			entry[k] = v
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return ""
+	}
+	return string(data) + "\n"
 }
 
-func (l *defaultLogger) Debug(format string, args ...interface{}) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	message := fmt.Sprintf(format, args...)
-	l.debugLogger.Println(message)
+func (l *defaultLogger) fieldKeys() []string {
+	keys := make([]string, 0, len(l.fields))
+	for k := range l.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,174 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestLogger returns a logger writing uncolored lines to the returned buffer
+func newTestLogger(t *testing.T) (*defaultLogger, *bytes.Buffer) {
+	t.Helper()
+
+	l, err := NewLogger(0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	dl := l.(*defaultLogger)
+	dl.core.stdout = &sink{w: &buf}
+
+	return dl, &buf
+}
+
+// silenceShared keeps the shared logger off stdout until the test ends
+func silenceShared(t *testing.T) {
+	c := myLogger.(*defaultLogger).core
+	c.mu.Lock()
+	stdout := c.stdout
+	c.stdout = &sink{w: io.Discard}
+	c.mu.Unlock()
+
+	t.Cleanup(func() {
+		c.mu.Lock()
+		c.stdout = stdout
+		c.mu.Unlock()
+	})
+}
+
+func TestWith(t *testing.T) {
+	l, buf := newTestLogger(t)
+
+	target := With(l, Fields{"target": "ex.test"})
+	With(target, Fields{"module": "passive"}).Info("found %d", 3)
+	target.Warning("\x1b[31mdone\x1b[0m\n")
+
+	want := "[INF] found 3 module=passive target=ex.test\n[WRN] done target=ex.test\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	// The parent keeps its own fields
+	buf.Reset()
+	l.Info("run")
+	if got := buf.String(); got != "[INF] run\n" {
+		t.Errorf("parent output = %q, want no fields", got)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	l, buf := newTestLogger(t)
+
+	l.Debug("hidden")
+	l.core.level = LevelWarning
+	l.Info("hidden")
+	l.Warning("shown")
+	l.Error("shown")
+
+	if got := buf.String(); got != "[WRN] shown\n[ERR] shown\n" {
+		t.Errorf("output = %q, want only the warning and error", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	l, buf := newTestLogger(t)
+	l.core.json = true
+
+	With(l, Fields{"target": "ex.test", "message": "ignored"}).Info("\r\x1b[32mfound\x1b[0m \n")
+
+	var entry map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("output %q is not JSON: %v", buf.String(), err)
+	}
+	if entry["level"] != "info" || entry["message"] != "found" || entry["target"] != "ex.test" || entry["time"] == "" {
+		t.Errorf("entry = %v", entry)
+	}
+}
+
+func TestAddFileTarget(t *testing.T) {
+	silenceShared(t)
+
+	dir := t.TempDir()
+	closers := make([]io.Closer, 0, 2)
+	for _, target := range []string{"a.test", "b.test"} {
+		c, err := AddFile(filepath.Join(dir, target+".log"), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closers = append(closers, c)
+	}
+
+	With(GetLogger(), Fields{"target": "a.test"}).Info("line of a")
+	With(GetLogger(), Fields{"target": "b.test", "module": "passive"}).Info("line of b")
+	GetLogger().Info("line of the run")
+
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Lines after Close are not written
+	GetLogger().Info("after close")
+
+	tests := []struct {
+		file    string
+		want    []string
+		notWant []string
+	}{
+		{"a.test.log", []string{"line of a", "line of the run"}, []string{"line of b", "after close"}},
+		{"b.test.log", []string{"line of b", "line of the run"}, []string{"line of a", "after close"}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("%s = %q, want %q in it", tt.file, data, s)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(string(data), s) {
+				t.Errorf("%s = %q, want no %q in it", tt.file, data, s)
+			}
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != GetLogger() {
+		t.Errorf("FromContext(empty) = %v, want the shared logger", got)
+	}
+
+	l := With(GetLogger(), Fields{"target": "ex.test"})
+	if got := FromContext(NewContext(context.Background(), l)); got != l {
+		t.Errorf("FromContext() = %v, want the logger of the context", got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Level
+		wantErr bool
+	}{
+		{"debug", LevelDebug, false},
+		{" INFO ", LevelInfo, false},
+		{"warn", LevelWarning, false},
+		{"warning", LevelWarning, false},
+		{"error", LevelError, false},
+		{"verbose", LevelInfo, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevel(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+// Package permute generates subdomain candidates from known subdomains by
+// inserting and joining words, shifting numbers and reusing the words the
+// known subdomains are made of.
+package permute
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxLabelLength and maxNameLength are the limits of a DNS name
+	maxLabelLength = 63
+	maxNameLength  = 253
+	// minLearnCount is the number of known labels a token must appear in to be learned
+	minLearnCount = 2
+	// maxLearned bounds the words learned from the known subdomains
+	maxLearned = 100
+	// defaultMaxTracked is the number of names remembered when Options.MaxTracked is 0
+	defaultMaxTracked = 1 << 20
+)
+
+// ErrLimit is returned once the generator emitted MaxCandidates candidates.
+var ErrLimit = errors.New("candidate limit reached")
+
+// Options configures a Generator
+type Options struct {
+	// Words are inserted as labels and joined to the labels of the known subdomains
+	Words []string
+	// Numbers is how far the numbers in a label are counted up and down, 0 disables it
+	Numbers int
+	// Depth is the number of times permutations are applied to a candidate
+	Depth int
+	// Learn adds the words recurring in the known subdomains to Words
+	Learn bool
+	// MaxCandidates bounds the candidates emitted, 0 means no limit
+	MaxCandidates int
+	// MaxTracked bounds the names remembered to skip duplicates, 0 means 1<<20.
+	// Past it the new names are not remembered and may be emitted again.
+	MaxTracked int
+}
+
+// Generator permutes the subdomains of a domain
+type Generator struct {
+	domain string
+	names  [][]string
+	words  []string
+	opts   Options
+}
+
+// New returns a generator of the permutations of names, the subdomains of domain.
+// Names outside domain are ignored.
+func New(domain string, names []string, opts Options) *Generator {
+	domain = normalize(domain)
+	g := &Generator{domain: domain, opts: opts}
+	if g.opts.Depth < 1 {
+		g.opts.Depth = 1
+	}
+	if g.opts.MaxTracked < 1 {
+		g.opts.MaxTracked = defaultMaxTracked
+	}
+
+	for _, name := range names {
+		name = normalize(name)
+		if !strings.HasSuffix(name, "."+domain) || strings.HasPrefix(name, "*.") {
+			continue
+		}
+		g.names = append(g.names, strings.Split(strings.TrimSuffix(name, "."+domain), "."))
+	}
+
+	words := make(map[string]bool)
+	for _, w := range opts.Words {
+		if w = normalize(w); validLabel(w) {
+			words[w] = true
+		}
+	}
+	if opts.Learn {
+		for _, w := range learn(g.names) {
+			words[w] = true
+		}
+	}
+	for w := range words {
+		g.words = append(g.words, w)
+	}
+	sort.Strings(g.words)
+
+	return g
+}
+
+// Words returns the words used, learned ones included
+func (g *Generator) Words() []string {
+	return g.words
+}
+
+// Run calls fn with every candidate up to Depth permutations away from the
+// known subdomains, none of the known ones and each one once as long as fewer
+// than MaxTracked names were remembered. It returns the number of candidates
+// emitted, with ErrLimit once MaxCandidates is reached or ctx.Err() once ctx is cancelled.
+func (g *Generator) Run(ctx context.Context, fn func(candidate string)) (int, error) {
+	// expanded maps a name to the depth left when it was permuted, so a name
+	// reached again closer to the known subdomains is permuted deeper but not emitted twice
+	expanded := make(map[string]int, len(g.names))
+	for _, labels := range g.names {
+		expanded[strings.Join(labels, ".")] = g.opts.Depth
+	}
+
+	emitted := 0
+	var permute func(labels []string, depth int) error
+	permute = func(labels []string, depth int) error {
+		for _, candidate := range g.permutations(labels) {
+			key := strings.Join(candidate, ".")
+			left, known := expanded[key]
+			if (known && left >= depth-1) || !validName(key+"."+g.domain) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !known {
+				if g.opts.MaxCandidates > 0 && emitted >= g.opts.MaxCandidates {
+					return ErrLimit
+				}
+				emitted++
+				fn(key + "." + g.domain)
+			}
+			if known || len(expanded) < g.opts.MaxTracked {
+				expanded[key] = depth - 1
+			}
+
+			if depth > 1 {
+				if err := permute(candidate, depth-1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, labels := range g.names {
+		if err := permute(labels, g.opts.Depth); err != nil {
+			return emitted, err
+		}
+	}
+
+	return emitted, nil
+}
+
+// permutations returns the candidates one step away from labels
+func (g *Generator) permutations(labels []string) [][]string {
+	var candidates [][]string
+
+	for _, w := range g.words {
+		// Dot joins: the word as a label of its own, at every position but next to itself
+		for i := 0; i <= len(labels); i++ {
+			if (i > 0 && labels[i-1] == w) || (i < len(labels) && labels[i] == w) {
+				continue
+			}
+			candidates = append(candidates, insert(labels, i, w))
+		}
+		// Dash joins: the word before and after every label not made with it already
+		for i, label := range labels {
+			if hasToken(label, w) {
+				continue
+			}
+			candidates = append(candidates, replace(labels, i, w+"-"+label), replace(labels, i, label+"-"+w))
+		}
+	}
+
+	// Numbers counted up and down
+	for i, label := range labels {
+		for _, shifted := range shiftNumbers(label, g.opts.Numbers) {
+			candidates = append(candidates, replace(labels, i, shifted))
+		}
+	}
+
+	return candidates
+}
+
+// shiftNumbers returns label with its last number counted up and down by up to n,
+// keeping its zero padding, as in web02 giving web01 and web03
+func shiftNumbers(label string, n int) []string {
+	end := strings.LastIndexAny(label, "0123456789") + 1
+	if end == 0 || n < 1 {
+		return nil
+	}
+	start := end
+	for start > 0 && label[start-1] >= '0' && label[start-1] <= '9' {
+		start--
+	}
+	digits := label[start:end]
+	value, err := strconv.Atoi(digits)
+	if err != nil {
+		return nil
+	}
+
+	var shifted []string
+	for d := -n; d <= n; d++ {
+		if d == 0 || value+d < 0 {
+			continue
+		}
+		number := fmt.Sprintf("%0*d", len(digits), value+d)
+		shifted = append(shifted, label[:start]+number+label[end:])
+	}
+	return shifted
+}
+
+// learn returns the tokens found in at least minLearnCount labels of names,
+// the most frequent first. Labels are split on dashes and digits.
+func learn(names [][]string) []string {
+	counts := make(map[string]int)
+	for _, labels := range names {
+		tokens := make(map[string]bool)
+		for _, label := range labels {
+			for _, token := range strings.FieldsFunc(label, func(r rune) bool { return r == '-' || (r >= '0' && r <= '9') }) {
+				if len(token) > 1 {
+					tokens[token] = true
+				}
+			}
+		}
+		for token := range tokens {
+			counts[token]++
+		}
+	}
+
+	var learned []string
+	for token, count := range counts {
+		if count >= minLearnCount {
+			learned = append(learned, token)
+		}
+	}
+	sort.Slice(learned, func(i, j int) bool {
+		if counts[learned[i]] != counts[learned[j]] {
+			return counts[learned[i]] > counts[learned[j]]
+		}
+		return learned[i] < learned[j]
+	})
+	if len(learned) > maxLearned {
+		learned = learned[:maxLearned]
+	}
+
+	return learned
+}
+
+// LoadWords reads a word list with one word per line
+func LoadWords(path string) ([]string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		if w := normalize(scanner.Text()); w != "" && !strings.HasPrefix(w, "#") {
+			words = append(words, w)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// hasToken reports whether w is one of the dash separated parts of label
+func hasToken(label, w string) bool {
+	for _, token := range strings.Split(label, "-") {
+		if token == w {
+			return true
+		}
+	}
+	return false
+}
+
+func insert(labels []string, i int, label string) []string {
+	out := make([]string, 0, len(labels)+1)
+	out = append(out, labels[:i]...)
+	out = append(out, label)
+	return append(out, labels[i:]...)
+}
+
+func replace(labels []string, i int, label string) []string {
+	out := append([]string(nil), labels...)
+	out[i] = label
+	return out
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+func validName(name string) bool {
+	if len(name) > maxNameLength {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !validLabel(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// validLabel reports whether label is a valid host name label
+func validLabel(label string) bool {
+	if label == "" || len(label) > maxLabelLength || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, r := range label {
+		if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package permute
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func collect(t *testing.T, g *Generator) ([]string, error) {
+	t.Helper()
+
+	var candidates []string
+	_, err := g.Run(context.Background(), func(candidate string) {
+		candidates = append(candidates, candidate)
+	})
+	sort.Strings(candidates)
+	return candidates, err
+}
+
+func TestRun(t *testing.T) {
+	g := New("ex.test", []string{"api.ex.test", "API.ex.test.", "*.ex.test", "www.other.test"}, Options{Words: []string{"dev", "-bad", "BAD label"}})
+	candidates, err := collect(t, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"api-dev.ex.test", "api.dev.ex.test", "dev-api.ex.test", "dev.api.ex.test"}
+	if !reflect.DeepEqual(candidates, want) {
+		t.Errorf("candidates = %v, want %v", candidates, want)
+	}
+	if !reflect.DeepEqual(g.Words(), []string{"dev"}) {
+		t.Errorf("words = %v, want only the valid ones", g.Words())
+	}
+}
+
+func TestRunSkipsKnownNames(t *testing.T) {
+	g := New("ex.test", []string{"api.ex.test", "dev.api.ex.test"}, Options{Words: []string{"dev"}, Depth: 2})
+	candidates, err := collect(t, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if c == "api.ex.test" || c == "dev.api.ex.test" {
+			t.Errorf("known name %s emitted", c)
+		}
+		if seen[c] {
+			t.Errorf("%s emitted twice", c)
+		}
+		seen[c] = true
+	}
+	// Depth 2 permutes the candidates of the first pass
+	if !seen["dev.api-dev.ex.test"] {
+		t.Errorf("candidates = %v, want second level permutations", candidates)
+	}
+}
+
+// closure returns the names up to depth permutations away from names, level by level
+func closure(g *Generator, depth int) []string {
+	known := make(map[string]bool)
+	for _, labels := range g.names {
+		known[strings.Join(labels, ".")] = true
+	}
+	found := make(map[string]bool)
+	level := g.names
+	for ; depth > 0; depth-- {
+		var next [][]string
+		for _, labels := range level {
+			for _, candidate := range g.permutations(labels) {
+				key := strings.Join(candidate, ".")
+				if !known[key] && !found[key] && validName(key+"."+g.domain) {
+					found[key] = true
+					next = append(next, candidate)
+				}
+			}
+		}
+		level = next
+	}
+
+	var names []string
+	for key := range found {
+		names = append(names, key+"."+g.domain)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRunDepthIndependentOfOrder(t *testing.T) {
+	// web3 is two steps from web1 and one from web2, it is permuted again whichever comes first
+	for _, names := range [][]string{{"web1.ex.test", "web2.ex.test"}, {"web2.ex.test", "web1.ex.test"}} {
+		g := New("ex.test", names, Options{Words: []string{"dev"}, Numbers: 1, Depth: 2})
+		candidates, err := collect(t, g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := closure(g, 2); !reflect.DeepEqual(candidates, want) {
+			t.Errorf("Run(%v) = %d candidates, want %d", names, len(candidates), len(want))
+		}
+	}
+}
+
+func TestRunMaxTracked(t *testing.T) {
+	g := New("ex.test", []string{"api.ex.test", "www.ex.test"}, Options{Words: []string{"dev", "eu"}, Depth: 2, MaxTracked: 3})
+	candidates, err := collect(t, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Names past the limit may come twice, none is lost
+	got := make(map[string]bool)
+	for _, c := range candidates {
+		if c == "api.ex.test" || c == "www.ex.test" {
+			t.Errorf("known name %s emitted", c)
+		}
+		got[c] = true
+	}
+	for _, name := range closure(g, 2) {
+		if !got[name] {
+			t.Errorf("%s not emitted", name)
+		}
+	}
+}
+
+func TestRunLimit(t *testing.T) {
+	g := New("ex.test", []string{"api.ex.test", "www.ex.test"}, Options{Words: []string{"dev", "stage", "prod"}, MaxCandidates: 5})
+	n, err := g.Run(context.Background(), func(string) {})
+	if !errors.Is(err, ErrLimit) || n != 5 {
+		t.Errorf("Run = %v, %v, want 5, ErrLimit", n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.Run(ctx, func(string) {}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run with a cancelled context = %v", err)
+	}
+}
+
+func TestShiftNumbers(t *testing.T) {
+	tests := []struct {
+		label string
+		n     int
+		want  []string
+	}{
+		{"web02", 1, []string{"web01", "web03"}},
+		{"web1", 2, []string{"web0", "web2", "web3"}},
+		{"db9-eu", 1, []string{"db8-eu", "db10-eu"}},
+		{"v2-api3", 1, []string{"v2-api2", "v2-api4"}},
+		{"www", 3, nil},
+		{"web02", 0, nil},
+	}
+
+	for _, tt := range tests {
+		if got := shiftNumbers(tt.label, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("shiftNumbers(%q, %v) = %v, want %v", tt.label, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLearn(t *testing.T) {
+	names := [][]string{{"api-eu1"}, {"api-us2"}, {"cdn", "eu"}, {"mail"}, {"api", "internal"}}
+	want := []string{"api", "eu"}
+	if got := learn(names); !reflect.DeepEqual(got, want) {
+		t.Errorf("learn = %v, want %v", got, want)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	tests := map[string]bool{
+		"api.ex.test":                        true,
+		"_dmarc.ex.test":                     true,
+		"-api.ex.test":                       false,
+		"api-.ex.test":                       false,
+		"a..ex.test":                         false,
+		"ap!.ex.test":                        false,
+		strings.Repeat("a", 64) + ".ex.test": false,
+	}
+	for name, want := range tests {
+		if got := validName(name); got != want {
+			t.Errorf("validName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
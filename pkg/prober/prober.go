@@ -0,0 +1,261 @@
+// Package prober finds the web services of hosts over HTTP and HTTPS and
+// records their status, title, body hash, TLS details and final URL.
+package prober
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBodySize bounds the part of a response body read for the title and hash
+const maxBodySize = 1 << 20
+
+var titleRegex = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// Options configures a Prober
+type Options struct {
+	// Concurrency is the number of hosts probed at once
+	Concurrency int
+	// Ports probed on every host, none probes the default port of each scheme
+	Ports []int
+	// Schemes tried in order on every port, the first one answering wins
+	Schemes []string
+	// FollowRedirects follows up to MaxRedirects redirects and records the final URL,
+	// a MaxRedirects of 0 stops at the first response
+	FollowRedirects bool
+	MaxRedirects    int
+	// AllowRedirect reports whether a redirect to host may be followed, the redirect
+	// response is kept as the result when it may not. Nil follows redirects to any host.
+	AllowRedirect func(ctx context.Context, host string) bool
+	// Timeout bounds a single request, including the body read
+	Timeout time.Duration
+}
+
+// TLSInfo describes the TLS connection of a response
+type TLSInfo struct {
+	Version   string    `json:"version"`
+	Cipher    string    `json:"cipher"`
+	SubjectCN string    `json:"subject_cn,omitempty"`
+	SANs      []string  `json:"sans,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	NotAfter  time.Time `json:"not_after,omitempty"`
+}
+
+// Result is the response of a web service found on a host
+type Result struct {
+	Host          string   `json:"host"`
+	Port          int      `json:"port"`
+	Scheme        string   `json:"scheme"`
+	URL           string   `json:"url"`
+	FinalURL      string   `json:"final_url"`
+	StatusCode    int      `json:"status_code"`
+	Title         string   `json:"title,omitempty"`
+	ContentLength int64    `json:"content_length"`
+	ContentType   string   `json:"content_type,omitempty"`
+	Server        string   `json:"server,omitempty"`
+	TLS           *TLSInfo `json:"tls,omitempty"`
+	Hash          string   `json:"hash"`
+}
+
+// Prober finds the web services of hosts
+type Prober struct {
+	opts   Options
+	client *http.Client
+}
+
+// New returns a prober for opts, unset options take the httpx defaults
+func New(opts Options) *Prober {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 50
+	}
+	if len(opts.Schemes) == 0 {
+		opts.Schemes = []string{"https", "http"}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.MaxRedirects < 0 {
+		opts.MaxRedirects = 0
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: opts.Timeout}).DialContext,
+		TLSHandshakeTimeout: opts.Timeout,
+		// Recon targets often serve self-signed or mismatched certificates
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !opts.FollowRedirects {
+				return http.ErrUseLastResponse
+			}
+			// via holds the requests made so far, the first one is not a redirect
+			if len(via) > opts.MaxRedirects {
+				return http.ErrUseLastResponse
+			}
+			if opts.AllowRedirect != nil && !opts.AllowRedirect(req.Context(), strings.ToLower(req.URL.Hostname())) {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+
+	return &Prober{opts: opts, client: client}
+}
+
+// Run probes every host and calls fn with each result, one call at a time.
+// It returns once all hosts are probed or ctx is cancelled.
+func (p *Prober) Run(ctx context.Context, hosts []string, fn func(Result)) {
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				for _, r := range p.ProbeHost(ctx, host) {
+					mu.Lock()
+					fn(r)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, host := range hosts {
+		select {
+		case jobs <- host:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// ProbeHost returns the web services answering on host, at most one per port
+func (p *Prober) ProbeHost(ctx context.Context, host string) []Result {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" {
+		return nil
+	}
+
+	ports := p.opts.Ports
+	if len(ports) == 0 {
+		ports = []int{0}
+	}
+
+	var results []Result
+	for _, port := range ports {
+		for _, scheme := range p.opts.Schemes {
+			if ctx.Err() != nil {
+				return results
+			}
+			r, err := p.probe(ctx, scheme, host, port)
+			if err != nil {
+				continue
+			}
+			results = append(results, *r)
+			break
+		}
+	}
+
+	return results
+}
+
+func (p *Prober) probe(ctx context.Context, scheme, host string, port int) (*Result, error) {
+	if port == 0 {
+		port = 443
+		if scheme == "http" {
+			port = 80
+		}
+	}
+
+	// Keep default ports out of the URL, like httpx does
+	target := fmt.Sprintf("%s://%s", scheme, host)
+	if !(scheme == "https" && port == 443) && !(scheme == "http" && port == 80) {
+		target = fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, fmt.Sprint(port)))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; r3conwhal3)")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil && len(body) == 0 {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+
+	r := &Result{
+		Host:          host,
+		Port:          port,
+		Scheme:        scheme,
+		URL:           target,
+		FinalURL:      resp.Request.URL.String(),
+		StatusCode:    resp.StatusCode,
+		Title:         extractTitle(body),
+		ContentLength: resp.ContentLength,
+		ContentType:   resp.Header.Get("Content-Type"),
+		Server:        resp.Header.Get("Server"),
+		Hash:          hex.EncodeToString(sum[:]),
+	}
+	if r.ContentLength < 0 {
+		r.ContentLength = int64(len(body))
+	}
+	if resp.TLS != nil {
+		r.TLS = tlsInfo(resp.TLS)
+	}
+
+	return r, nil
+}
+
+func extractTitle(body []byte) string {
+	m := titleRegex.FindSubmatch(body)
+	if m == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+}
+
+func tlsInfo(state *tls.ConnectionState) *TLSInfo {
+	info := &TLSInfo{
+		Version: tls.VersionName(state.Version),
+		Cipher:  tls.CipherSuiteName(state.CipherSuite),
+	}
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		info.SubjectCN = cert.Subject.CommonName
+		info.SANs = cert.DNSNames
+		info.Issuer = cert.Issuer.CommonName
+		info.NotAfter = cert.NotAfter
+	}
+	return info
+}
@@ -0,0 +1,132 @@
+package prober
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startSite serves h and returns the host and port it listens on
+func startSite(t *testing.T, h http.Handler) (string, int) {
+	t.Helper()
+
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+
+	return host, p
+}
+
+func TestProbeHost(t *testing.T) {
+	host, port := startSite(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "test-server")
+		w.Write([]byte("<html><head><title> Admin &amp; login </title></head></html>"))
+	}))
+
+	p := New(Options{Ports: []int{port}, Schemes: []string{"https", "http"}, Timeout: 2 * time.Second})
+	results := p.ProbeHost(context.Background(), host)
+	if len(results) != 1 {
+		t.Fatalf("ProbeHost = %+v, want one result", results)
+	}
+
+	r := results[0]
+	if r.Scheme != "http" || r.StatusCode != 200 || r.Title != "Admin & login" || r.Server != "test-server" {
+		t.Errorf("result = %+v", r)
+	}
+	if r.URL != "http://"+net.JoinHostPort(host, strconv.Itoa(port)) || r.Hash == "" {
+		t.Errorf("URL = %s, hash = %q", r.URL, r.Hash)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	// The other site is reached through localhost, a different host name than 127.0.0.1
+	_, otherPort := startSite(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<title>other</title>"))
+	}))
+	otherURL := "http://localhost:" + strconv.Itoa(otherPort) + "/"
+
+	host, port := startSite(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/home", http.StatusFound)
+		case "/home":
+			http.Redirect(w, r, otherURL, http.StatusFound)
+		}
+	}))
+	start := "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+
+	tests := []struct {
+		name     string
+		opts     Options
+		status   int
+		finalURL string
+	}{
+		{
+			name:     "not followed",
+			opts:     Options{},
+			status:   http.StatusFound,
+			finalURL: start,
+		},
+		{
+			name:     "followed to any host",
+			opts:     Options{FollowRedirects: true, MaxRedirects: 10},
+			status:   http.StatusOK,
+			finalURL: otherURL,
+		},
+		{
+			name: "stopped at the scope",
+			opts: Options{FollowRedirects: true, MaxRedirects: 10, AllowRedirect: func(ctx context.Context, h string) bool {
+				return h == host
+			}},
+			status:   http.StatusFound,
+			finalURL: start + "/home",
+		},
+		{
+			name:     "stopped at the limit",
+			opts:     Options{FollowRedirects: true, MaxRedirects: 1},
+			status:   http.StatusFound,
+			finalURL: start + "/home",
+		},
+		{
+			name:     "no redirects allowed",
+			opts:     Options{FollowRedirects: true, MaxRedirects: 0},
+			status:   http.StatusFound,
+			finalURL: start,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Ports = []int{port}
+			tt.opts.Schemes = []string{"http"}
+			results := New(tt.opts).ProbeHost(context.Background(), host)
+			if len(results) != 1 {
+				t.Fatalf("ProbeHost = %+v, want one result", results)
+			}
+			if results[0].StatusCode != tt.status || results[0].FinalURL != tt.finalURL {
+				t.Errorf("status %d, final URL %s, want %d, %s", results[0].StatusCode, results[0].FinalURL, tt.status, tt.finalURL)
+			}
+		})
+	}
+}
+
+func TestRunCallsBackPerService(t *testing.T) {
+	host, port := startSite(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var got []string
+	New(Options{Ports: []int{port}, Schemes: []string{"http"}, Concurrency: 4}).Run(context.Background(), []string{host, "", "Nope.invalid."}, func(r Result) {
+		got = append(got, r.Host)
+	})
+	if len(got) != 1 || got[0] != host {
+		t.Errorf("Run found %v, want only %s", got, host)
+	}
+}
@@ -0,0 +1,120 @@
+package subkill3r
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneTransfer is the outcome of an AXFR attempt against a nameserver.
+type ZoneTransfer struct {
+	Nameserver string
+	Addr       string
+	// Names maps every owner name of the transferred zone to its records
+	Names map[string][]Record
+	Err   error
+}
+
+// xfrRcode is the message of the dns package when the nameserver answers an AXFR with an error rcode
+const xfrRcode = "dns: bad xfr rcode: %d"
+
+// Nameservers returns the NS records of domain, queried through the pool.
+func (p *ResolverPool) Nameservers(ctx context.Context, domain string) ([]string, error) {
+	records, _, err := query(ctx, p.Exchange, domain, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+
+	var nameservers []string
+	for _, r := range records {
+		nameservers = append(nameservers, strings.TrimSuffix(strings.ToLower(r.Value), "."))
+	}
+	return nameservers, nil
+}
+
+// ZoneTransfer asks every nameserver of domain for a copy of the zone over TCP
+// and returns one attempt per nameserver. The addresses of a nameserver are
+// tried in turn until one of them answers.
+func (p *ResolverPool) ZoneTransfer(ctx context.Context, domain string, timeout time.Duration) ([]ZoneTransfer, error) {
+	nameservers, err := p.Nameservers(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("no nameservers found for %s: %v", domain, err)
+	}
+
+	var transfers []ZoneTransfer
+	for _, ns := range nameservers {
+		attempt := ZoneTransfer{Nameserver: ns}
+		for _, r := range p.Lookup(ctx, ns) {
+			if r.IPAdress == "" {
+				attempt.Err = fmt.Errorf("nameserver does not resolve (%s)", r.Rcode)
+				break
+			}
+			attempt.Addr = net.JoinHostPort(r.IPAdress, "53")
+			attempt.Names, attempt.Err = transfer(ctx, domain, attempt.Addr, timeout)
+			// Only an unreachable address is worth another try, an RcodeError is the answer of the nameserver
+			var netErr net.Error
+			if !errors.As(attempt.Err, &netErr) {
+				break
+			}
+		}
+		transfers = append(transfers, attempt)
+
+		if ctx.Err() != nil {
+			return transfers, ctx.Err()
+		}
+	}
+
+	return transfers, nil
+}
+
+// transfer performs an AXFR of domain from the nameserver at addr. A nameserver
+// declining the transfer returns an *RcodeError, other errors come from the connection.
+func transfer(ctx context.Context, domain, addr string, timeout time.Duration) (map[string][]Record, error) {
+	conn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// dns.Transfer has no way to stop, closing the connection ends it
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	t := &dns.Transfer{Conn: &dns.Conn{Conn: conn}, ReadTimeout: timeout, WriteTimeout: timeout}
+	var m dns.Msg
+	m.SetAxfr(dns.Fqdn(domain))
+	envelopes, err := t.In(&m, addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	names := make(map[string][]Record)
+	for env := range envelopes {
+		if env.Error != nil {
+			err = env.Error
+			// The dns package only keeps the rcode in its message
+			var rcode int
+			if _, scanErr := fmt.Sscanf(err.Error(), xfrRcode, &rcode); scanErr == nil {
+				err = &RcodeError{Rcode: rcode}
+			}
+			continue // The channel is closed right after an error
+		}
+		for _, rr := range env.RR {
+			value := recordValue(rr)
+			if value == "" {
+				continue
+			}
+			owner := strings.TrimSuffix(strings.ToLower(rr.Header().Name), ".")
+			names[owner] = append(names[owner], Record{Type: dns.TypeToString[rr.Header().Rrtype], Value: value})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
@@ -0,0 +1,69 @@
+package subkill3r
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestTransfer(t *testing.T) {
+	soa, _ := dns.NewRR("ex.test. 60 IN SOA ns1.ex.test. admin.ex.test. 1 60 60 60 60")
+	www, _ := dns.NewRR("www.ex.test. 60 IN A 10.0.0.1")
+	shop, _ := dns.NewRR("shop.ex.test. 60 IN CNAME shop.cloud.test.")
+
+	t.Run("allowed", func(t *testing.T) {
+		addr := startTCPServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Answer = []dns.RR{soa, www, shop, soa}
+			w.WriteMsg(m)
+		})
+
+		names, err := transfer(context.Background(), "ex.test", addr, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names["www.ex.test"]; len(got) != 1 || got[0] != (Record{Type: "A", Value: "10.0.0.1"}) {
+			t.Errorf("www.ex.test = %v", got)
+		}
+		if got := names["shop.ex.test"]; len(got) != 1 || got[0] != (Record{Type: "CNAME", Value: "shop.cloud.test."}) {
+			t.Errorf("shop.ex.test = %v", got)
+		}
+	})
+
+	for _, rcode := range []int{dns.RcodeRefused, dns.RcodeNotAuth} {
+		t.Run(dns.RcodeToString[rcode], func(t *testing.T) {
+			addr := startTCPServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				m := new(dns.Msg)
+				m.SetRcode(r, rcode)
+				w.WriteMsg(m)
+			})
+
+			_, err := transfer(context.Background(), "ex.test", addr, time.Second)
+			var rcodeErr *RcodeError
+			if !errors.As(err, &rcodeErr) || rcodeErr.Rcode != rcode {
+				t.Errorf("transfer() error = %v, want an RcodeError with %s", err, dns.RcodeToString[rcode])
+			}
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		addr := startTCPServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			<-release
+		})
+		// Runs before the server shuts down
+		t.Cleanup(func() { close(release) })
+
+		_, err := transfer(context.Background(), "ex.test", addr, 200*time.Millisecond)
+		var rcodeErr *RcodeError
+		var netErr net.Error
+		if errors.As(err, &rcodeErr) || !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("transfer() error = %v, want a network timeout", err)
+		}
+	})
+}
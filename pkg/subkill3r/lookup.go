@@ -1,68 +1,229 @@
 package subkill3r
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/miekg/dns"
 )
 
+// maxCNAMEDepth bounds how many CNAMEs are followed before giving up on a chain.
+const maxCNAMEDepth = 10
+
+// exchangeFunc sends a query and returns the answer.
+type exchangeFunc func(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+
+// serverExchange returns an exchangeFunc that sends every query to serverAddr.
+func serverExchange(serverAddr string) exchangeFunc {
+	return func(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+		return dns.ExchangeContext(ctx, m, serverAddr)
+	}
+}
+
+// recordTypes maps the record type names accepted in a type list to their type.
+var recordTypes = map[string]uint16{
+	"A":     dns.TypeA,
+	"AAAA":  dns.TypeAAAA,
+	"CNAME": dns.TypeCNAME,
+	"MX":    dns.TypeMX,
+	"NS":    dns.TypeNS,
+	"TXT":   dns.TypeTXT,
+	"SOA":   dns.TypeSOA,
+}
+
+// AddressTypes resolves names to their IPv4 and IPv6 addresses only.
+var AddressTypes = []uint16{dns.TypeA, dns.TypeAAAA, dns.TypeCNAME}
+
+// ParseRecordTypes parses a comma separated list of record types such as
+// "A,AAAA,MX,TXT". A and CNAME are always queried, names are resolved through them.
+func ParseRecordTypes(list string) ([]uint16, error) {
+	types := []uint16{dns.TypeA, dns.TypeCNAME}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		t, ok := recordTypes[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported record type %q", name)
+		}
+		if !hasType(types, t) {
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
+
 func LookupA(fqdn, serverAddr string) ([]string, error) {
+	return lookupA(context.Background(), serverExchange(serverAddr), fqdn)
+}
+
+func LookupCNAME(fqdn, serverAddr string) ([]string, error) {
+	return lookupCNAME(context.Background(), serverExchange(serverAddr), fqdn)
+}
+
+func Lookup(fqdn, serverAddr string) []Result {
+	return lookup(context.Background(), serverExchange(serverAddr), fqdn, AddressTypes)
+}
+
+// LookupA queries the A records of fqdn through the pool.
+func (p *ResolverPool) LookupA(ctx context.Context, fqdn string) ([]string, error) {
+	return lookupA(ctx, p.Exchange, fqdn)
+}
+
+// LookupCNAME queries the CNAME record of fqdn through the pool.
+func (p *ResolverPool) LookupCNAME(ctx context.Context, fqdn string) ([]string, error) {
+	return lookupCNAME(ctx, p.Exchange, fqdn)
+}
+
+// Lookup resolves fqdn through the pool, following its CNAME chain. A name
+// that does not resolve returns a single Result carrying the chain and rcode.
+func (p *ResolverPool) Lookup(ctx context.Context, fqdn string) []Result {
+	return lookup(ctx, p.Exchange, fqdn, AddressTypes)
+}
+
+// LookupRecords is Lookup that also queries the other record types in types,
+// every answer is kept in the Records of the results.
+func (p *ResolverPool) LookupRecords(ctx context.Context, fqdn string, types []uint16) []Result {
+	return lookup(ctx, p.Exchange, fqdn, types)
+}
+
+func lookupA(ctx context.Context, exchange exchangeFunc, fqdn string) ([]string, error) {
+	records, _, err := query(ctx, exchange, fqdn, dns.TypeA)
+	return recordValues(records), err
+}
+
+func lookupCNAME(ctx context.Context, exchange exchangeFunc, fqdn string) ([]string, error) {
+	records, _, err := query(ctx, exchange, fqdn, dns.TypeCNAME)
+	if len(records) > 1 {
+		records = records[:1]
+	}
+	return recordValues(records), err
+}
+
+// query asks for the records of qtype for fqdn. It returns the answers of
+// that type along with the response code of the answer, or of the SERVFAIL
+// and REFUSED answers that made the query fail.
+func query(ctx context.Context, exchange exchangeFunc, fqdn string, qtype uint16) ([]Record, string, error) {
 	var m dns.Msg
-	var ips []string
-	m.SetQuestion(dns.Fqdn(fqdn), dns.TypeA)
-	in, err := dns.Exchange(&m, serverAddr)
+	m.SetQuestion(dns.Fqdn(fqdn), qtype)
+	in, err := exchange(ctx, &m)
 	if err != nil {
-		return ips, err
+		var rcodeErr *RcodeError
+		if errors.As(err, &rcodeErr) {
+			return nil, rcodeErr.Error(), err
+		}
+		return nil, "", err
 	}
+	rcode := dns.RcodeToString[in.Rcode]
 	if len(in.Answer) < 1 {
-		return ips, errors.New("no answer")
+		return nil, rcode, errors.New("no answer")
 	}
+
+	var records []Record
 	for _, answer := range in.Answer {
-		if a, ok := answer.(*dns.A); ok {
-			ips = append(ips, a.A.String())
-			return ips, nil
+		if answer.Header().Rrtype != qtype {
+			continue
+		}
+		if value := recordValue(answer); value != "" {
+			records = append(records, Record{Type: dns.TypeToString[qtype], Value: value})
 		}
 	}
-	return ips, nil
+	return records, rcode, nil
 }
 
-func LookupCNAME(fqdn, serverAddr string) ([]string, error) {
-	var m dns.Msg
-	var fqdns []string
-	m.SetQuestion(dns.Fqdn(fqdn), dns.TypeCNAME)
-	in, err := dns.Exchange(&m, serverAddr)
-	if err != nil {
-		return fqdns, err
+// recordValue returns the data of rr in the usual presentation format.
+func recordValue(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	case *dns.CNAME:
+		return rr.Target
+	case *dns.MX:
+		return fmt.Sprintf("%v %s", rr.Preference, rr.Mx)
+	case *dns.NS:
+		return rr.Ns
+	case *dns.TXT:
+		return strings.Join(rr.Txt, "")
+	case *dns.SOA:
+		return fmt.Sprintf("%s %s %v", rr.Ns, rr.Mbox, rr.Serial)
 	}
-	if len(in.Answer) < 1 {
-		return fqdns, errors.New("no answer")
+	return ""
+}
+
+func recordValues(records []Record) []string {
+	var values []string
+	for _, r := range records {
+		values = append(values, r.Value)
 	}
-	for _, answer := range in.Answer {
-		if a, ok := answer.(*dns.CNAME); ok {
-			fqdns = append(fqdns, a.Target)
-			return fqdns, nil
+	return values
+}
+
+func hasType(types []uint16, t uint16) bool {
+	for _, have := range types {
+		if have == t {
+			return true
 		}
 	}
-	return fqdns, nil
+	return false
 }
 
-func Lookup(fqdn, serverAddr string) []Result {
-	var results []Result
+// resolve follows the CNAME chain of fqdn and returns the addresses of the
+// final target, every CNAME target seen on the way and the response code of
+// the query for the final target. The other record types in types are queried
+// for fqdn whether it has addresses or not, so a delegation without addresses
+// keeps its NS records. They are returned in records with every other answer.
+func resolve(ctx context.Context, exchange exchangeFunc, fqdn string, types []uint16) (ips, cnames []string, rcode string, records []Record) {
 	var cfqdn = fqdn //keeping the original
-	for {
-		cnames, err := LookupCNAME(cfqdn, serverAddr )
-		if err == nil && len(cnames) > 0 {
-			cfqdn = cnames[0]
+	for i := 0; i < maxCNAMEDepth; i++ {
+		targets, err := lookupCNAME(ctx, exchange, cfqdn)
+		if err == nil && len(targets) > 0 {
+			cfqdn = targets[0]
+			cnames = append(cnames, cfqdn)
+			records = append(records, Record{Type: "CNAME", Value: cfqdn})
 			continue // Process the next CNAME
 		}
-		ips, err := LookupA(cfqdn, serverAddr)
-		if err != nil {
-			break // There are no A records for this hostname.
+		break
+	}
+
+	addrs, rcode, err := query(ctx, exchange, cfqdn, dns.TypeA)
+	// IPv6-only hosts answer the A query with no data, a name that does not exist is not asked again
+	if hasType(types, dns.TypeAAAA) && rcode != dns.RcodeToString[dns.RcodeNameError] {
+		v6, rcode6, err6 := query(ctx, exchange, cfqdn, dns.TypeAAAA)
+		addrs = append(addrs, v6...)
+		if err != nil && err6 == nil {
+			rcode = rcode6
 		}
-		for _, ip := range ips {
-			results = append(results, Result{IPAdress: ip, Hostname: fqdn})
+	}
+	records = append(records, addrs...)
+	ips = recordValues(addrs)
+
+	// The other types belong to the name itself, a CNAME owner has no other records
+	// and a name that does not exist has none at all
+	for _, t := range types {
+		if t == dns.TypeA || t == dns.TypeAAAA || t == dns.TypeCNAME || len(cnames) > 0 || rcode == dns.RcodeToString[dns.RcodeNameError] {
+			continue
 		}
-		break // All the results will be processed till this step
+		answers, _, _ := query(ctx, exchange, fqdn, t)
+		records = append(records, answers...)
 	}
-	return results	
-}
\ No newline at end of file
+
+	return ips, cnames, rcode, records
+}
+
+func lookup(ctx context.Context, exchange exchangeFunc, fqdn string, types []uint16) []Result {
+	ips, cnames, rcode, records := resolve(ctx, exchange, fqdn, types)
+	if len(ips) == 0 {
+		return []Result{{Hostname: fqdn, CNAMEChain: cnames, Rcode: rcode, Records: records}}
+	}
+
+	var results []Result
+	for _, ip := range ips {
+		results = append(results, Result{IPAdress: ip, Hostname: fqdn, CNAMEChain: cnames, Rcode: rcode, Records: records})
+	}
+	return results
+}
@@ -0,0 +1,112 @@
+package subkill3r
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// delegationZone serves www.ex.test with an address and MX records, and dev.ex.test
+// as a delegation whose nameservers are gone: its address queries fail, its NS query answers
+func delegationZone(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	q := r.Question[0]
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+
+	switch name := strings.ToLower(q.Name); {
+	case name == "www.ex.test." && q.Qtype == dns.TypeA:
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP("10.0.0.1")})
+	case name == "www.ex.test." && q.Qtype == dns.TypeMX:
+		m.Answer = append(m.Answer, &dns.MX{Hdr: hdr, Preference: 10, Mx: "mail.ex.test."})
+	case name == "www.ex.test.":
+	case name == "dev.ex.test." && q.Qtype == dns.TypeNS:
+		m.Answer = append(m.Answer, &dns.NS{Hdr: hdr, Ns: "ns1.gone.test."})
+	case name == "dev.ex.test.":
+		m.Rcode = dns.RcodeServerFailure
+	default:
+		m.Rcode = dns.RcodeNameError
+	}
+	w.WriteMsg(m)
+}
+
+func TestLookupRecords(t *testing.T) {
+	pool, err := NewResolverPool([]string{startServer(t, delegationZone)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, err := ParseRecordTypes("AAAA,MX,NS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		fqdn   string
+		ip     string
+		rcode  string
+		record Record
+	}{
+		{fqdn: "www.ex.test", ip: "10.0.0.1", rcode: "NOERROR", record: Record{Type: "MX", Value: "10 mail.ex.test."}},
+		// The address lookup fails, the NS records of the delegation are kept
+		{fqdn: "dev.ex.test", rcode: "SERVFAIL", record: Record{Type: "NS", Value: "ns1.gone.test."}},
+		{fqdn: "nope.ex.test", rcode: "NXDOMAIN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fqdn, func(t *testing.T) {
+			results := pool.LookupRecords(context.Background(), tt.fqdn, types)
+			if len(results) != 1 {
+				t.Fatalf("LookupRecords() = %+v, want one result", results)
+			}
+			r := results[0]
+			if r.IPAdress != tt.ip || r.Rcode != tt.rcode {
+				t.Errorf("LookupRecords() = %s %s, want %s %s", r.IPAdress, r.Rcode, tt.ip, tt.rcode)
+			}
+			found := tt.record == Record{}
+			for _, record := range r.Records {
+				if record == tt.record {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Records = %+v, want %+v", r.Records, tt.record)
+			}
+		})
+	}
+}
+
+func TestSubkill3rKeepsDelegations(t *testing.T) {
+	pool, err := NewResolverPool([]string{startServer(t, delegationZone)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, err := ParseRecordTypes("NS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wordlist := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlist, []byte("www\ndev\nnope\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Subkill3r(context.Background(), "ex.test", wordlist, pool, 2, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := make(map[string]Result)
+	for _, r := range results {
+		hosts[r.Hostname] = r
+	}
+	if len(hosts) != 2 || hosts["www.ex.test"].IPAdress != "10.0.0.1" {
+		t.Fatalf("results = %+v, want www.ex.test and dev.ex.test", results)
+	}
+	if dev := hosts["dev.ex.test"]; dev.IPAdress != "" || len(dev.Records) != 1 || dev.Records[0].Type != "NS" {
+		t.Errorf("dev.ex.test = %+v, want its NS record without an address", dev)
+	}
+}
@@ -0,0 +1,72 @@
+package subkill3r
+
+import (
+	"context"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// Validate resolves the names of results again through trusted, a small set of
+// reliable resolvers, and drops the results of the names they answer NXDOMAIN or
+// no address for. A name the trusted resolvers fail to answer is kept, a timeout
+// or a SERVFAIL proves nothing. Results without IPAdress are kept as they are.
+func Validate(ctx context.Context, results []Result, trusted *ResolverPool, workerCount int) ([]Result, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if !seen[r.Hostname] && r.IPAdress != "" {
+			seen[r.Hostname] = true
+			names = append(names, r.Hostname)
+		}
+	}
+
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	jobs := make(chan string)
+	denied := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				if lookup := trusted.Lookup(ctx, name); lookup[0].IPAdress == "" && authoritativeNegative(lookup[0].Rcode) {
+					mu.Lock()
+					denied[name] = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+feed:
+	for _, name := range names {
+		select {
+		case jobs <- name:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var kept []Result
+	for _, r := range results {
+		if r.IPAdress == "" || !denied[r.Hostname] {
+			kept = append(kept, r)
+		}
+	}
+
+	return kept, ctx.Err()
+}
+
+// authoritativeNegative reports whether rcode, given for a name without addresses,
+// says the name has none: NXDOMAIN, or NOERROR with no data
+func authoritativeNegative(rcode string) bool {
+	return rcode == dns.RcodeToString[dns.RcodeNameError] || rcode == dns.RcodeToString[dns.RcodeSuccess]
+}
@@ -0,0 +1,100 @@
+package subkill3r
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestResolveDropsWildcards(t *testing.T) {
+	zone := newTestZone(map[string][]string{
+		"*.ex.test":       {"10.0.0.9"},
+		"www.ex.test":     {"10.0.0.1"},
+		"*.dev.ex.test":   {"10.0.0.8"},
+		"api.dev.ex.test": {"10.0.0.2"},
+	})
+	pool, err := NewResolverPool([]string{startServer(t, zone.ServeDNS)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.SetRateLimit(1000)
+
+	fqdns := make(chan string)
+	go func() {
+		defer close(fqdns)
+		for _, name := range []string{"www.ex.test", "mail.ex.test", "api.dev.ex.test", "web.dev.ex.test"} {
+			fqdns <- name
+		}
+	}()
+	results, err := Resolve(context.Background(), "ex.test", fqdns, pool, 2, AddressTypes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hosts []string
+	for _, r := range results {
+		hosts = append(hosts, r.Hostname)
+	}
+	sort.Strings(hosts)
+	if len(hosts) != 2 || hosts[0] != "api.dev.ex.test" || hosts[1] != "www.ex.test" {
+		t.Errorf("Resolve() = %v, want api.dev.ex.test and www.ex.test", hosts)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// The trusted resolver knows www, denies fake with NXDOMAIN, has no address for
+	// nodata and fails on flaky
+	trusted := startServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		q := r.Question[0]
+		switch q.Name {
+		case "www.ex.test.":
+			if q.Qtype == dns.TypeA {
+				rr, _ := dns.NewRR("www.ex.test. 60 IN A 10.0.0.1")
+				m.Answer = append(m.Answer, rr)
+			}
+		case "nodata.ex.test.":
+		case "flaky.ex.test.":
+			m.Rcode = dns.RcodeServerFailure
+		default:
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+	})
+	pool, err := NewResolverPool([]string{trusted}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []Result{
+		{Hostname: "www.ex.test", IPAdress: "10.0.0.1"},
+		{Hostname: "fake.ex.test", IPAdress: "10.9.9.9"},
+		{Hostname: "fake.ex.test", IPAdress: "10.9.9.8"},
+		{Hostname: "nodata.ex.test", IPAdress: "10.9.9.7"},
+		{Hostname: "flaky.ex.test", IPAdress: "10.0.0.3"},
+		{Hostname: "gone.ex.test", CNAMEChain: []string{"gone.cloud.test"}, Rcode: "NXDOMAIN"},
+	}
+	kept, err := Validate(context.Background(), results, pool, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hosts []string
+	for _, r := range kept {
+		hosts = append(hosts, r.Hostname)
+	}
+	// A SERVFAIL from the trusted resolver proves nothing, dangling names are not checked
+	want := []string{"www.ex.test", "flaky.ex.test", "gone.ex.test"}
+	if len(hosts) != len(want) {
+		t.Fatalf("Validate() kept %v, want %v", hosts, want)
+	}
+	for i := range want {
+		if hosts[i] != want[i] {
+			t.Errorf("Validate() kept %v, want %v", hosts, want)
+			break
+		}
+	}
+}
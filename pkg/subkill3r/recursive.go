@@ -0,0 +1,123 @@
+package subkill3r
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+)
+
+// RecursiveOptions selects the subdomains brute-forced by Recursive.
+type RecursiveOptions struct {
+	// Depth is the number of levels brute-forced below the known subdomains
+	Depth int
+	// MaxPerLevel bounds the subdomains brute-forced at each level
+	MaxPerLevel int
+	// MinChildren is the number of known children that makes a subdomain worth brute-forcing
+	MinChildren int
+	// Patterns are globs matched against the first label, such as dev* or internal
+	Patterns []string
+}
+
+// Recursive brute-forces under the subdomains of known that have many children
+// or match a pattern, then under the matching names found there, down to
+// opts.Depth levels. Every subdomain brute-forced is checked for a wildcard of its own.
+// It returns the results of the names that were not known.
+func Recursive(ctx context.Context, domain, wordlist string, known []string, pool *ResolverPool, workerCount int, types []uint16, opts RecursiveOptions) ([]Result, error) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	seen, isKnown := make(map[string]bool), make(map[string]bool)
+	for _, name := range known {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		seen[name], isKnown[name] = true, true
+	}
+
+	var results []Result
+	done := make(map[string]bool)
+	level := known
+	for depth := 1; depth <= opts.Depth && len(level) > 0; depth++ {
+		parents := pickParents(domain, level, seen, done, opts)
+		if len(parents) == 0 {
+			break
+		}
+		logger.FromContext(ctx).Info("Recursive brute-force level %d: %s", depth, strings.Join(parents, ", "))
+
+		var found []string
+		for _, parent := range parents {
+			done[parent] = true
+			res, err := Subkill3r(ctx, parent, wordlist, pool, workerCount, types)
+			for _, r := range res {
+				name := strings.ToLower(r.Hostname)
+				if isKnown[name] {
+					continue
+				}
+				if !seen[name] {
+					seen[name] = true
+					found = append(found, name)
+				}
+				results = append(results, r)
+			}
+			if err != nil {
+				return results, err
+			}
+		}
+		level = found
+	}
+
+	return results, nil
+}
+
+// pickParents returns the names under domain worth brute-forcing among names,
+// the ones with the most children first. Children are counted among every name
+// in seen, the names in done were already brute-forced.
+func pickParents(domain string, names []string, seen, done map[string]bool, opts RecursiveOptions) []string {
+	children := make(map[string]int)
+	for name := range seen {
+		if i := strings.Index(name, "."); i >= 0 {
+			children[name[i+1:]]++
+		}
+	}
+
+	// Parents of the names count too, an empty non-terminal such as dev in a.dev.example.com is never listed
+	candidates := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		for name != domain && strings.HasSuffix(name, "."+domain) {
+			candidates[name] = true
+			name = name[strings.Index(name, ".")+1:]
+		}
+	}
+
+	var parents []string
+	for name := range candidates {
+		if done[name] || strings.HasPrefix(name, "*.") {
+			continue
+		}
+		if (opts.MinChildren > 0 && children[name] >= opts.MinChildren) || matchLabel(name, opts.Patterns) {
+			parents = append(parents, name)
+		}
+	}
+	sort.Slice(parents, func(i, j int) bool {
+		if children[parents[i]] != children[parents[j]] {
+			return children[parents[i]] > children[parents[j]]
+		}
+		return parents[i] < parents[j]
+	})
+	if opts.MaxPerLevel > 0 && len(parents) > opts.MaxPerLevel {
+		parents = parents[:opts.MaxPerLevel]
+	}
+
+	return parents
+}
+
+// matchLabel reports whether the first label of name matches one of the patterns.
+func matchLabel(name string, patterns []string) bool {
+	label := strings.SplitN(name, ".", 2)[0]
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, label); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package subkill3r
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPickParents(t *testing.T) {
+	seen := map[string]bool{
+		"a.dev.ex.test":    true,
+		"b.dev.ex.test":    true,
+		"c.dev.ex.test":    true,
+		"x.shop.ex.test":   true,
+		"y.shop.ex.test":   true,
+		"www.ex.test":      true,
+		"internal.ex.test": true,
+		"*.cdn.ex.test":    true,
+		"a.other.test":     true,
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	tests := []struct {
+		name string
+		done map[string]bool
+		opts RecursiveOptions
+		want []string
+	}{
+		{
+			name: "most children first",
+			opts: RecursiveOptions{MinChildren: 2},
+			want: []string{"dev.ex.test", "shop.ex.test"},
+		},
+		{
+			name: "max per level",
+			opts: RecursiveOptions{MinChildren: 2, MaxPerLevel: 1},
+			want: []string{"dev.ex.test"},
+		},
+		{
+			name: "patterns",
+			opts: RecursiveOptions{Patterns: []string{"intern*", "ww?"}},
+			want: []string{"internal.ex.test", "www.ex.test"},
+		},
+		{
+			name: "done skipped",
+			done: map[string]bool{"dev.ex.test": true},
+			opts: RecursiveOptions{MinChildren: 2},
+			want: []string{"shop.ex.test"},
+		},
+		{
+			name: "no rule",
+			opts: RecursiveOptions{},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := tt.done
+			if done == nil {
+				done = map[string]bool{}
+			}
+			if got := pickParents("ex.test", names, seen, done, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pickParents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecursive(t *testing.T) {
+	zone := newTestZone(map[string][]string{
+		"a.dev.ex.test":     {"10.0.0.1"},
+		"b.dev.ex.test":     {"10.0.0.2"},
+		"api.dev.ex.test":   {"10.0.0.3"},
+		"x.api.dev.ex.test": {"10.0.0.4"},
+	})
+	pool, err := NewResolverPool([]string{startServer(t, zone.ServeDNS)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wordlist := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlist, []byte("a\napi\nx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	known := []string{"a.dev.ex.test", "B.dev.ex.test."}
+
+	tests := []struct {
+		depth int
+		want  []string
+	}{
+		// dev has two known children, api is found under it
+		{1, []string{"api.dev.ex.test"}},
+		// api matches a pattern, x is found one level deeper
+		{2, []string{"api.dev.ex.test", "x.api.dev.ex.test"}},
+	}
+	for _, tt := range tests {
+		opts := RecursiveOptions{Depth: tt.depth, MinChildren: 2, Patterns: []string{"api"}}
+		results, err := Recursive(context.Background(), "ex.test", wordlist, known, pool, 2, AddressTypes, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Hostname)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Recursive(depth %d) = %v, want %v", tt.depth, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package subkill3r
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// canaryDomain never has a wildcard record, so any answer for a random label under it is a lie.
+	canaryDomain = "example.com"
+	// maxConsecutiveFails disables a resolver after that many failures in a row.
+	maxConsecutiveFails = 5
+	// minQueriesForScore is the number of queries before the success rate is taken into account.
+	minQueriesForScore = 20
+	// minScore is the lowest success rate a resolver may have once it is scored.
+	minScore = 0.2
+	// defaultTimeout is the time to wait for a single answer.
+	defaultTimeout = 2 * time.Second
+)
+
+var ErrNoResolvers = errors.New("no healthy resolvers left")
+
+// RcodeError is returned when every attempt of a query was answered with SERVFAIL or REFUSED,
+// and when a nameserver declined a zone transfer.
+type RcodeError struct {
+	Rcode int
+}
+
+func (e *RcodeError) Error() string {
+	return dns.RcodeToString[e.Rcode]
+}
+
+// ResolverStats holds the counters kept for a single resolver.
+type ResolverStats struct {
+	Addr      string  `json:"addr"`
+	Queries   int64   `json:"queries"`
+	Successes int64   `json:"successes"`
+	Timeouts  int64   `json:"timeouts"`
+	ServFails int64   `json:"servfails"`
+	Errors    int64   `json:"errors"`
+	Score     float64 `json:"score"`
+	Lied      bool    `json:"lied"`
+	Disabled  bool    `json:"disabled"`
+}
+
+type resolver struct {
+	addr   string
+	canary sync.Once
+
+	mu               sync.Mutex
+	stats            ResolverStats
+	consecutiveFails int
+	// nextSlot is the earliest time the next query may be sent when rate limited
+	nextSlot time.Time
+}
+
+// ResolverPool spreads queries across a list of resolvers, retries failed
+// queries on another resolver and disables the ones that lie or keep failing.
+type ResolverPool struct {
+	resolvers []*resolver
+	retries   int
+	client    *dns.Client
+	next      uint64
+	healthy   int64
+	// interval is the time between two queries to the same resolver, 0 means no limit
+	interval time.Duration
+}
+
+// NewResolverPool creates a pool from addrs. A failed query is retried up to retries times.
+func NewResolverPool(addrs []string, retries int) (*ResolverPool, error) {
+	if len(addrs) == 0 {
+		return nil, ErrNoResolvers
+	}
+
+	p := &ResolverPool{
+		retries: retries,
+		client:  &dns.Client{Timeout: defaultTimeout},
+		healthy: int64(len(addrs)),
+	}
+	for _, addr := range addrs {
+		p.resolvers = append(p.resolvers, &resolver{addr: addr, stats: ResolverStats{Addr: addr}})
+	}
+
+	return p, nil
+}
+
+// LoadResolvers reads a resolver list with one address per line. Port 53 is used when none is given.
+func LoadResolvers(path string) ([]string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	var addrs []string
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(line); err != nil {
+			line = net.JoinHostPort(line, "53")
+		}
+		addrs = append(addrs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return addrs, nil
+}
+
+// SetRateLimit caps the queries sent to each resolver at perSecond, 0 removes the cap.
+// It must be called before the pool is used.
+func (p *ResolverPool) SetRateLimit(perSecond int) {
+	p.interval = 0
+	if perSecond > 0 {
+		p.interval = time.Second / time.Duration(perSecond)
+	}
+}
+
+// ParseResolvers parses a comma separated list of resolver addresses. Port 53 is used when none is given.
+func ParseResolvers(list string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(list, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// Exchange sends m to the next healthy resolver. Timeouts, SERVFAIL and
+// REFUSED answers are retried on another resolver.
+func (p *ResolverPool) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	var lastErr error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		r := p.pick(ctx)
+		if r == nil {
+			return nil, ErrNoResolvers
+		}
+		if err := p.wait(ctx, r); err != nil {
+			return nil, err
+		}
+
+		in, _, err := p.client.ExchangeContext(ctx, m, r.addr)
+		switch {
+		case ctx.Err() != nil:
+			// The query was cancelled, which says nothing about the resolver
+			return nil, ctx.Err()
+		case err != nil:
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				p.fail(r, func(s *ResolverStats) { s.Timeouts++ })
+			} else {
+				p.fail(r, func(s *ResolverStats) { s.Errors++ })
+			}
+			lastErr = err
+		case in.Rcode == dns.RcodeServerFailure || in.Rcode == dns.RcodeRefused:
+			p.fail(r, func(s *ResolverStats) { s.ServFails++ })
+			lastErr = &RcodeError{Rcode: in.Rcode}
+		default:
+			p.succeed(r)
+			return in, nil
+		}
+	}
+
+	return nil, lastErr
+}
+
+// Stats returns the statistics of every resolver that received at least one query.
+func (p *ResolverPool) Stats() []ResolverStats {
+	var stats []ResolverStats
+	for _, r := range p.resolvers {
+		r.mu.Lock()
+		if r.stats.Queries > 0 || r.stats.Lied {
+			stats = append(stats, r.stats)
+		}
+		r.mu.Unlock()
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Queries > stats[j].Queries })
+
+	return stats
+}
+
+// Healthy returns the number of resolvers that are still in use.
+func (p *ResolverPool) Healthy() int {
+	return int(atomic.LoadInt64(&p.healthy))
+}
+
+// pick returns the next healthy resolver in rotation, checking it for lies on first use.
+func (p *ResolverPool) pick(ctx context.Context) *resolver {
+	for i := 0; i < len(p.resolvers); i++ {
+		r := p.resolvers[atomic.AddUint64(&p.next, 1)%uint64(len(p.resolvers))]
+		r.canary.Do(func() { p.checkLies(ctx, r) })
+		if !r.disabled() {
+			return r
+		}
+	}
+	return nil
+}
+
+// checkLies asks r for a name that cannot exist and disables it if it answers anyway.
+func (p *ResolverPool) checkLies(ctx context.Context, r *resolver) {
+	var m dns.Msg
+	m.SetQuestion(dns.Fqdn(randomLabel()+"."+canaryDomain), dns.TypeA)
+	in, _, err := p.client.ExchangeContext(ctx, &m, r.addr)
+	if err != nil || len(in.Answer) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	r.stats.Lied = true
+	r.mu.Unlock()
+	p.disable(r)
+}
+
+// wait blocks until r may receive another query under the rate limit.
+func (p *ResolverPool) wait(ctx context.Context, r *resolver) error {
+	if p.interval == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	if r.nextSlot.Before(now) {
+		r.nextSlot = now
+	}
+	delay := r.nextSlot.Sub(now)
+	r.nextSlot = r.nextSlot.Add(p.interval)
+	r.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *ResolverPool) succeed(r *resolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats.Queries++
+	r.stats.Successes++
+	r.consecutiveFails = 0
+	r.stats.Score = float64(r.stats.Successes) / float64(r.stats.Queries)
+}
+
+func (p *ResolverPool) fail(r *resolver, count func(*ResolverStats)) {
+	r.mu.Lock()
+	r.stats.Queries++
+	count(&r.stats)
+	r.consecutiveFails++
+	r.stats.Score = float64(r.stats.Successes) / float64(r.stats.Queries)
+	unhealthy := r.consecutiveFails >= maxConsecutiveFails ||
+		(r.stats.Queries >= minQueriesForScore && r.stats.Score < minScore)
+	r.mu.Unlock()
+
+	if unhealthy {
+		p.disable(r)
+	}
+}
+
+// disable takes r out of rotation. The last healthy resolver is never disabled.
+func (p *ResolverPool) disable(r *resolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stats.Disabled {
+		return
+	}
+	if atomic.AddInt64(&p.healthy, -1) < 1 {
+		atomic.AddInt64(&p.healthy, 1)
+		return
+	}
+	r.stats.Disabled = true
+}
+
+func (r *resolver) disabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats.Disabled
+}
@@ -0,0 +1,114 @@
+package subkill3r
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestExchangeRetriesServfail(t *testing.T) {
+	zone := newTestZone(map[string][]string{"www.ex.test": {"10.0.0.1"}})
+	failing := startServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		w.WriteMsg(m)
+	})
+	pool, err := NewResolverPool([]string{failing, startServer(t, zone.ServeDNS)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every query meets the failing resolver once, in turn, and is retried on the other one
+	for i := 0; i < 4; i++ {
+		ips, err := pool.LookupA(context.Background(), "www.ex.test")
+		if err != nil || len(ips) != 1 || ips[0] != "10.0.0.1" {
+			t.Fatalf("LookupA() = %v, %v, want 10.0.0.1", ips, err)
+		}
+	}
+
+	var servfails int64
+	for _, s := range pool.Stats() {
+		if s.Addr == failing {
+			servfails = s.ServFails
+		}
+	}
+	if servfails == 0 {
+		t.Errorf("Stats() = %+v, want the SERVFAIL answers counted", pool.Stats())
+	}
+}
+
+func TestExchangeGivesUpAfterRetries(t *testing.T) {
+	var queries atomic.Int32
+	addr := startServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+	})
+	pool, err := NewResolverPool([]string{addr}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, rcode, err := query(context.Background(), pool.Exchange, "www.ex.test", dns.TypeA)
+	if err == nil || rcode != "REFUSED" {
+		t.Errorf("query() = %q, %v, want REFUSED", rcode, err)
+	}
+	// The canary query and one attempt plus two retries
+	if n := queries.Load(); n != 4 {
+		t.Errorf("server got %v queries, want 4", n)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	zone := newTestZone(map[string][]string{"www.ex.test": {"10.0.0.1"}})
+	pool, err := NewResolverPool([]string{startServer(t, zone.ServeDNS)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.SetRateLimit(20)
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if _, err := pool.LookupA(context.Background(), "www.ex.test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first query goes out at once, the five others wait 50ms each
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Errorf("6 queries at 20 per second took %v, want at least 250ms", elapsed)
+	}
+
+	pool.SetRateLimit(0)
+	start = time.Now()
+	for i := 0; i < 6; i++ {
+		if _, err := pool.LookupA(context.Background(), "www.ex.test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("6 queries without a rate limit took %v", elapsed)
+	}
+}
+
+func TestRateLimitCancelled(t *testing.T) {
+	zone := newTestZone(map[string][]string{"www.ex.test": {"10.0.0.1"}})
+	pool, err := NewResolverPool([]string{startServer(t, zone.ServeDNS)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.SetRateLimit(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := pool.LookupA(ctx, "www.ex.test"); err != nil {
+		t.Fatal(err)
+	}
+	// The next slot is a second away, the wait ends with ctx
+	if _, err := pool.LookupA(ctx, "www.ex.test"); err != context.DeadlineExceeded {
+		t.Errorf("LookupA() after the deadline = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,111 @@
+package subkill3r
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startServer serves h over UDP on 127.0.0.1 until the test ends and returns its address
+func startServer(t *testing.T, h dns.HandlerFunc) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: h, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+// startTCPServer serves h over TCP on 127.0.0.1 until the test ends and returns its address
+func startTCPServer(t *testing.T, h dns.HandlerFunc) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{Listener: l, Handler: h, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return l.Addr().String()
+}
+
+// testZone answers A queries from its records. A "*.zone" key is a wildcard
+// record, the names matching no record get NXDOMAIN.
+type testZone struct {
+	mu      sync.Mutex
+	records map[string][]string
+	// rotate answers a wildcard with one of its addresses at a time, in turn
+	rotate  bool
+	next    int
+	queries map[string]int
+}
+
+func newTestZone(records map[string][]string) *testZone {
+	z := &testZone{records: make(map[string][]string), queries: make(map[string]int)}
+	for name, ips := range records {
+		z.records[dns.Fqdn(name)] = ips
+	}
+	return z
+}
+
+// Queries returns how many times name was asked for
+func (z *testZone) Queries(name string) int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.queries[dns.Fqdn(name)]
+}
+
+func (z *testZone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+
+	z.mu.Lock()
+	z.queries[name]++
+	ips, wildcard, ok := z.find(name)
+	if ok && wildcard && z.rotate && len(ips) > 0 {
+		ips = ips[z.next%len(ips) : z.next%len(ips)+1]
+		z.next++
+	}
+	z.mu.Unlock()
+
+	if !ok {
+		m.Rcode = dns.RcodeNameError
+	} else if q.Qtype == dns.TypeA {
+		for _, ip := range ips {
+			m.Answer = append(m.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP(ip),
+			})
+		}
+	}
+	w.WriteMsg(m)
+}
+
+// find returns the addresses of name, from its own record or the closest wildcard
+func (z *testZone) find(name string) (ips []string, wildcard, ok bool) {
+	if ips, ok := z.records[name]; ok {
+		return ips, false, true
+	}
+	for labels := dns.SplitDomainName(name); len(labels) > 1; labels = labels[1:] {
+		if ips, ok := z.records["*."+dns.Fqdn(strings.Join(labels[1:], "."))]; ok {
+			return ips, true, true
+		}
+	}
+	return nil, false, false
+}
@@ -2,22 +2,44 @@ package subkill3r
 
 import (
 	"bufio"
+	"context"
 	"os"
+	"strings"
+
+	"github.com/LiterallyEthical/r3conwhal3/pkg/logger"
+	"github.com/miekg/dns"
 )
 
-// Result represents the result of a subdomain lookup.
+// Result represents the result of a subdomain lookup. A name that does not
+// resolve has a single Result without IPAdress, its Rcode tells why.
 type Result struct {
-	IPAdress string
-	Hostname string
+	IPAdress   string
+	Hostname   string
+	CNAMEChain []string
+	// Rcode is the response code of the final query of the chain, such as NOERROR,
+	// NXDOMAIN, SERVFAIL or REFUSED. It is empty when no resolver answered.
+	Rcode string
+	// Records holds every answer received for the name, of every type queried
+	Records []Record
 }
 
-// Subkill3r performs subdomain enumeration and returns the results.
-func Subkill3r(domain, wordlist, serverAddr string, workerCount int) ([]Result, error) {
-	var results []Result
-	fqdns := make(chan string, workerCount)
-	gather := make(chan []Result)
-	tracker := make(chan empty)
+// Record is a single DNS answer, its value in presentation format.
+type Record struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Dangling reports whether the CNAME chain points to a name that does not exist,
+// which is what a subdomain open to takeover usually looks like.
+func (r Result) Dangling() bool {
+	return len(r.CNAMEChain) > 0 && r.Rcode == dns.RcodeToString[dns.RcodeNameError]
+}
 
+// Subkill3r performs subdomain enumeration through the resolver pool and returns the results.
+// Names answered by a wildcard record, at the root domain or any nested level, are dropped.
+// Names whose CNAME chain dangles, or that only have records of the other types, are returned without IPAdress.
+// When ctx is cancelled the workers drain and the results found so far are returned with ctx.Err().
+func Subkill3r(ctx context.Context, domain, wordlist string, pool *ResolverPool, workerCount int, types []uint16) ([]Result, error) {
 	fh, err := os.Open(wordlist)
 	if err != nil {
 		return nil, err
@@ -25,20 +47,47 @@ func Subkill3r(domain, wordlist, serverAddr string, workerCount int) ([]Result,
 	defer fh.Close()
 	scanner := bufio.NewScanner(fh)
 
-	// Initializing the Worker goroutines
-	for i := 0; i < workerCount; i++ {
-		go Worker(tracker, fqdns, gather, serverAddr)
+	// Populating subdomains via reading from file
+	fqdns := make(chan string, workerCount)
+	go func() {
+		defer close(fqdns) // No longer data will be sent to channel
+		for scanner.Scan() {
+			select {
+			case fqdns <- formatFQDN(scanner.Text(), domain):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	results, err := Resolve(ctx, domain, fqdns, pool, workerCount, types)
+	if err == nil {
+		err = scanner.Err()
 	}
 
-	// Populating subdomains via reading from file
-	for scanner.Scan() {
-		fqdns <- formatFQDN(scanner.Text(), domain)
+	return results, err
+}
+
+// Resolve resolves the names received on fqdns until the channel is closed,
+// the same way Subkill3r resolves the names of its wordlist. The sender must
+// stop and close fqdns once ctx is cancelled.
+func Resolve(ctx context.Context, domain string, fqdns <-chan string, pool *ResolverPool, workerCount int, types []uint16) ([]Result, error) {
+	var results []Result
+	gather := make(chan []Result)
+	tracker := make(chan empty)
+
+	// Fingerprint the wildcard of the root domain before brute-forcing
+	filter := NewWildcardFilter(domain, pool)
+	if w := filter.Detect(ctx, domain); w != nil {
+		logger.FromContext(ctx).Warning("Wildcard DNS detected for *.%s (%d IPs, %d CNAMEs)", w.Zone, len(w.IPs), len(w.CNAMEs))
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+
+	// Initializing the Worker goroutines
+	for i := 0; i < workerCount; i++ {
+		go Worker(ctx, tracker, fqdns, gather, pool, filter, types)
 	}
 
-	// Gathering and returning the results
+	// Gathering the results while the workers are running
 	go func() {
 		for r := range gather {
 			results = append(results, r...)
@@ -47,17 +96,25 @@ func Subkill3r(domain, wordlist, serverAddr string, workerCount int) ([]Result,
 		tracker <- e
 	}()
 
-	close(fqdns) // No longer data will be sent to channel
 	for i := 0; i < workerCount; i++ {
 		<-tracker
 	}
 	close(gather)
 	<-tracker
 
-	return results, nil
+	// Report the names dropped as wildcard answers
+	if dropped := filter.Dropped(); len(dropped) > 0 {
+		var zones []string
+		for _, w := range filter.Wildcards() {
+			zones = append(zones, "*."+w.Zone)
+		}
+		logger.FromContext(ctx).Warning("%d wildcard results dropped (%s)", len(dropped), strings.Join(zones, ", "))
+	}
+
+	return results, ctx.Err()
 }
 
 // formatFQDN formats the fully qualified domain name.
 func formatFQDN(subdomain, domain string) string {
 	return subdomain + "." + domain
-}
\ No newline at end of file
+}
@@ -0,0 +1,183 @@
+package subkill3r
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// wildcardProbes is the number of random labels queried per zone level. Wildcards
+// served by a CDN rotate their addresses, every probe adds the ones it sees.
+const wildcardProbes = 6
+
+// Wildcard is the fingerprint of the answers a zone returns for names that do not exist.
+type Wildcard struct {
+	Zone   string
+	IPs    map[string]struct{}
+	CNAMEs map[string]struct{}
+}
+
+// matches reports whether the given answers are explained by the wildcard fingerprint.
+// A rotating wildcard never shows all of its addresses, any address in common is a match.
+func (w *Wildcard) matches(ips, cnames []string) bool {
+	for _, cname := range cnames {
+		if _, ok := w.CNAMEs[dns.Fqdn(cname)]; ok {
+			return true
+		}
+	}
+	for _, ip := range ips {
+		if _, ok := w.IPs[ip]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardEntry is the probe result of a zone, kept once a probe got an answer
+type wildcardEntry struct {
+	mu       sync.Mutex
+	done     bool
+	wildcard *Wildcard
+}
+
+// WildcardFilter detects wildcard records under a root domain and drops the
+// results they produce. Every zone level is probed until it answers and the result cached.
+type WildcardFilter struct {
+	domain string
+	pool   *ResolverPool
+
+	mu      sync.Mutex
+	zones   map[string]*wildcardEntry
+	dropped []string
+}
+
+// NewWildcardFilter creates a filter for the names under domain.
+func NewWildcardFilter(domain string, pool *ResolverPool) *WildcardFilter {
+	return &WildcardFilter{
+		domain: strings.TrimSuffix(strings.ToLower(domain), "."),
+		pool:   pool,
+		zones:  make(map[string]*wildcardEntry),
+	}
+}
+
+// Detect probes zone with random labels and returns its wildcard fingerprint,
+// or nil if the zone has no wildcard record. When no probe gets an answer, from
+// timeouts, failing resolvers or a cancelled ctx, nil is returned and the zone
+// is probed again on the next call.
+func (f *WildcardFilter) Detect(ctx context.Context, zone string) *Wildcard {
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+
+	f.mu.Lock()
+	entry, ok := f.zones[zone]
+	if !ok {
+		entry = &wildcardEntry{}
+		f.zones[zone] = entry
+	}
+	f.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if !entry.done {
+		entry.wildcard, entry.done = probeWildcard(ctx, zone, f.pool)
+	}
+
+	return entry.wildcard
+}
+
+// IsWildcard reports whether the answers for fqdn match the wildcard of any
+// zone between its parent and the root domain. Matching names are recorded as dropped.
+func (f *WildcardFilter) IsWildcard(ctx context.Context, fqdn string, ips, cnames []string) bool {
+	for _, zone := range f.parentZones(fqdn) {
+		if w := f.Detect(ctx, zone); w != nil && w.matches(ips, cnames) {
+			f.mu.Lock()
+			f.dropped = append(f.dropped, fqdn)
+			f.mu.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+// Wildcards returns the fingerprints of every zone found to have a wildcard record.
+func (f *WildcardFilter) Wildcards() []*Wildcard {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var wildcards []*Wildcard
+	for _, entry := range f.zones {
+		entry.mu.Lock()
+		if entry.wildcard != nil {
+			wildcards = append(wildcards, entry.wildcard)
+		}
+		entry.mu.Unlock()
+	}
+	sort.Slice(wildcards, func(i, j int) bool { return wildcards[i].Zone < wildcards[j].Zone })
+
+	return wildcards
+}
+
+// Dropped returns the names filtered out as wildcard answers.
+func (f *WildcardFilter) Dropped() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.dropped...)
+}
+
+// parentZones returns the zones from the direct parent of fqdn up to the root domain.
+func (f *WildcardFilter) parentZones(fqdn string) []string {
+	name := strings.TrimSuffix(strings.ToLower(fqdn), ".")
+	if name != f.domain && !strings.HasSuffix(name, "."+f.domain) {
+		return nil
+	}
+
+	var zones []string
+	for name != f.domain {
+		name = name[strings.Index(name, ".")+1:]
+		zones = append(zones, name)
+	}
+
+	return zones
+}
+
+// probeWildcard resolves random labels under zone and collects every answer they
+// receive. answered is false when no probe got a NOERROR or NXDOMAIN answer.
+func probeWildcard(ctx context.Context, zone string, pool *ResolverPool) (w *Wildcard, answered bool) {
+	w = &Wildcard{
+		Zone:   zone,
+		IPs:    make(map[string]struct{}),
+		CNAMEs: make(map[string]struct{}),
+	}
+
+	for i := 0; i < wildcardProbes && ctx.Err() == nil; i++ {
+		ips, cnames, rcode, _ := resolve(ctx, pool.Exchange, randomLabel()+"."+zone, AddressTypes)
+		if len(ips) > 0 || rcode == dns.RcodeToString[dns.RcodeSuccess] || rcode == dns.RcodeToString[dns.RcodeNameError] {
+			answered = true
+		}
+		for _, ip := range ips {
+			w.IPs[ip] = struct{}{}
+		}
+		for _, cname := range cnames {
+			w.CNAMEs[dns.Fqdn(cname)] = struct{}{}
+		}
+	}
+
+	if len(w.IPs) == 0 && len(w.CNAMEs) == 0 {
+		return nil, answered
+	}
+
+	return w, true
+}
+
+// randomLabel returns a label that is very unlikely to exist in any zone.
+func randomLabel() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "r3w-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,134 @@
+package subkill3r
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestWildcardFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		records map[string][]string
+		rotate  bool
+		fqdn    string
+		ips     []string
+		want    bool
+	}{
+		{
+			name:    "root wildcard",
+			records: map[string][]string{"*.ex.test": {"10.0.0.9"}, "www.ex.test": {"10.0.0.1"}},
+			fqdn:    "nope.ex.test",
+			ips:     []string{"10.0.0.9"},
+			want:    true,
+		},
+		{
+			name:    "real host under a wildcard",
+			records: map[string][]string{"*.ex.test": {"10.0.0.9"}, "www.ex.test": {"10.0.0.1"}},
+			fqdn:    "www.ex.test",
+			ips:     []string{"10.0.0.1"},
+			want:    false,
+		},
+		{
+			name:    "nested wildcard",
+			records: map[string][]string{"*.dev.ex.test": {"10.0.0.8"}, "dev.ex.test": {"10.0.0.2"}},
+			fqdn:    "nope.dev.ex.test",
+			ips:     []string{"10.0.0.8"},
+			want:    true,
+		},
+		{
+			name:    "no wildcard",
+			records: map[string][]string{"www.ex.test": {"10.0.0.1"}},
+			fqdn:    "www.ex.test",
+			ips:     []string{"10.0.0.1"},
+			want:    false,
+		},
+		{
+			name:    "rotating wildcard",
+			records: map[string][]string{"*.ex.test": {"10.0.1.1", "10.0.1.2", "10.0.1.3", "10.0.1.4"}},
+			rotate:  true,
+			fqdn:    "nope.ex.test",
+			ips:     []string{"10.0.1.3"},
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := newTestZone(tt.records)
+			zone.rotate = tt.rotate
+			pool, err := NewResolverPool([]string{startServer(t, zone.ServeDNS)}, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filter := NewWildcardFilter("ex.test", pool)
+			if got := filter.IsWildcard(context.Background(), tt.fqdn, tt.ips, nil); got != tt.want {
+				t.Errorf("IsWildcard(%s, %v) = %v, want %v", tt.fqdn, tt.ips, got, tt.want)
+			}
+			if dropped := len(filter.Dropped()) > 0; dropped != tt.want {
+				t.Errorf("Dropped() = %v", filter.Dropped())
+			}
+		})
+	}
+}
+
+func TestWildcardDroppedFromResults(t *testing.T) {
+	zone := newTestZone(map[string][]string{"*.ex.test": {"10.0.0.9"}, "www.ex.test": {"10.0.0.1"}})
+	pool, err := NewResolverPool([]string{startServer(t, zone.ServeDNS)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wordlist := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlist, []byte("www\nadmin\nstaging\nmail\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Subkill3r(context.Background(), "ex.test", wordlist, pool, 4, AddressTypes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Hostname != "www.ex.test" || results[0].IPAdress != "10.0.0.1" {
+		t.Errorf("results = %+v, want only www.ex.test", results)
+	}
+}
+
+func TestWildcardProbeRetriedAfterFailure(t *testing.T) {
+	zone := newTestZone(map[string][]string{"*.ex.test": {"10.0.0.9"}})
+	var failing atomic.Bool
+	failing.Store(true)
+	addr := startServer(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if failing.Load() && strings.HasSuffix(r.Question[0].Name, ".ex.test.") {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeServerFailure)
+			w.WriteMsg(m)
+			return
+		}
+		zone.ServeDNS(w, r)
+	})
+	pool, err := NewResolverPool([]string{addr}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := NewWildcardFilter("ex.test", pool)
+	if w := filter.Detect(context.Background(), "ex.test"); w != nil {
+		t.Fatalf("Detect() with failing probes = %+v, want nil", w)
+	}
+
+	// The failed probes are not cached, the wildcard is found once the zone answers
+	failing.Store(false)
+	w := filter.Detect(context.Background(), "ex.test")
+	if w == nil {
+		t.Fatal("Detect() after the zone recovered = nil, want the wildcard")
+	}
+	if _, ok := w.IPs["10.0.0.9"]; !ok {
+		t.Errorf("wildcard IPs = %v, want 10.0.0.9", w.IPs)
+	}
+}
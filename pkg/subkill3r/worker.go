@@ -1,14 +1,36 @@
 package subkill3r
 
+import "context"
+
 type empty struct{}
 
-func Worker(tracker chan empty, fqdns chan string, gather chan []Result, serverAddr string) {
+func Worker(ctx context.Context, tracker chan empty, fqdns <-chan string, gather chan []Result, pool *ResolverPool, filter *WildcardFilter, types []uint16) {
 	for fqdn := range fqdns {
-		results := Lookup(fqdn, serverAddr)
-		if len(results) > 0  {
-			gather <- results
+		// Drain the remaining names without resolving them once cancelled
+		if ctx.Err() != nil {
+			continue
+		}
+		ips, cnames, rcode, records := resolve(ctx, pool.Exchange, fqdn, types)
+		// Names that do not resolve are only kept when their chain dangles or they
+		// have records of their own, such as the NS records of a delegation
+		unresolved := Result{Hostname: fqdn, CNAMEChain: cnames, Rcode: rcode, Records: records}
+		if len(ips) == 0 && !unresolved.Dangling() && (len(cnames) > 0 || len(records) == 0) {
+			continue
+		}
+		// Drop the answers produced by a wildcard record
+		if filter != nil && filter.IsWildcard(ctx, fqdn, ips, cnames) {
+			continue
+		}
+		if len(ips) == 0 {
+			gather <- []Result{unresolved}
+			continue
+		}
+		var results []Result
+		for _, ip := range ips {
+			results = append(results, Result{IPAdress: ip, Hostname: fqdn, CNAMEChain: cnames, Rcode: rcode, Records: records})
 		}
+		gather <- results
 	}
 	var e empty
 	tracker <- e // send signals to tracker to inform the job has done
-}
\ No newline at end of file
+}
@@ -0,0 +1,311 @@
+package subkill3r
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// maxHashTries bounds the random names hashed while looking for a gap of an
+// NSEC3 chain, the last gaps of a large chain are small.
+const maxHashTries = 1 << 22
+
+// ErrMinimalNSEC is returned for zones that answer with minimally covering NSEC
+// records ("black lies"), their chain only ever points at the name asked for.
+var ErrMinimalNSEC = errors.New("zone uses minimally covering NSEC records")
+
+// NSEC3Params are the hash parameters of an NSEC3 chain.
+type NSEC3Params struct {
+	Hash       uint8  `json:"hash"`
+	Iterations uint16 `json:"iterations"`
+	Salt       string `json:"salt"`
+}
+
+// ZoneWalk is the outcome of walking the denial of existence records of a zone.
+type ZoneWalk struct {
+	Zone string
+	// Denial is NSEC, NSEC3 or empty when the zone is not signed
+	Denial string
+	// Names lists the names of an NSEC chain
+	Names []string
+	// Hashes lists the hashed names of an NSEC3 chain, sorted
+	Hashes []string
+	NSEC3  NSEC3Params
+	// Complete is set once the chain came back to where it started
+	Complete bool
+	Queries  int
+}
+
+// WalkZone detects how zone denies the existence of names and enumerates it
+// from the NSEC or NSEC3 chain, using at most maxQueries queries. An NSEC chain
+// gives the names themselves, an NSEC3 chain only their hashes.
+func (p *ResolverPool) WalkZone(ctx context.Context, zone string, maxQueries int) (*ZoneWalk, error) {
+	zone = dns.Fqdn(strings.ToLower(zone))
+	walk := &ZoneWalk{Zone: strings.TrimSuffix(zone, ".")}
+
+	in, err := p.denialQuery(ctx, randomLabel()+"."+zone, dns.TypeA)
+	walk.Queries++
+	if err != nil {
+		return walk, err
+	}
+
+	for _, rr := range in.Ns {
+		switch rr := rr.(type) {
+		case *dns.NSEC:
+			walk.Denial = "NSEC"
+		case *dns.NSEC3:
+			walk.Denial = "NSEC3"
+			walk.NSEC3 = NSEC3Params{Hash: rr.Hash, Iterations: rr.Iterations, Salt: rr.Salt}
+		}
+	}
+
+	switch walk.Denial {
+	case "NSEC":
+		err = p.walkNSEC(ctx, zone, walk, maxQueries)
+	case "NSEC3":
+		err = p.walkNSEC3(ctx, zone, walk, maxQueries, in)
+	}
+	return walk, err
+}
+
+// Crack hashes every word of the wordlists as a label under the zone and
+// returns the names found in the NSEC3 chain, keyed by their hash.
+func (w *ZoneWalk) Crack(ctx context.Context, wordlists []string, workerCount int) (map[string]string, error) {
+	hashes := make(map[string]bool, len(w.Hashes))
+	for _, h := range w.Hashes {
+		hashes[h] = true
+	}
+	cracked := make(map[string]string)
+	if len(hashes) == 0 {
+		return cracked, nil
+	}
+	if workerCount < 1 {
+		workerCount = 1
+	}
+
+	words := make(chan string, workerCount)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for word := range words {
+				name := word + "." + w.Zone
+				h := dns.HashName(dns.Fqdn(name), w.NSEC3.Hash, w.NSEC3.Iterations, w.NSEC3.Salt)
+				if hashes[h] {
+					mu.Lock()
+					cracked[h] = name
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var err error
+	for _, wordlist := range wordlists {
+		if err = feedWords(ctx, wordlist, words); err != nil {
+			break
+		}
+	}
+	close(words)
+	wg.Wait()
+
+	return cracked, err
+}
+
+// feedWords sends every word of wordlist to words, lowercased
+func feedWords(ctx context.Context, wordlist string, words chan<- string) error {
+	fh, err := os.Open(wordlist)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		word := strings.Trim(strings.ToLower(strings.TrimSpace(scanner.Text())), ".")
+		if word == "" || strings.ContainsAny(word, " \t") {
+			continue
+		}
+		select {
+		case words <- word:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return scanner.Err()
+}
+
+// denialQuery asks for name with the DNSSEC OK bit set, so the NSEC and NSEC3 records come along.
+func (p *ResolverPool) denialQuery(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	var m dns.Msg
+	m.SetQuestion(name, qtype)
+	m.SetEdns0(4096, true)
+	return p.Exchange(ctx, &m)
+}
+
+// walkNSEC follows the NSEC chain of zone from the apex until it comes back to it.
+func (p *ResolverPool) walkNSEC(ctx context.Context, zone string, walk *ZoneWalk, maxQueries int) error {
+	seen := map[string]bool{zone: true}
+	current := zone
+	for walk.Queries < maxQueries {
+		next, err := p.nextNSEC(ctx, current, walk)
+		if err != nil {
+			return err
+		}
+		next = strings.ToLower(next)
+
+		switch {
+		case strings.HasPrefix(next, `\000.`):
+			return ErrMinimalNSEC
+		case seen[next]:
+			walk.Complete = true
+			return nil
+		case !dns.IsSubDomain(zone, next):
+			return fmt.Errorf("NSEC chain of %s leaves the zone at %s", walk.Zone, next)
+		}
+
+		seen[next] = true
+		walk.Names = append(walk.Names, strings.TrimSuffix(next, "."))
+		current = next
+	}
+
+	return nil
+}
+
+// nextNSEC returns the name following current in the NSEC chain. The NSEC
+// record of current is asked for directly, and through the name right after
+// it when the server does not answer NSEC queries.
+func (p *ResolverPool) nextNSEC(ctx context.Context, current string, walk *ZoneWalk) (string, error) {
+	questions := []struct {
+		name  string
+		qtype uint16
+	}{
+		{current, dns.TypeNSEC},
+		{`\000.` + current, dns.TypeA},
+	}
+	for _, q := range questions {
+		in, err := p.denialQuery(ctx, q.name, q.qtype)
+		walk.Queries++
+		if err != nil {
+			return "", err
+		}
+		for _, rr := range append(in.Answer, in.Ns...) {
+			if nsec, ok := rr.(*dns.NSEC); ok && strings.EqualFold(nsec.Hdr.Name, current) {
+				return nsec.NextDomain, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no NSEC record for %s", current)
+}
+
+// nsec3Chain holds the known links of an NSEC3 chain, from the hash of an owner to the next hash.
+type nsec3Chain struct {
+	next   map[string]string
+	owners []string
+}
+
+func (c *nsec3Chain) add(in *dns.Msg, params NSEC3Params) {
+	added := false
+	for _, rr := range in.Ns {
+		n3, ok := rr.(*dns.NSEC3)
+		if !ok || n3.Hash != params.Hash || n3.Iterations != params.Iterations || !strings.EqualFold(n3.Salt, params.Salt) {
+			continue
+		}
+		owner := strings.ToUpper(strings.SplitN(n3.Hdr.Name, ".", 2)[0])
+		if _, ok := c.next[owner]; !ok {
+			c.owners = append(c.owners, owner)
+			added = true
+		}
+		c.next[owner] = strings.ToUpper(n3.NextDomain)
+	}
+	if added {
+		sort.Strings(c.owners)
+	}
+}
+
+// covers reports whether h is a known hash or falls between two known links.
+// Base32hex keeps the order of the hashes, so they compare as strings.
+func (c *nsec3Chain) covers(h string) bool {
+	if len(c.owners) == 0 {
+		return false
+	}
+	i := sort.SearchStrings(c.owners, h)
+	if i < len(c.owners) && c.owners[i] == h {
+		return true
+	}
+	// The link starting before h, the last one wraps around
+	owner := c.owners[len(c.owners)-1]
+	if i > 0 {
+		owner = c.owners[i-1]
+	}
+	next := c.next[owner]
+	if owner < next {
+		return owner < h && h < next
+	}
+	return h > owner || h < next
+}
+
+// complete reports whether every link points at a known owner, which closes the chain.
+func (c *nsec3Chain) complete() bool {
+	if len(c.owners) == 0 {
+		return false
+	}
+	for _, next := range c.next {
+		if _, ok := c.next[next]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// walkNSEC3 collects the links of the NSEC3 chain of zone. Random names are
+// hashed locally and only those falling in a gap of the known chain are asked for.
+func (p *ResolverPool) walkNSEC3(ctx context.Context, zone string, walk *ZoneWalk, maxQueries int, first *dns.Msg) error {
+	chain := &nsec3Chain{next: make(map[string]string)}
+	chain.add(first, walk.NSEC3)
+
+	var err error
+	for tries := 0; tries < maxHashTries && walk.Queries < maxQueries; tries++ {
+		if chain.complete() {
+			walk.Complete = true
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		name := randomLabel() + "." + zone
+		if chain.covers(dns.HashName(name, walk.NSEC3.Hash, walk.NSEC3.Iterations, walk.NSEC3.Salt)) {
+			continue
+		}
+		var in *dns.Msg
+		in, err = p.denialQuery(ctx, name, dns.TypeA)
+		walk.Queries++
+		if err != nil {
+			break
+		}
+		chain.add(in, walk.NSEC3)
+	}
+
+	// Every next hash is an existing name too, even when its own link is still unknown
+	hashes := make(map[string]bool)
+	for owner, next := range chain.next {
+		hashes[owner], hashes[next] = true, true
+	}
+	for h := range hashes {
+		walk.Hashes = append(walk.Hashes, h)
+	}
+	sort.Strings(walk.Hashes)
+
+	return err
+}
@@ -0,0 +1,278 @@
+package subkill3r
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// nsecZone serves the NSEC chain of names, in canonical order from the apex.
+// Without nsecQueries the NSEC records only come with the denial of a name.
+type nsecZone struct {
+	names       []string
+	nsecQueries bool
+	minimal     bool
+}
+
+func (z *nsecZone) record(i int) *dns.NSEC {
+	next := dns.Fqdn(z.names[(i+1)%len(z.names)])
+	if z.minimal {
+		next = `\000.` + dns.Fqdn(z.names[i])
+	}
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: dns.Fqdn(z.names[i]), Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 60},
+		NextDomain: next,
+		TypeBitMap: []uint16{dns.TypeA},
+	}
+}
+
+func (z *nsecZone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+
+	// The owner the name is, or the one it comes after
+	owner := 0
+	for i, n := range z.names {
+		if dns.Fqdn(n) == name {
+			owner = i
+			break
+		}
+		if strings.HasPrefix(name, `\000.`) && dns.Fqdn(n) == name[len(`\000.`):] {
+			owner = i
+		}
+	}
+
+	switch {
+	case q.Qtype == dns.TypeNSEC && z.nsecQueries:
+		m.Answer = append(m.Answer, z.record(owner))
+	case q.Qtype == dns.TypeNSEC:
+	default:
+		m.Rcode = dns.RcodeNameError
+		m.Ns = append(m.Ns, z.record(owner))
+	}
+	w.WriteMsg(m)
+}
+
+func TestWalkNSEC(t *testing.T) {
+	names := []string{"ex.test", "a.ex.test", "mail.ex.test", "www.ex.test"}
+
+	tests := []struct {
+		name         string
+		zone         nsecZone
+		maxQueries   int
+		wantNames    []string
+		wantComplete bool
+		wantErr      error
+	}{
+		{
+			name:         "NSEC queries",
+			zone:         nsecZone{names: names, nsecQueries: true},
+			maxQueries:   100,
+			wantNames:    names[1:],
+			wantComplete: true,
+		},
+		{
+			name:         "through denials",
+			zone:         nsecZone{names: names},
+			maxQueries:   100,
+			wantNames:    names[1:],
+			wantComplete: true,
+		},
+		{
+			name:       "query budget",
+			zone:       nsecZone{names: names, nsecQueries: true},
+			maxQueries: 3,
+			wantNames:  names[1:3],
+		},
+		{
+			name:       "black lies",
+			zone:       nsecZone{names: names, nsecQueries: true, minimal: true},
+			maxQueries: 100,
+			wantErr:    ErrMinimalNSEC,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, err := NewResolverPool([]string{startServer(t, tt.zone.ServeDNS)}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			walk, err := pool.WalkZone(context.Background(), "ex.test", tt.maxQueries)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WalkZone() error = %v, want %v", err, tt.wantErr)
+			}
+			if walk.Denial != "NSEC" {
+				t.Errorf("Denial = %q, want NSEC", walk.Denial)
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(walk.Names, tt.wantNames) {
+				t.Errorf("Names = %v, want %v", walk.Names, tt.wantNames)
+			}
+			if walk.Complete != tt.wantComplete {
+				t.Errorf("Complete = %v, want %v", walk.Complete, tt.wantComplete)
+			}
+			if walk.Queries > tt.maxQueries+1 {
+				t.Errorf("Queries = %d, want at most %d", walk.Queries, tt.maxQueries+1)
+			}
+		})
+	}
+}
+
+// nsec3Zone answers every name with the NSEC3 record of the hash it falls after
+type nsec3Zone struct {
+	params NSEC3Params
+	hashes []string
+}
+
+func newNSEC3Zone(params NSEC3Params, names ...string) *nsec3Zone {
+	z := &nsec3Zone{params: params}
+	for _, name := range names {
+		z.hashes = append(z.hashes, dns.HashName(dns.Fqdn(name), params.Hash, params.Iterations, params.Salt))
+	}
+	sort.Strings(z.hashes)
+	return z
+}
+
+func (z *nsec3Zone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	h := dns.HashName(r.Question[0].Name, z.params.Hash, z.params.Iterations, z.params.Salt)
+	// The last hash not above h, the chain wraps around before the first one
+	i := sort.SearchStrings(z.hashes, h)
+	if i == len(z.hashes) || z.hashes[i] != h {
+		i = (i - 1 + len(z.hashes)) % len(z.hashes)
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeNameError)
+	m.Ns = append(m.Ns, &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: strings.ToLower(z.hashes[i]) + ".ex.test.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 60},
+		Hash:       z.params.Hash,
+		Iterations: z.params.Iterations,
+		SaltLength: uint8(len(z.params.Salt) / 2),
+		Salt:       z.params.Salt,
+		HashLength: 20,
+		NextDomain: z.hashes[(i+1)%len(z.hashes)],
+		TypeBitMap: []uint16{dns.TypeA},
+	})
+	w.WriteMsg(m)
+}
+
+func TestWalkNSEC3(t *testing.T) {
+	params := NSEC3Params{Hash: dns.SHA1, Iterations: 2, Salt: "aabb"}
+	zone := newNSEC3Zone(params, "ex.test", "www.ex.test", "mail.ex.test", "dev.ex.test")
+	pool, err := NewResolverPool([]string{startServer(t, zone.ServeDNS)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walk, err := pool.WalkZone(context.Background(), "ex.test", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walk.Denial != "NSEC3" || walk.NSEC3 != params {
+		t.Errorf("Denial = %q with %+v, want NSEC3 with %+v", walk.Denial, walk.NSEC3, params)
+	}
+	if !walk.Complete || !reflect.DeepEqual(walk.Hashes, zone.hashes) {
+		t.Errorf("Complete = %v with Hashes %v, want %v", walk.Complete, walk.Hashes, zone.hashes)
+	}
+
+	// The names hashed locally land in a known gap, only a few are asked for
+	if walk.Queries > 40 {
+		t.Errorf("Queries = %d for a chain of %d links", walk.Queries, len(zone.hashes))
+	}
+}
+
+func TestNSEC3Chain(t *testing.T) {
+	link := func(owner, next string) *dns.NSEC3 {
+		return &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(owner) + ".ex.test.", Rrtype: dns.TypeNSEC3, Class: dns.ClassINET},
+			Hash:       dns.SHA1,
+			Salt:       "AB",
+			NextDomain: next,
+		}
+	}
+	params := NSEC3Params{Hash: dns.SHA1, Salt: "AB"}
+	partial := &nsec3Chain{next: make(map[string]string)}
+	partial.add(&dns.Msg{Ns: []dns.RR{link("G", "M")}}, params)
+	full := &nsec3Chain{next: make(map[string]string)}
+	full.add(&dns.Msg{Ns: []dns.RR{link("A", "G"), link("M", "A")}}, params)
+	full.add(&dns.Msg{Ns: []dns.RR{link("G", "M")}}, params)
+	// Links of other parameters belong to another chain
+	full.add(&dns.Msg{Ns: []dns.RR{link("C", "D")}}, NSEC3Params{Hash: dns.SHA1, Salt: "CD"})
+
+	tests := []struct {
+		chain *nsec3Chain
+		hash  string
+		want  bool
+	}{
+		{partial, "G", true},
+		{partial, "H", true},
+		{partial, "M", false},
+		{partial, "N", false},
+		{partial, "0", false},
+		{full, "C", true},
+		{full, "M", true},
+		// The last link wraps around to the first hash
+		{full, "N", true},
+		{full, "0", true},
+	}
+	for _, tt := range tests {
+		if got := tt.chain.covers(tt.hash); got != tt.want {
+			t.Errorf("covers(%s) of %v = %v, want %v", tt.hash, tt.chain.next, got, tt.want)
+		}
+	}
+
+	if partial.complete() {
+		t.Error("partial chain complete")
+	}
+	if !full.complete() {
+		t.Errorf("chain %v not complete", full.next)
+	}
+	if len(full.owners) != 3 {
+		t.Errorf("owners = %v, want the links of the walked chain only", full.owners)
+	}
+	if (&nsec3Chain{next: make(map[string]string)}).covers("A") {
+		t.Error("empty chain covers a hash")
+	}
+}
+
+func TestCrack(t *testing.T) {
+	// Hashes of the example zone of RFC 5155 appendix A
+	walk := &ZoneWalk{
+		Zone:  "example",
+		NSEC3: NSEC3Params{Hash: dns.SHA1, Iterations: 12, Salt: "AABBCCDD"},
+		Hashes: []string{
+			"0P9MHAVEQVM6T7VBL5LOP2U3T2RP3TOM",
+			"35MTHGPGCU1QG68FAB165KLNSNK3DPVL",
+			"2T7B4G4VSA5SMI47K61MV5BV1A22BOJR",
+			"GJEQE526PLBF1G8MKLP59ENFD789NJGI",
+			"T644EBQK9BIBCNA874GIVR6JOJ62MLHV",
+		},
+	}
+	wordlist := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlist, []byte("A\nns1.\nai\nmissing\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cracked, err := walk.Crack(context.Background(), []string{wordlist}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"35MTHGPGCU1QG68FAB165KLNSNK3DPVL": "a.example",
+		"2T7B4G4VSA5SMI47K61MV5BV1A22BOJR": "ns1.example",
+		"GJEQE526PLBF1G8MKLP59ENFD789NJGI": "ai.example",
+	}
+	if !reflect.DeepEqual(cracked, want) {
+		t.Errorf("Crack() = %v, want %v", cracked, want)
+	}
+}
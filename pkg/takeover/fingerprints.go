@@ -0,0 +1,163 @@
+package takeover
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed fingerprints.yaml
+var defaultFingerprints []byte
+
+// Fingerprint describes how an unclaimed resource of a service looks
+type Fingerprint struct {
+	Service string `json:"service" yaml:"service"`
+	// CNAME lists suffixes of the CNAME targets pointing at the service
+	CNAME []string `json:"cname" yaml:"cname"`
+	// NXDomain flags the subdomain when its CNAME chain ends in NXDOMAIN
+	NXDomain bool `json:"nxdomain" yaml:"nxdomain"`
+	// Body lists strings of the response body, any of them matches
+	Body []string `json:"body" yaml:"body"`
+	// Status lists the status codes of the response, any of them matches
+	Status []int `json:"status" yaml:"status"`
+	// NS lists suffixes of the nameservers of the service, a subdomain delegated
+	// to them is flagged when they answer SERVFAIL or REFUSED for it
+	NS            []string `json:"ns" yaml:"ns"`
+	Documentation string   `json:"documentation" yaml:"documentation"`
+}
+
+// DefaultFingerprints returns the fingerprint database shipped with r3conwhal3
+func DefaultFingerprints() ([]Fingerprint, error) {
+	return parseFingerprints(defaultFingerprints, yaml.Unmarshal)
+}
+
+// LoadFingerprints reads a fingerprint database from a .json, .yaml or .yml file.
+// An empty path returns the default database.
+func LoadFingerprints(path string) ([]Fingerprint, error) {
+	if path == "" {
+		return DefaultFingerprints()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	unmarshal := yaml.Unmarshal
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		unmarshal = json.Unmarshal
+	}
+
+	fps, err := parseFingerprints(data, unmarshal)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return fps, nil
+}
+
+func parseFingerprints(data []byte, unmarshal func([]byte, interface{}) error) ([]Fingerprint, error) {
+	var fps []Fingerprint
+	if err := unmarshal(data, &fps); err != nil {
+		return nil, err
+	}
+
+	for i, fp := range fps {
+		if err := fp.validate(); err != nil {
+			return nil, fmt.Errorf("fingerprint %v: %v", i+1, err)
+		}
+		for j, cname := range fp.CNAME {
+			fps[i].CNAME[j] = normalize(cname)
+		}
+		for j, ns := range fp.NS {
+			fps[i].NS[j] = normalize(ns)
+		}
+	}
+
+	return fps, nil
+}
+
+func (fp Fingerprint) validate() error {
+	switch {
+	case fp.Service == "":
+		return fmt.Errorf("service is required")
+	case fp.NXDomain && len(fp.CNAME) == 0:
+		return fmt.Errorf("%s: nxdomain needs at least one cname", fp.Service)
+	case len(fp.NS) > 0 && (len(fp.CNAME) > 0 || fp.NXDomain || len(fp.Body) > 0 || len(fp.Status) > 0):
+		return fmt.Errorf("%s: ns cannot be combined with other matchers", fp.Service)
+	case len(fp.NS) == 0 && !fp.NXDomain && len(fp.Body) == 0 && len(fp.Status) == 0:
+		return fmt.Errorf("%s: one of nxdomain, body, status or ns is required", fp.Service)
+	}
+	return nil
+}
+
+// matchCNAME returns the first name of chain pointing at the service
+func (fp Fingerprint) matchCNAME(chain []string) (string, bool) {
+	return matchNames(chain, fp.CNAME)
+}
+
+// matchNS returns the first nameserver of the service in nameservers
+func (fp Fingerprint) matchNS(nameservers []string) (string, bool) {
+	return matchNames(nameservers, fp.NS)
+}
+
+// matchNames returns the first name ending with one of the suffixes. A suffix
+// may use * within a label, as in awsdns-*.com.
+func matchNames(names, suffixes []string) (string, bool) {
+	for _, name := range names {
+		name = normalize(name)
+		labels := strings.Split(name, ".")
+		for _, suffix := range suffixes {
+			n := strings.Count(suffix, ".") + 1
+			if n > len(labels) {
+				continue
+			}
+			if ok, _ := path.Match(suffix, strings.Join(labels[len(labels)-n:], ".")); ok {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// matchBody returns the part of body around the first matching string
+func (fp Fingerprint) matchBody(body string) (string, bool) {
+	for _, s := range fp.Body {
+		if i := strings.Index(body, s); i >= 0 {
+			return snippet(body, i, len(s)), true
+		}
+	}
+	return "", false
+}
+
+func (fp Fingerprint) matchStatus(code int) bool {
+	for _, status := range fp.Status {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
+
+// snippet returns the match at body[i:i+n] with some context on each side, on a single line
+func snippet(body string, i, n int) string {
+	const context = 60
+	start, end := i-context, i+n+context
+	if start < 0 {
+		start = 0
+	}
+	if end > len(body) {
+		end = len(body)
+	}
+	return strings.Join(strings.Fields(body[start:end]), " ")
+}
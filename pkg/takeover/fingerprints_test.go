@@ -0,0 +1,105 @@
+package takeover
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		suffixes []string
+		want     string
+		ok       bool
+	}{
+		{"suffix", []string{"x.s3.amazonaws.com"}, []string{"amazonaws.com"}, "x.s3.amazonaws.com", true},
+		{"case and trailing dot", []string{"X.Herokuapp.COM."}, []string{"herokuapp.com"}, "x.herokuapp.com", true},
+		{"label boundary", []string{"notamazonaws.com"}, []string{"amazonaws.com"}, "", false},
+		{"not a suffix", []string{"amazonaws.com.evil.test"}, []string{"amazonaws.com"}, "", false},
+		{"wildcard label", []string{"ns-1.awsdns-12.com"}, []string{"awsdns-*.com"}, "ns-1.awsdns-12.com", true},
+		{"wildcard label with longer suffix", []string{"ns-2.awsdns-34.co.uk"}, []string{"awsdns-*.co.uk"}, "ns-2.awsdns-34.co.uk", true},
+		{"wildcard within one label only", []string{"ns.awsdns-1.evil.com"}, []string{"awsdns-*.com"}, "", false},
+		{"first matching name", []string{"a.test", "b.github.io", "c.github.io"}, []string{"github.io"}, "b.github.io", true},
+		{"suffix longer than the name", []string{"io"}, []string{"github.io"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchNames(tt.names, tt.suffixes)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("matchNames(%v, %v) = %q, %v, want %q, %v", tt.names, tt.suffixes, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		fp    Fingerprint
+		valid bool
+	}{
+		{"cname and body", Fingerprint{Service: "S3", CNAME: []string{"amazonaws.com"}, Body: []string{"NoSuchBucket"}}, true},
+		{"status only", Fingerprint{Service: "S", Status: []int{404}}, true},
+		{"nxdomain", Fingerprint{Service: "S", CNAME: []string{"x.test"}, NXDomain: true}, true},
+		{"ns", Fingerprint{Service: "S", NS: []string{"awsdns-*.com"}}, true},
+		{"no service", Fingerprint{Body: []string{"x"}}, false},
+		{"nxdomain without cname", Fingerprint{Service: "S", NXDomain: true}, false},
+		{"ns with a body", Fingerprint{Service: "S", NS: []string{"x.test"}, Body: []string{"x"}}, false},
+		{"cname only", Fingerprint{Service: "S", CNAME: []string{"x.test"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fp.validate(); (err == nil) != tt.valid {
+				t.Errorf("validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDefaultFingerprints(t *testing.T) {
+	fps, err := DefaultFingerprints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fps) == 0 {
+		t.Fatal("no default fingerprints")
+	}
+	for _, fp := range fps {
+		for _, cname := range fp.CNAME {
+			if cname != normalize(cname) {
+				t.Errorf("%s: cname %q is not normalized", fp.Service, cname)
+			}
+		}
+	}
+}
+
+func TestLoadFingerprints(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"fps.json":    `[{"service": "S3", "cname": ["Amazonaws.COM."], "body": ["NoSuchBucket"]}]`,
+		"fps.yaml":    "- service: S3\n  cname: [\"Amazonaws.COM.\"]\n  body: [\"NoSuchBucket\"]\n",
+		"broken.yaml": "- service: S3\n  nxdomain: true\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"fps.json", "fps.yaml"} {
+		fps, err := LoadFingerprints(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(fps) != 1 || fps[0].CNAME[0] != "amazonaws.com" {
+			t.Errorf("%s: fingerprints = %+v", name, fps)
+		}
+	}
+	if _, err := LoadFingerprints(filepath.Join(dir, "broken.yaml")); err == nil {
+		t.Error("broken.yaml loaded, want a validation error")
+	}
+}
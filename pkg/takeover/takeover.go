@@ -0,0 +1,358 @@
+package takeover
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LiterallyEthical/r3conwhal3/pkg/subkill3r"
+	"github.com/miekg/dns"
+)
+
+// maxBodySize bounds the part of a response body searched for fingerprints
+const maxBodySize = 1 << 20
+
+// Confidence levels of a finding
+const (
+	High   = "high"
+	Medium = "medium"
+	Low    = "low"
+)
+
+var confidenceRank = map[string]int{Low: 1, Medium: 2, High: 3}
+
+// Options configures a Checker
+type Options struct {
+	// Concurrency is the number of subdomains checked at once
+	Concurrency int
+	// Timeout bounds a single HTTP request
+	Timeout time.Duration
+}
+
+// Finding is a subdomain that looks open to takeover, with the evidence for it
+type Finding struct {
+	Subdomain  string   `json:"subdomain"`
+	Service    string   `json:"service"`
+	Confidence string   `json:"confidence"`
+	CNAMEChain []string `json:"cname_chain"`
+	Rcode      string   `json:"rcode,omitempty"`
+	URL        string   `json:"url,omitempty"`
+	StatusCode int      `json:"status_code,omitempty"`
+	Snippet    string   `json:"snippet,omitempty"`
+	// Records lists the NS and TXT records the finding is based on
+	Records       []string `json:"records,omitempty"`
+	Documentation string   `json:"documentation,omitempty"`
+}
+
+// Checker matches subdomains against a fingerprint database
+type Checker struct {
+	fingerprints []Fingerprint
+	pool         *subkill3r.ResolverPool
+	client       *http.Client
+	opts         Options
+}
+
+// response is what a subdomain serves over HTTP
+type response struct {
+	url    string
+	status int
+	body   string
+}
+
+// New returns a checker resolving through pool
+func New(fingerprints []Fingerprint, pool *subkill3r.ResolverPool, opts Options) *Checker {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 10
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DialContext:         (&net.Dialer{Timeout: opts.Timeout}).DialContext,
+			TLSHandshakeTimeout: opts.Timeout,
+			// Unclaimed resources rarely serve a certificate for the subdomain
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DisableKeepAlives: true,
+		},
+		Timeout: opts.Timeout,
+		// The page of an unclaimed resource is served for the subdomain itself
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &Checker{fingerprints: fingerprints, pool: pool, client: client, opts: opts}
+}
+
+// Run checks every subdomain and calls fn with each finding, one call at a time.
+// It returns once all subdomains are checked or ctx is cancelled.
+func (c *Checker) Run(ctx context.Context, subdomains []string, fn func(Finding)) {
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < c.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for subdomain := range jobs {
+				if f := c.Check(ctx, subdomain); f != nil {
+					mu.Lock()
+					fn(*f)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, subdomain := range subdomains {
+		select {
+		case jobs <- subdomain:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Check returns the most confident finding for subdomain, nil if no fingerprint matches
+func (c *Checker) Check(ctx context.Context, subdomain string) *Finding {
+	subdomain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(subdomain)), ".")
+	if subdomain == "" || ctx.Err() != nil {
+		return nil
+	}
+
+	results := c.pool.Lookup(ctx, subdomain)
+	resolved, rcode := results[0].IPAdress != "", results[0].Rcode
+	chain := make([]string, 0, len(results[0].CNAMEChain))
+	for _, name := range results[0].CNAMEChain {
+		chain = append(chain, strings.TrimSuffix(name, "."))
+	}
+
+	// The subdomain is fetched once, and only if a fingerprint needs its response
+	var resp *response
+	fetched := false
+
+	var best *Finding
+	for _, fp := range c.fingerprints {
+		// Delegations are checked from the NS records
+		if len(fp.NS) > 0 {
+			continue
+		}
+		_, cnameHit := fp.matchCNAME(chain)
+		if len(fp.CNAME) > 0 && !cnameHit {
+			continue
+		}
+
+		f := &Finding{
+			Subdomain:     subdomain,
+			Service:       fp.Service,
+			CNAMEChain:    chain,
+			Rcode:         rcode,
+			Documentation: fp.Documentation,
+		}
+
+		if fp.NXDomain {
+			if rcode != dns.RcodeToString[dns.RcodeNameError] {
+				continue
+			}
+			f.Confidence = High
+		} else {
+			if !resolved {
+				continue
+			}
+			if !fetched {
+				resp, fetched = c.fetch(ctx, subdomain), true
+			}
+			if resp == nil || (len(fp.Status) > 0 && !fp.matchStatus(resp.status)) {
+				continue
+			}
+			snippet, bodyHit := fp.matchBody(resp.body)
+			if len(fp.Body) > 0 && !bodyHit {
+				continue
+			}
+
+			f.URL, f.StatusCode, f.Snippet = resp.url, resp.status, snippet
+			switch {
+			case cnameHit && bodyHit:
+				f.Confidence = High
+			case bodyHit:
+				// Without a CNAME the page may as well be served by the service for another reason
+				f.Confidence = Medium
+			default:
+				f.Confidence = Low
+			}
+		}
+
+		if best == nil || confidenceRank[f.Confidence] > confidenceRank[best.Confidence] {
+			best = f
+		}
+	}
+
+	// A dangling chain no fingerprint knows about is still worth a look
+	if best == nil && results[0].Dangling() {
+		best = &Finding{Subdomain: subdomain, Service: "unknown", Confidence: Low, CNAMEChain: chain, Rcode: rcode}
+	}
+
+	return best
+}
+
+// CheckRecords looks for takeovers in the DNS records of subdomain: a delegation
+// to nameservers that do not serve it and SPF includes of domains that do not exist
+func (c *Checker) CheckRecords(ctx context.Context, subdomain string, records []subkill3r.Record) []Finding {
+	var nameservers, txts []string
+	for _, r := range records {
+		switch r.Type {
+		case "NS":
+			nameservers = append(nameservers, normalize(r.Value))
+		case "TXT":
+			txts = append(txts, r.Value)
+		}
+	}
+
+	var findings []Finding
+	if f := c.checkDelegation(ctx, subdomain, nameservers); f != nil {
+		findings = append(findings, *f)
+	}
+	for _, txt := range txts {
+		findings = append(findings, c.checkSPF(ctx, subdomain, txt)...)
+	}
+
+	return findings
+}
+
+// checkDelegation returns a finding when subdomain is delegated to nameservers
+// of a service that do not serve it, or to a nameserver that does not exist
+func (c *Checker) checkDelegation(ctx context.Context, subdomain string, nameservers []string) *Finding {
+	for _, fp := range c.fingerprints {
+		ns, ok := fp.matchNS(nameservers)
+		if !ok {
+			continue
+		}
+		rcode := c.askNameserver(ctx, ns, subdomain)
+		if rcode != dns.RcodeToString[dns.RcodeServerFailure] && rcode != dns.RcodeToString[dns.RcodeRefused] {
+			continue
+		}
+		return &Finding{
+			Subdomain:     subdomain,
+			Service:       fp.Service,
+			Confidence:    High,
+			Rcode:         rcode,
+			Snippet:       fmt.Sprintf("%s answered %s for %s", ns, rcode, subdomain),
+			Records:       []string{"NS " + ns},
+			Documentation: fp.Documentation,
+		}
+	}
+
+	// Whoever registers the domain of a nameserver that does not exist serves the subdomain
+	for _, ns := range nameservers {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if r := c.pool.Lookup(ctx, ns); r[0].Rcode == dns.RcodeToString[dns.RcodeNameError] {
+			return &Finding{
+				Subdomain:  subdomain,
+				Service:    "unknown",
+				Confidence: Medium,
+				Rcode:      r[0].Rcode,
+				Snippet:    fmt.Sprintf("nameserver %s does not exist", ns),
+				Records:    []string{"NS " + ns},
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkSPF returns a finding for every domain included by the SPF record txt that does not exist
+func (c *Checker) checkSPF(ctx context.Context, subdomain, txt string) []Finding {
+	fields := strings.Fields(txt)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "v=spf1") {
+		return nil
+	}
+
+	var findings []Finding
+	for _, field := range fields[1:] {
+		var domain string
+		switch lower := strings.ToLower(strings.TrimLeft(field, "+-~?")); {
+		case strings.HasPrefix(lower, "include:"):
+			domain = lower[len("include:"):]
+		case strings.HasPrefix(lower, "redirect="):
+			domain = lower[len("redirect="):]
+		}
+		// Macros are expanded per message, there is nothing to look up
+		if domain == "" || strings.Contains(domain, "%") || ctx.Err() != nil {
+			continue
+		}
+		if r := c.pool.Lookup(ctx, domain); r[0].Rcode == dns.RcodeToString[dns.RcodeNameError] {
+			findings = append(findings, Finding{
+				Subdomain:  subdomain,
+				Service:    "SPF include",
+				Confidence: Medium,
+				Rcode:      r[0].Rcode,
+				Snippet:    txt,
+				Records:    []string{"TXT " + field},
+			})
+		}
+	}
+
+	return findings
+}
+
+// askNameserver returns the response code nameserver ns gives for subdomain, "" if it cannot be asked
+func (c *Checker) askNameserver(ctx context.Context, ns, subdomain string) string {
+	var addr string
+	for _, r := range c.pool.Lookup(ctx, ns) {
+		if r.IPAdress != "" {
+			addr = net.JoinHostPort(r.IPAdress, "53")
+			break
+		}
+	}
+	if addr == "" {
+		return ""
+	}
+
+	var m dns.Msg
+	m.SetQuestion(dns.Fqdn(subdomain), dns.TypeSOA)
+	m.RecursionDesired = false
+	client := &dns.Client{Timeout: c.opts.Timeout}
+	in, _, err := client.ExchangeContext(ctx, &m, addr)
+	if err != nil {
+		return ""
+	}
+	return dns.RcodeToString[in.Rcode]
+}
+
+// fetch returns the response of subdomain over https, falling back to http
+func (c *Checker) fetch(ctx context.Context, subdomain string) *response {
+	for _, scheme := range []string{"https", "http"} {
+		url := fmt.Sprintf("%s://%s", scheme, subdomain)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil
+		}
+		req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; r3conwhal3)")
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		resp.Body.Close()
+
+		return &response{url: url, status: resp.StatusCode, body: string(body)}
+	}
+
+	return nil
+}
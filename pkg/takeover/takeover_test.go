@@ -0,0 +1,217 @@
+package takeover
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LiterallyEthical/r3conwhal3/pkg/subkill3r"
+	"github.com/miekg/dns"
+)
+
+// testZone answers like a recursive resolver for its names, the others get NXDOMAIN
+type testZone struct {
+	cnames map[string]string
+	addrs  map[string]string
+	txts   map[string]string
+}
+
+func (z testZone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+
+	target, isAlias := z.cnames[name]
+	addr, hasAddr := z.addrs[name]
+	txt, hasTXT := z.txts[name]
+	switch {
+	case isAlias && q.Qtype == dns.TypeCNAME:
+		m.Answer = append(m.Answer, &dns.CNAME{Hdr: hdr, Target: target})
+	case hasAddr && q.Qtype == dns.TypeA:
+		m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP(addr)})
+	case hasTXT && q.Qtype == dns.TypeTXT:
+		m.Answer = append(m.Answer, &dns.TXT{Hdr: hdr, Txt: []string{txt}})
+	case !isAlias && !hasAddr && !hasTXT:
+		m.Rcode = dns.RcodeNameError
+	}
+	w.WriteMsg(m)
+}
+
+func startDNS(t *testing.T, h dns.Handler) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pc, Handler: h, NotifyStartedFunc: func() { close(started) }}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+// page is the response served for a host
+type page struct {
+	status int
+	body   string
+}
+
+// newTestChecker returns a checker resolving through zone and fetching every
+// subdomain from a local server serving pages by host name
+func newTestChecker(t *testing.T, fps []Fingerprint, zone testZone, pages map[string]page) *Checker {
+	t.Helper()
+
+	pool, err := subkill3r.NewResolverPool([]string{startDNS(t, zone)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := pages[r.Host]
+		if !ok {
+			p = page{status: http.StatusOK, body: "welcome"}
+		}
+		w.WriteHeader(p.status)
+		w.Write([]byte(p.body))
+	}))
+	t.Cleanup(server.Close)
+
+	c := New(fps, pool, Options{})
+	// Every host is served by the local server, https fails its handshake and falls back to http
+	c.client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	return c
+}
+
+func TestCheck(t *testing.T) {
+	fps := []Fingerprint{
+		{Service: "Pages", Body: []string{"There isn't a site here"}},
+		{Service: "Bucket", CNAME: []string{"bucket.test"}, Body: []string{"NoSuchBucket"}, Status: []int{404}},
+		{Service: "Status", CNAME: []string{"status.test"}, Status: []int{410}},
+		{Service: "Gone", CNAME: []string{"gone.test"}, NXDomain: true},
+	}
+	zone := testZone{
+		cnames: map[string]string{
+			"bucket.ex.test.": "x.bucket.test.",
+			"status.ex.test.": "x.status.test.",
+			"old.ex.test.":    "x.gone.test.",
+			"lost.ex.test.":   "x.nowhere.test.",
+			"rank.ex.test.":   "y.bucket.test.",
+			"claim.ex.test.":  "z.bucket.test.",
+		},
+		addrs: map[string]string{
+			"x.bucket.test.": "10.0.0.1",
+			"y.bucket.test.": "10.0.0.1",
+			"z.bucket.test.": "10.0.0.1",
+			"x.status.test.": "10.0.0.2",
+			"pages.ex.test.": "10.0.0.3",
+			"www.ex.test.":   "10.0.0.4",
+		},
+	}
+	pages := map[string]page{
+		"bucket.ex.test": {404, "<Code>NoSuchBucket</Code>"},
+		"status.ex.test": {410, ""},
+		"pages.ex.test":  {404, "There isn't a site here"},
+		"rank.ex.test":   {404, "There isn't a site here. NoSuchBucket"},
+		"claim.ex.test":  {200, "<Code>NoSuchBucket</Code>"},
+	}
+	c := newTestChecker(t, fps, zone, pages)
+
+	tests := []struct {
+		subdomain  string
+		service    string
+		confidence string
+		chain      []string
+	}{
+		{"bucket.ex.test", "Bucket", High, []string{"x.bucket.test"}},
+		{"pages.ex.test", "Pages", Medium, nil},
+		{"status.ex.test", "Status", Low, []string{"x.status.test"}},
+		{"old.ex.test", "Gone", High, []string{"x.gone.test"}},
+		{"lost.ex.test", "unknown", Low, []string{"x.nowhere.test"}},
+		// Both fingerprints match, the most confident one is reported
+		{"rank.ex.test", "Bucket", High, []string{"y.bucket.test"}},
+		// The body matches but the status does not
+		{"claim.ex.test", "", "", nil},
+		{"www.ex.test", "", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subdomain, func(t *testing.T) {
+			f := c.Check(context.Background(), tt.subdomain)
+			if tt.service == "" {
+				if f != nil {
+					t.Errorf("Check = %+v, want no finding", f)
+				}
+				return
+			}
+			if f == nil {
+				t.Fatal("Check = nil, want a finding")
+			}
+			if f.Service != tt.service || f.Confidence != tt.confidence || strings.Join(f.CNAMEChain, ",") != strings.Join(tt.chain, ",") {
+				t.Errorf("Check = %s %s %v, want %s %s %v", f.Service, f.Confidence, f.CNAMEChain, tt.service, tt.confidence, tt.chain)
+			}
+		})
+	}
+
+	if f := c.Check(context.Background(), "bucket.ex.test"); f.StatusCode != 404 || !strings.Contains(f.Snippet, "NoSuchBucket") || f.URL != "http://bucket.ex.test" {
+		t.Errorf("evidence = %s %d %q", f.URL, f.StatusCode, f.Snippet)
+	}
+	if f := c.Check(context.Background(), "old.ex.test"); f.Rcode != "NXDOMAIN" {
+		t.Errorf("rcode = %q, want NXDOMAIN", f.Rcode)
+	}
+}
+
+func TestCheckRecords(t *testing.T) {
+	zone := testZone{
+		addrs: map[string]string{"ns1.live-dns.test.": "10.0.0.5", "mail.provider.test.": "10.0.0.6"},
+		txts:  map[string]string{"spf.provider.test.": "v=spf1 -all"},
+	}
+	c := newTestChecker(t, nil, zone, nil)
+
+	tests := []struct {
+		name    string
+		records []subkill3r.Record
+		want    []string
+	}{
+		{
+			name:    "nameserver that does not exist",
+			records: []subkill3r.Record{{Type: "NS", Value: "ns1.expired-dns.test."}},
+			want:    []string{"unknown medium NS ns1.expired-dns.test"},
+		},
+		{
+			name:    "live nameserver",
+			records: []subkill3r.Record{{Type: "NS", Value: "ns1.live-dns.test."}},
+		},
+		{
+			name:    "SPF include of a missing domain",
+			records: []subkill3r.Record{{Type: "TXT", Value: "v=spf1 include:spf.provider.test ~include:spf.expired.test -all"}},
+			want:    []string{"SPF include medium TXT ~include:spf.expired.test"},
+		},
+		{
+			name:    "SPF macros and other TXT records",
+			records: []subkill3r.Record{{Type: "TXT", Value: "v=spf1 include:%{i}._spf.expired.test -all"}, {Type: "TXT", Value: "include:spf.expired.test"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range c.CheckRecords(context.Background(), "mail.ex.test", tt.records) {
+				got = append(got, strings.Join([]string{f.Service, f.Confidence, strings.Join(f.Records, ",")}, " "))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("CheckRecords = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}